@@ -66,6 +66,13 @@ func (cacher *Cacher) Handle(_ phi.Task, message phi.Message) {
 	data := append(paramsBytes, []byte(msg.Method)...)
 	reqID := sha3.Sum256(data)
 
+	// Debug responses contain the response of every Darknode, so they are
+	// neither served from nor stored in the cache.
+	if msg.Query.Get(http.QueryKeyDebug) != "" {
+		cacher.dispatch(reqID, msg)
+		return
+	}
+
 	switch msg.Method {
 	case jsonrpc.MethodSubmitTx:
 	// case jsonrpc.MethodQueryTx:
@@ -155,7 +162,7 @@ func (cacher *Cacher) dispatch(id [32]byte, msg http.RequestWithResponder) {
 			}
 			return false
 		}
-		if !skipCache() {
+		if msg.Query.Get(http.QueryKeyDebug) == "" && !skipCache() {
 			cacher.insert(id, msg.Query.Get("id"), response)
 		}
 		msg.Responder <- response
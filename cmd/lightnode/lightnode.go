@@ -4,9 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"math/rand"
+	nethttp "net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -26,6 +26,7 @@ import (
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	"github.com/renproject/lightnode"
+	"github.com/renproject/lightnode/dispatcher"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/multichain"
 	"github.com/renproject/pack"
@@ -36,6 +37,11 @@ func main() {
 	// Seed random number generator.
 	rand.Seed(time.Now().UnixNano())
 
+	// Run the subcommand instead of the Lightnode if one has been given.
+	if len(os.Args) > 1 && os.Args[1] == "watcher" {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// Parse Lightnode options from environment variables.
 	options := parseOptions()
 
@@ -56,16 +62,34 @@ func main() {
 
 	ctx := context.Background()
 
-	// Fetch and apply the first successfull exposed config from bootstrap nodes
-	conf, err := getConfigFromBootstrap(ctx, logger, options.BootstrapAddrs)
+	// Expose metrics if a port has been specified.
+	if os.Getenv("METRICS_PORT") != "" {
+		go serveMetrics(logger, os.Getenv("METRICS_PORT"))
+	}
+
+	endpoints, err := http.NewEndpoints(options.Endpoints)
 	if err != nil {
-		logger.Fatalf("failed to fetch config from any bootstrap node")
+		logger.Fatalf("invalid darknode endpoints: %v", err)
+	}
+
+	// Fetch and apply the config agreed on by a quorum of bootstrap nodes. The
+	// Lightnode keeps refreshing it while running.
+	conf, err := getConfigFromBootstrap(ctx, logger, endpoints, options.BootstrapAddrs, options.ConfigQuorum)
+	if err != nil {
+		logger.Fatalf("failed to fetch config from bootstrap nodes: %v", err)
 	}
 
 	options.Whitelist = conf.Whitelist
 
+	// Chains that are missing from the config keep their configured
+	// confirmations.
 	for chain, chainOpt := range options.Chains {
-		chainOpt.Confirmations = conf.Confirmations[chain]
+		confirmations, ok := conf.Confirmations[chain]
+		if !ok {
+			logger.Warnf("%v is missing from the config, using %v confirmations", chain, chainOpt.Confirmations)
+			continue
+		}
+		chainOpt.Confirmations = confirmations
 		options.Chains[chain] = chainOpt
 	}
 
@@ -74,68 +98,17 @@ func main() {
 	node.Run(ctx)
 }
 
-func getConfigFromBootstrap(ctx context.Context, logger logrus.FieldLogger, addrs []wire.Address) (jsonrpc.ResponseQueryConfig, error) {
-	for i, addr := range addrs {
-		conf, err := fetchConfig(ctx, addrToUrl(addr, logger), logger, time.Minute)
-		if i == len(addrs)-1 && err != nil {
-			return conf, err
-		}
-
-		if err == nil {
-			return conf, nil
-		}
-	}
-	return jsonrpc.ResponseQueryConfig{}, fmt.Errorf("Could not load config from darknodes")
+func getConfigFromBootstrap(ctx context.Context, logger logrus.FieldLogger, endpoints http.Endpoints, addrs []wire.Address, quorum int) (jsonrpc.ResponseQueryConfig, error) {
+	client := endpoints.NewClient(time.Minute)
+	return lightnode.FetchConfig(ctx, logger, client, endpoints, addrs, quorum)
 }
 
-func addrToUrl(addr wire.Address, logger logrus.FieldLogger) string {
-	addrParts := strings.Split(addr.Value, ":")
-	if len(addrParts) != 2 {
-		logger.Errorf("[config] invalid address value=%v", addr.Value)
-		return ""
-	}
-	port, err := strconv.Atoi(addrParts[1])
-	if err != nil {
-		logger.Errorf("[config] invalid port=%v", addr)
-		return ""
+// serveMetrics exposes the metrics published using the expvar package at
+// /debug/vars on the given port.
+func serveMetrics(logger logrus.FieldLogger, port string) {
+	if err := nethttp.ListenAndServe(fmt.Sprintf(":%v", port), nethttp.DefaultServeMux); err != nil {
+		logger.Errorf("failed to serve metrics: %v", err)
 	}
-	return fmt.Sprintf("http://%s:%v", addrParts[0], port+1)
-}
-
-func fetchConfig(ctx context.Context, url string, logger logrus.FieldLogger, timeout time.Duration) (jsonrpc.ResponseQueryConfig, error) {
-	var resp jsonrpc.ResponseQueryConfig
-	params, err := json.Marshal(jsonrpc.ParamsQueryConfig{})
-	if err != nil {
-		logger.Errorf("[config] cannot marshal query peers params: %v", err)
-		return resp, err
-	}
-	client := http.NewClient(timeout)
-
-	request := jsonrpc.Request{
-		Version: "2.0",
-		ID:      rand.Int31(),
-		Method:  jsonrpc.MethodQueryConfig,
-		Params:  params,
-	}
-
-	response, err := client.SendRequest(ctx, url, request, nil)
-	if err != nil {
-		logger.Errorf("[config] error calling queryConfig: %v", err)
-		return resp, err
-	}
-
-	raw, err := json.Marshal(response.Result)
-	if err != nil {
-		logger.Errorf("[config] error marshaling queryConfig result: %v", err)
-		return resp, err
-	}
-
-	if err := json.Unmarshal(raw, &resp); err != nil {
-		logger.Warnf("[config] cannot unmarshal queryConfig result from %v: %v", url, err)
-		return resp, err
-	}
-
-	return resp, nil
 }
 
 func initLogger(name string, network multichain.Network) logrus.FieldLogger {
@@ -205,6 +178,24 @@ func parseOptions() lightnode.Options {
 	if os.Getenv("UPDATER_POLL_RATE") != "" {
 		options = options.WithUpdaterPollRate(parseTime("UPDATER_POLL_RATE"))
 	}
+	if os.Getenv("UPDATER_PROBE_RATE") != "" {
+		options = options.WithUpdaterProbeRate(parseTime("UPDATER_PROBE_RATE"))
+	}
+	if os.Getenv("CRAWL_DEPTH") != "" {
+		options = options.WithCrawlDepth(parseInt("CRAWL_DEPTH"))
+	}
+	if os.Getenv("CRAWL_BUDGET") != "" {
+		options = options.WithCrawlBudget(parseInt("CRAWL_BUDGET"))
+	}
+	if os.Getenv("PROBE_FAILURE_THRESHOLD") != "" {
+		options = options.WithProbeFailureThreshold(parseInt("PROBE_FAILURE_THRESHOLD"))
+	}
+	if os.Getenv("CONFIG_REFRESH_RATE") != "" {
+		options = options.WithConfigRefreshRate(parseTime("CONFIG_REFRESH_RATE"))
+	}
+	if os.Getenv("CONFIG_QUORUM") != "" {
+		options = options.WithConfigQuorum(parseInt("CONFIG_QUORUM"))
+	}
 	if os.Getenv("CONFIRMER_POLL_RATE") != "" {
 		options = options.WithConfirmerPollRate(parseTime("CONFIRMER_POLL_RATE"))
 	}
@@ -233,17 +224,81 @@ func parseOptions() lightnode.Options {
 	if os.Getenv("LIMITER_GLOBAL_RATE") != "" {
 		options = options.WithLimiterGlobalRates(parseRates("LIMITER_GLOBAL_RATE"))
 	}
+	if os.Getenv("BREAKER_FAILURE_THRESHOLD") != "" {
+		options = options.WithBreakerFailureThreshold(parseInt("BREAKER_FAILURE_THRESHOLD"))
+	}
+	if os.Getenv("BREAKER_COOLDOWN") != "" {
+		options = options.WithBreakerCooldown(parseTime("BREAKER_COOLDOWN"))
+	}
+	if os.Getenv("ADMIN_TOKEN") != "" {
+		options = options.WithAdminToken(os.Getenv("ADMIN_TOKEN"))
+	}
+	if os.Getenv("DARKNODE_URLS") != "" || os.Getenv("DARKNODE_CA_FILE") != "" || os.Getenv("DARKNODE_CERT_FILE") != "" {
+		options = options.WithEndpoints(http.EndpointOptions{
+			URLs:     parseURLs("DARKNODE_URLS"),
+			CAFile:   os.Getenv("DARKNODE_CA_FILE"),
+			CertFile: os.Getenv("DARKNODE_CERT_FILE"),
+			KeyFile:  os.Getenv("DARKNODE_KEY_FILE"),
+		})
+	}
+	if os.Getenv("PEER_EXPIRY") != "" {
+		options = options.WithPeerExpiry(parseTime("PEER_EXPIRY"))
+	}
+	if os.Getenv("DISPATCH_BATCH_WINDOW_MS") != "" {
+		options = options.WithDispatchBatchWindow(time.Duration(parseInt("DISPATCH_BATCH_WINDOW_MS")) * time.Millisecond)
+	}
+	if os.Getenv("SOLANA_GATEWAY_STATE_SEEDS") != "" {
+		options = options.WithSolanaGatewayStateSeeds(parseStateSeeds("SOLANA_GATEWAY_STATE_SEEDS"))
+	}
+	if os.Getenv("DISPATCH_POLICIES") != "" {
+		options = options.WithDispatchPolicies(options.DispatchPolicies.With(parsePolicies("DISPATCH_POLICIES")))
+	}
+
+	// EVM chains accept a list of RPC endpoints. The first one is used by
+	// the bindings, and the watchers fail over between all of them.
+	watcherRPCs := map[multichain.Chain][]string{}
+	for chain, name := range map[multichain.Chain]string{
+		multichain.Avalanche:         "RPC_AVALANCHE",
+		multichain.BinanceSmartChain: "RPC_BINANCE",
+		multichain.Ethereum:          "RPC_ETHEREUM",
+		multichain.Fantom:            "RPC_FANTOM",
+		multichain.Polygon:           "RPC_POLYGON",
+	} {
+		if os.Getenv(name) != "" {
+			watcherRPCs[chain] = parseRPCs(name)
+		}
+	}
+	options = options.WithWatcherRPCs(watcherRPCs)
+
+	// EVM chains can also have a WebSocket endpoint, which the watchers
+	// subscribe to instead of polling.
+	subscriptionURLs := map[multichain.Chain]string{}
+	for chain, name := range map[multichain.Chain]string{
+		multichain.Avalanche:         "WATCHER_WS_AVALANCHE",
+		multichain.BinanceSmartChain: "WATCHER_WS_BINANCE",
+		multichain.Ethereum:          "WATCHER_WS_ETHEREUM",
+		multichain.Fantom:            "WATCHER_WS_FANTOM",
+		multichain.Polygon:           "WATCHER_WS_POLYGON",
+	} {
+		if os.Getenv(name) != "" {
+			subscriptionURLs[chain] = os.Getenv(name)
+		}
+	}
+	options = options.WithWatcherSubscriptionURLs(subscriptionURLs)
+	if os.Getenv("WATCHER_MAX_HEAD_LAG") != "" {
+		options = options.WithWatcherMaxHeadLag(uint64(parseInt("WATCHER_MAX_HEAD_LAG")))
+	}
 
 	chains := map[multichain.Chain]binding.ChainOptions{}
 	if os.Getenv("RPC_AVALANCHE") != "" {
 		chains[multichain.Avalanche] = binding.ChainOptions{
-			RPC:      pack.String(os.Getenv("RPC_AVALANCHE")),
+			RPC:      pack.String(parseRPCs("RPC_AVALANCHE")[0]),
 			Protocol: pack.String(os.Getenv("GATEWAY_AVALANCHE")),
 		}
 	}
 	if os.Getenv("RPC_BINANCE") != "" {
 		chains[multichain.BinanceSmartChain] = binding.ChainOptions{
-			RPC:      pack.String(os.Getenv("RPC_BINANCE")),
+			RPC:      pack.String(parseRPCs("RPC_BINANCE")[0]),
 			Protocol: pack.String(os.Getenv("GATEWAY_BINANCE")),
 		}
 	}
@@ -269,13 +324,13 @@ func parseOptions() lightnode.Options {
 	}
 	if os.Getenv("RPC_ETHEREUM") != "" {
 		chains[multichain.Ethereum] = binding.ChainOptions{
-			RPC:      pack.String(os.Getenv("RPC_ETHEREUM")),
+			RPC:      pack.String(parseRPCs("RPC_ETHEREUM")[0]),
 			Protocol: pack.String(os.Getenv("GATEWAY_ETHEREUM")),
 		}
 	}
 	if os.Getenv("RPC_FANTOM") != "" {
 		chains[multichain.Fantom] = binding.ChainOptions{
-			RPC:      pack.String(os.Getenv("RPC_FANTOM")),
+			RPC:      pack.String(parseRPCs("RPC_FANTOM")[0]),
 			Protocol: pack.String(os.Getenv("GATEWAY_FANTOM")),
 		}
 	}
@@ -289,7 +344,7 @@ func parseOptions() lightnode.Options {
 	}
 	if os.Getenv("RPC_POLYGON") != "" {
 		chains[multichain.Polygon] = binding.ChainOptions{
-			RPC:      pack.String(os.Getenv("RPC_POLYGON")),
+			RPC:      pack.String(parseRPCs("RPC_POLYGON")[0]),
 			Protocol: pack.String(os.Getenv("GATEWAY_POLYGON")),
 		}
 	}
@@ -374,6 +429,66 @@ func parseRates(name string) map[string]rate.Limit {
 	return rates
 }
 
+func parseURLs(name string) map[string]string {
+	urls := make(map[string]string)
+	if os.Getenv(name) == "" {
+		return urls
+	}
+	urlStrings := strings.Split(os.Getenv(name), ",")
+	for i := range urlStrings {
+		peerURL := strings.SplitN(urlStrings[i], "=", 2)
+		if len(peerURL) != 2 {
+			panic(fmt.Sprintf("invalid url pair %v", urlStrings[i]))
+		}
+		urls[peerURL[0]] = peerURL[1]
+	}
+	return urls
+}
+
+func parseRPCs(name string) []string {
+	rpcs := []string{}
+	for _, rpc := range strings.Split(os.Getenv(name), ",") {
+		rpc = strings.TrimSpace(rpc)
+		if rpc != "" {
+			rpcs = append(rpcs, rpc)
+		}
+	}
+	if len(rpcs) == 0 {
+		panic(fmt.Sprintf("invalid rpc list %v", os.Getenv(name)))
+	}
+	return rpcs
+}
+
+func parseStateSeeds(name string) map[string]string {
+	seeds := make(map[string]string)
+	seedStrings := strings.Split(os.Getenv(name), ",")
+	for i := range seedStrings {
+		gatewaySeed := strings.SplitN(seedStrings[i], "=", 2)
+		if len(gatewaySeed) != 2 {
+			panic(fmt.Sprintf("invalid state seed pair %v", seedStrings[i]))
+		}
+		seeds[gatewaySeed[0]] = gatewaySeed[1]
+	}
+	return seeds
+}
+
+func parsePolicies(name string) dispatcher.Policies {
+	policyStrings := strings.Split(os.Getenv(name), ",")
+	policies := make(dispatcher.Policies)
+	for i := range policyStrings {
+		methodPolicy := strings.SplitN(policyStrings[i], "=", 2)
+		if len(methodPolicy) != 2 {
+			panic(fmt.Sprintf("invalid policy pair %v", policyStrings[i]))
+		}
+		policy, err := dispatcher.ParsePolicy(methodPolicy[1])
+		if err != nil {
+			panic(fmt.Sprintf("invalid policy pair %v: %v", policyStrings[i], err))
+		}
+		policies[methodPolicy[0]] = policy
+	}
+	return policies
+}
+
 func parsePubKey(name string) *id.PubKey {
 	pubKeyString := os.Getenv(name)
 	keyBytes, err := hex.DecodeString(pubKeyString)
@@ -6,6 +6,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/lightnode/http"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,7 +28,7 @@ var _ = Describe("Lightnode cmd test", func() {
 		defer cancel()
 
 		logger := logrus.New()
-		conf, err := getConfigFromBootstrap(ctx, logger, []wire.Address{})
+		conf, err := getConfigFromBootstrap(ctx, logger, http.Endpoints{}, []wire.Address{}, 2)
 		Expect(conf).To(BeZero())
 		Expect(err).Should(HaveOccurred())
 	})
@@ -38,7 +39,7 @@ var _ = Describe("Lightnode cmd test", func() {
 
 		logger := logrus.New()
 		addrs := make([]wire.Address, 3)
-		conf, err := getConfigFromBootstrap(ctx, logger, addrs)
+		conf, err := getConfigFromBootstrap(ctx, logger, http.Endpoints{}, addrs, 2)
 		Expect(conf).To(BeZero())
 		Expect(err).Should(HaveOccurred())
 	})
@@ -56,7 +57,7 @@ var _ = Describe("Lightnode cmd test", func() {
 	// 		Nonce:     0,
 	// 		Signature: [65]byte{},
 	// 	}
-	// 	conf, err := getConfigFromBootstrap(ctx, logger, addrs)
+	// 	conf, err := getConfigFromBootstrap(ctx, logger, http.Endpoints{}, addrs)
 	// 	Expect(conf).NotTo(BeZero())
 	// 	Expect(err).ShouldNot(HaveOccurred())
 	// })
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	nethttp "net/http"
+	"os"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode"
+	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/pack"
+)
+
+// backfillPollInterval is how often the progress of a backfill job is polled.
+const backfillPollInterval = 2 * time.Second
+
+// runCommand runs the subcommand given by the arguments, and returns the exit
+// code of the process.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) >= 2 && args[0] == "watcher" && args[1] == "backfill" {
+		return watcherBackfill(args[2:], stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "usage: lightnode watcher backfill --selector SELECTOR --from BLOCK --to BLOCK\n")
+	return 2
+}
+
+// watcherBackfill asks a running Lightnode to re-scan a range of blocks for
+// the burns of a selector, waits for the backfill to finish, and prints the
+// burns that were found. The requests are authenticated using the ADMIN_TOKEN
+// environment variable.
+func watcherBackfill(args []string, stdout, stderr io.Writer) int {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = lightnode.DefaultPort
+	}
+
+	flags := flag.NewFlagSet("lightnode watcher backfill", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	selector := flags.String("selector", "", "selector of the watcher, for example BTC/fromEthereum")
+	from := flags.Uint64("from", 0, "first block to scan")
+	to := flags.Uint64("to", 0, "last block to scan")
+	url := flags.String("url", fmt.Sprintf("http://localhost:%v", port), "URL of the Lightnode")
+	timeout := flags.Duration("timeout", 10*time.Minute, "how long to wait for the backfill")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *selector == "" || *to < *from {
+		fmt.Fprintf(stderr, "a selector and a valid range of blocks are required\n")
+		flags.Usage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// The backfill runs in the background on the Lightnode, so the job is
+	// polled until it has finished.
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	var job resolver.BackfillJob
+	err := adminRequest(ctx, *url, adminToken, resolver.MethodBackfillWatcher, resolver.ParamsBackfillWatcher{
+		Selector: tx.Selector(*selector),
+		From:     pack.NewU64(*from),
+		To:       pack.NewU64(*to),
+	}, &job)
+	for err == nil && job.Status == resolver.BackfillJobRunning {
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("job=%v still running: %v", job.ID, ctx.Err())
+			continue
+		case <-time.After(backfillPollInterval):
+		}
+		err = adminRequest(ctx, *url, adminToken, resolver.MethodQueryBackfill, resolver.ParamsQueryBackfill{Job: job.ID}, &job)
+	}
+	if err == nil && job.Status == resolver.BackfillJobFailed {
+		err = fmt.Errorf("job=%v failed: %v", job.ID, job.Error)
+	}
+	if err != nil || job.Result == nil {
+		fmt.Fprintf(stderr, "failed to backfill %v: %v\n", *selector, err)
+		return 1
+	}
+
+	result := job.Result
+	for _, burn := range result.Burns {
+		fmt.Fprintf(stdout, "%-5v nonce=%v block=%v hash=%v\n", burn.Status, burn.Nonce, burn.Block, burn.Hash)
+	}
+	fmt.Fprintf(stdout, "backfilled %v from=%v to=%v: new=%v known=%v done=%v\n", result.Selector, result.From, result.To,
+		result.Count(watcher.BackfillStatusNew), result.Count(watcher.BackfillStatusKnown), result.Count(watcher.BackfillStatusDone))
+	return 0
+}
+
+// adminRequest sends an admin request to the Lightnode at the given URL and
+// decodes its result.
+func adminRequest(ctx context.Context, url, adminToken, method string, params, result interface{}) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("cannot marshal params: %v", err)
+	}
+	body, err := json.Marshal(jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  method,
+		Params:  rawParams,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot marshal request: %v", err)
+	}
+	r, err := nethttp.NewRequest(nethttp.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+
+	resp, err := nethttp.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response jsonrpc.Response
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("cannot decode response: %v", err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return fmt.Errorf("cannot marshal result: %v", err)
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("cannot unmarshal result: %v", err)
+	}
+	return nil
+}
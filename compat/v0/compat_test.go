@@ -83,7 +83,9 @@ var _ = Describe("Compat V0", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 
 		sqlDB, err := sql.Open("sqlite3", "./test.db")
+		Expect(err).ShouldNot(HaveOccurred())
 		database := db.New(sqlDB)
+		Expect(database.Init()).Should(Succeed())
 		store := v0.NewCompatStore(database, client)
 
 		return store, client, bindings, (*id.PubKey)(pubkey)
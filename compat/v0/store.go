@@ -58,13 +58,19 @@ func (store Store) decodeHashString(s string) (id.Hash, error) {
 	return hash, nil
 }
 
-// Check redis for existing hash-hash mapping
+// Check redis for existing hash-hash mapping, falling back to the burns
+// persisted by the watchers
 func (store Store) GetV1HashFromHash(v0hash B32) (id.Hash, error) {
 	hashS, err := store.client.Get(v0hash.String()).Result()
-	if err != nil {
-		if err == redis.Nil {
+	if err == redis.Nil {
+		var burn db.WatcherBurn
+		burn, err = store.db.WatcherBurnByV0Hash(v0hash.String())
+		if err == sql.ErrNoRows {
 			err = ErrNotFound
 		}
+		hashS = burn.V1Hash
+	}
+	if err != nil {
 		return id.Hash{}, err
 	}
 
@@ -123,10 +129,15 @@ func (store Store) GetV1TxFromUTXO(utxo ExtBtcCompatUTXO) (tx.Tx, error) {
 func (store Store) GetV0BurnTxHashFromRef(sel tx.Selector, ref uint64) (B32, error) {
 	key := fmt.Sprintf("%s_%v", sel.String(), ref)
 	hashS, err := store.client.Get(key).Result()
-	if err != nil {
-		if err == redis.Nil {
+	if err == redis.Nil {
+		var burn db.WatcherBurn
+		burn, err = store.db.WatcherBurnByNonce(sel, fmt.Sprintf("%v", ref))
+		if err == sql.ErrNoRows {
 			err = ErrNotFound
 		}
+		hashS = burn.V0Hash
+	}
+	if err != nil {
 		return B32{}, err
 	}
 	hashBytes, err := base64.StdEncoding.DecodeString(hashS)
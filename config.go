@@ -0,0 +1,267 @@
+package lightnode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/confirmer"
+	"github.com/renproject/lightnode/http"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+	"github.com/renproject/phi"
+	"github.com/sirupsen/logrus"
+)
+
+// configRefresher periodically fetches the config from the bootstrap nodes and
+// applies changes without restarting the Lightnode. Watchers are started and
+// stopped as selectors are added to or removed from the whitelist, and the
+// bindings of the confirmer are rebuilt when the confirmations change.
+//
+// Only the confirmer checks confirmations, so it is the only consumer of the
+// confirmations. The verifier accepts transactions without confirmations, and
+// the watchers wait for their own confidence interval. Changes that need new
+// chains or gateways, such as the host chains of the verifier or watchers for
+// selectors without a gateway at startup, still require a restart.
+type configRefresher struct {
+	logger    logrus.FieldLogger
+	network   multichain.Network
+	addrs     []wire.Address
+	quorum    int
+	rate      time.Duration
+	endpoints http.Endpoints
+	client    http.Client
+	watchers  *watcherSet
+	confirmer confirmer.Confirmer
+
+	chains    map[multichain.Chain]binding.ChainOptions
+	whitelist []tx.Selector
+
+	// bindings are the bindings last given to the confirmer by the refresher,
+	// which are closed once they have been replaced. The bindings the
+	// confirmer started with are shared, so they are never closed.
+	bindings *binding.Binding
+}
+
+func newConfigRefresher(options Options, logger logrus.FieldLogger, endpoints http.Endpoints, watchers *watcherSet, confirmer confirmer.Confirmer) *configRefresher {
+	chains := make(map[multichain.Chain]binding.ChainOptions, len(options.Chains))
+	for chain, chainOpts := range options.Chains {
+		chains[chain] = chainOpts
+	}
+	return &configRefresher{
+		logger:    logger,
+		network:   options.Network,
+		addrs:     options.BootstrapAddrs,
+		quorum:    options.ConfigQuorum,
+		rate:      options.ConfigRefreshRate,
+		endpoints: endpoints,
+		client:    endpoints.NewClient(options.ClientTimeout),
+		watchers:  watchers,
+		confirmer: confirmer,
+		chains:    chains,
+		whitelist: options.Whitelist,
+	}
+}
+
+// Run refreshes the config at the configured rate. This function is blocking.
+func (refresher *configRefresher) Run(ctx context.Context) {
+	if refresher.rate <= 0 {
+		return
+	}
+	ticker := time.NewTicker(refresher.rate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresher.refresh(ctx)
+		}
+	}
+}
+
+// refresh fetches the config and applies any changes. The confirmations of
+// chains that are missing from the config are left unchanged, so that they are
+// not lowered to zero unless the config explicitly says so.
+func (refresher *configRefresher) refresh(ctx context.Context) {
+	fetchCtx, cancel := context.WithTimeout(ctx, refresher.rate)
+	defer cancel()
+
+	conf, err := FetchConfig(fetchCtx, refresher.logger, refresher.client, refresher.endpoints, refresher.addrs, refresher.quorum)
+	if err != nil {
+		refresher.logger.Warnf("[config] cannot refresh config: %v", err)
+		return
+	}
+
+	if !sameSelectors(refresher.whitelist, conf.Whitelist) {
+		refresher.logger.Infof("[config] whitelist changed from %v to %v", refresher.whitelist, conf.Whitelist)
+		refresher.whitelist = conf.Whitelist
+		refresher.watchers.SetWhitelist(conf.Whitelist)
+	}
+
+	changed := false
+	for chain, chainOpts := range refresher.chains {
+		confirmations, ok := conf.Confirmations[chain]
+		if !ok {
+			refresher.logger.Debugf("[config] %v is missing from the config, keeping %v confirmations", chain, chainOpts.Confirmations)
+			continue
+		}
+		if chainOpts.Confirmations == confirmations {
+			continue
+		}
+		refresher.logger.Infof("[config] %v confirmations changed from %v to %v", chain, chainOpts.Confirmations, confirmations)
+		chainOpts.Confirmations = confirmations
+		refresher.chains[chain] = chainOpts
+		changed = true
+	}
+	if changed {
+		bindings := newBindings(refresher.network, refresher.chains)
+		refresher.confirmer.SetBindings(bindings)
+		if refresher.bindings != nil {
+			closeBindings(refresher.bindings)
+		}
+		refresher.bindings = bindings
+	}
+}
+
+// newBindings returns bindings for the given chains.
+func newBindings(network multichain.Network, chains map[multichain.Chain]binding.ChainOptions) *binding.Binding {
+	bindingsOpts := binding.DefaultOptions().
+		WithNetwork(network)
+	for chain, chainOpts := range chains {
+		chainOpts.MaxConfirmations = pack.MaxU64 // TODO: Eventually we will want to fetch this from the Darknode.
+		bindingsOpts = bindingsOpts.WithChainOptions(chain, chainOpts)
+	}
+	return binding.New(bindingsOpts)
+}
+
+// closeBindings closes the connections of bindings that are no longer used.
+// Requests that are still using them fail, and the transactions they were
+// checking are checked again during the next poll of the confirmer.
+func closeBindings(bindings *binding.Binding) {
+	for _, client := range bindings.EthereumClients() {
+		client.Close()
+	}
+}
+
+// sameSelectors returns whether the given lists contain the same selectors,
+// regardless of their order.
+func sameSelectors(a, b []tx.Selector) bool {
+	selectors := make(map[tx.Selector]int, len(a))
+	for _, selector := range a {
+		selectors[selector]++
+	}
+	for _, selector := range b {
+		selectors[selector]--
+	}
+	for _, n := range selectors {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchConfig queries the config of every bootstrap node and returns the
+// config that at least `quorum` of them agree on. If there are fewer bootstrap
+// nodes than the quorum, then all of them must agree. It returns an error if
+// no config reaches the quorum.
+func FetchConfig(ctx context.Context, logger logrus.FieldLogger, client http.Client, endpoints http.Endpoints, addrs []wire.Address, quorum int) (jsonrpc.ResponseQueryConfig, error) {
+	if len(addrs) == 0 {
+		return jsonrpc.ResponseQueryConfig{}, fmt.Errorf("no bootstrap nodes to fetch config from")
+	}
+	if quorum > len(addrs) || quorum <= 0 {
+		quorum = len(addrs)
+	}
+
+	mu := new(sync.Mutex)
+	votes := map[string]int{}
+	confs := map[string]jsonrpc.ResponseQueryConfig{}
+	phi.ParForAll(addrs, func(i int) {
+		url, err := endpoints.URL(addrs[i])
+		if err != nil {
+			logger.Errorf("[config] %v", err)
+			return
+		}
+		conf, err := fetchConfig(ctx, client, url, logger)
+		if err != nil {
+			return
+		}
+
+		// Configs are compared by their JSON encoding, which is
+		// deterministic because map keys are sorted. The order of the
+		// whitelist does not matter, so it is sorted as well.
+		whitelist := make([]tx.Selector, len(conf.Whitelist))
+		copy(whitelist, conf.Whitelist)
+		sort.Slice(whitelist, func(i, j int) bool {
+			return whitelist[i] < whitelist[j]
+		})
+		conf.Whitelist = whitelist
+		key, err := json.Marshal(conf)
+		if err != nil {
+			logger.Errorf("[config] cannot marshal config from %v: %v", url, err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		votes[string(key)]++
+		confs[string(key)] = conf
+	})
+
+	for key, n := range votes {
+		if n >= quorum {
+			return confs[key], nil
+		}
+	}
+	return jsonrpc.ResponseQueryConfig{}, fmt.Errorf("no config agreed on by %v of %v bootstrap nodes (%v distinct configs)", quorum, len(addrs), len(votes))
+}
+
+func fetchConfig(ctx context.Context, client http.Client, url string, logger logrus.FieldLogger) (jsonrpc.ResponseQueryConfig, error) {
+	var resp jsonrpc.ResponseQueryConfig
+	params, err := json.Marshal(jsonrpc.ParamsQueryConfig{})
+	if err != nil {
+		logger.Errorf("[config] cannot marshal query config params: %v", err)
+		return resp, err
+	}
+
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  jsonrpc.MethodQueryConfig,
+		Params:  params,
+	}
+
+	response, err := client.SendRequest(ctx, url, request, nil)
+	if err != nil {
+		logger.Errorf("[config] error calling queryConfig: %v", err)
+		return resp, err
+	}
+	if response.Error != nil {
+		err := fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+		logger.Errorf("[config] error calling queryConfig: %v", err)
+		return resp, err
+	}
+
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		logger.Errorf("[config] error marshaling queryConfig result: %v", err)
+		return resp, err
+	}
+
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		logger.Warnf("[config] cannot unmarshal queryConfig result from %v: %v", url, err)
+		return resp, err
+	}
+	return resp, nil
+}
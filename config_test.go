@@ -0,0 +1,96 @@
+package lightnode_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	lhttp "github.com/renproject/lightnode/http"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Config", func() {
+	configServer := func(whitelist []tx.Selector) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var request jsonrpc.Request
+			Expect(json.NewDecoder(r.Body).Decode(&request)).To(Succeed())
+			response := jsonrpc.Response{
+				Version: "2.0",
+				ID:      request.ID,
+				Result:  jsonrpc.ResponseQueryConfig{Whitelist: whitelist},
+			}
+			Expect(json.NewEncoder(w).Encode(response)).To(Succeed())
+		}))
+	}
+
+	// fetch returns the config from the given servers with the given quorum.
+	fetch := func(servers []*httptest.Server, quorum int) (jsonrpc.ResponseQueryConfig, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		urls := map[string]string{}
+		addrs := make([]wire.Address, len(servers))
+		for i, server := range servers {
+			addrs[i] = wire.Address{Value: fmt.Sprintf("bootstrap-%v", i)}
+			urls[addrs[i].Value] = server.URL
+		}
+		endpoints, err := lhttp.NewEndpoints(lhttp.EndpointOptions{URLs: urls})
+		Expect(err).NotTo(HaveOccurred())
+		return FetchConfig(ctx, logrus.New(), endpoints.NewClient(time.Second), endpoints, addrs, quorum)
+	}
+
+	Context("when fetching the config from the bootstrap nodes", func() {
+		It("should return the config agreed on by a quorum", func() {
+			agreed := []tx.Selector{"BTC/toEthereum", "BTC/fromEthereum"}
+			servers := []*httptest.Server{
+				configServer(agreed),
+				configServer([]tx.Selector{"BTC/toEthereum"}),
+				configServer(agreed),
+			}
+			for _, server := range servers {
+				defer server.Close()
+			}
+
+			conf, err := fetch(servers, 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Whitelist).To(ConsistOf(agreed))
+		})
+
+		It("should agree on whitelists that only differ in their order", func() {
+			servers := []*httptest.Server{
+				configServer([]tx.Selector{"BTC/toEthereum", "BTC/fromEthereum"}),
+				configServer([]tx.Selector{"BTC/fromEthereum", "BTC/toEthereum"}),
+			}
+			for _, server := range servers {
+				defer server.Close()
+			}
+
+			conf, err := fetch(servers, 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conf.Whitelist).To(ConsistOf(tx.Selector("BTC/toEthereum"), tx.Selector("BTC/fromEthereum")))
+		})
+
+		It("should fail if no config reaches the quorum", func() {
+			servers := []*httptest.Server{
+				configServer([]tx.Selector{"BTC/toEthereum"}),
+				configServer([]tx.Selector{"BTC/fromEthereum"}),
+			}
+			for _, server := range servers {
+				defer server.Close()
+			}
+
+			_, err := fetch(servers, 2)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -7,12 +7,14 @@ import (
 	"math/rand"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
+	"github.com/renproject/id"
 	"github.com/renproject/lightnode/db"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/multichain"
@@ -27,19 +29,48 @@ type Confirmer struct {
 	options    Options
 	dispatcher phi.Sender
 	database   db.DB
-	bindings   binding.Bindings
+
+	bindingsMu *sync.RWMutex
+	bindings   *binding.Bindings
+
+	// submitting are the hashes of the transactions that are being submitted
+	// to the Darknodes, so that they are not submitted again by later polls.
+	submittingMu *sync.Mutex
+	submitting   map[id.Hash]struct{}
 }
 
 // New returns a new Confirmer.
 func New(options Options, dispatcher phi.Sender, db db.DB, bindings binding.Bindings) Confirmer {
 	return Confirmer{
-		options:    options,
-		dispatcher: dispatcher,
-		database:   db,
-		bindings:   bindings,
+		options:      options,
+		dispatcher:   dispatcher,
+		database:     db,
+		bindingsMu:   new(sync.RWMutex),
+		bindings:     &bindings,
+		submittingMu: new(sync.Mutex),
+		submitting:   map[id.Hash]struct{}{},
 	}
 }
 
+// SetBindings replaces the bindings used to check confirmations, for example
+// when the number of confirmations required by the Darknodes changes. It is
+// safe to call while the confirmer is running, and copies of the confirmer
+// share the same bindings.
+func (confirmer *Confirmer) SetBindings(bindings binding.Bindings) {
+	confirmer.bindingsMu.Lock()
+	defer confirmer.bindingsMu.Unlock()
+
+	*confirmer.bindings = bindings
+}
+
+// currentBindings returns the bindings used to check confirmations.
+func (confirmer *Confirmer) currentBindings() binding.Bindings {
+	confirmer.bindingsMu.RLock()
+	defer confirmer.bindingsMu.RUnlock()
+
+	return *confirmer.bindings
+}
+
 // Run starts running the confirmer in the background which periodically checks
 // confirmations for pending transactions and prunes old transactions.
 func (confirmer *Confirmer) Run(ctx context.Context) {
@@ -98,46 +129,143 @@ func (confirmer *Confirmer) checkPendingTxs(parent context.Context) {
 
 		if confirmed {
 			confirmer.options.Logger.Infof("tx=%v has reached sufficient confirmations", tx.Hash.String())
-			confirmer.confirm(ctx, tx)
+			confirmer.confirm(parent, tx)
 		}
 	})
 }
 
-// confirm sends the transaction to the dispatcher and marks it as confirmed if
-// it receives a non-error response from the Darknodes.
-func (confirmer *Confirmer) confirm(ctx context.Context, transaction tx.Tx) {
-	request, err := submitTxRequest(transaction)
-	if err != nil {
-		confirmer.options.Logger.Errorf("[confirmer] cannot construct json request for transaction: %v", err)
-		return
-	}
-	req := http.NewRequestWithResponder(ctx, request.ID, request.Method, request.Params, url.Values{})
-	if ok := confirmer.dispatcher.Send(req); !ok {
-		confirmer.options.Logger.Errorf("[confirmer] cannot send message to dispatcher: too much back pressure")
+// confirm submits the transaction to the Darknodes and marks it as submitted
+// once they have acknowledged it. Transactions that are not acknowledged stay
+// pending and are submitted again during the next poll. The submission is
+// given its own timeout, so that its retries are not cut off when the poll
+// ends, and a transaction is not submitted again while it is being submitted.
+func (confirmer *Confirmer) confirm(parent context.Context, transaction tx.Tx) {
+	if !confirmer.startSubmitting(transaction.Hash) {
 		return
 	}
-
 	go func() {
-		select {
-		case <-ctx.Done():
+		defer confirmer.stopSubmitting(transaction.Hash)
+
+		ctx, cancel := context.WithTimeout(parent, confirmer.options.SubmitTimeout)
+		defer cancel()
+
+		if err := confirmer.submit(ctx, transaction); err != nil {
+			confirmer.options.Logger.Errorf("[confirmer] cannot submit tx=%v to darknodes: %v", transaction.Hash.String(), err)
 			return
-		case response := <-req.Responder:
-			if response.Error == nil ||
-				strings.Contains(response.Error.Message, "status=done") ||
-				strings.Contains(response.Error.Message, "status = done") {
-				confirmer.options.Logger.Infof("✅ successfully submitted tx=%v to darknodes", transaction.Hash.String())
-			} else {
-				confirmer.options.Logger.Errorf("[confirmer] getting error back when submitting tx=%v: [%v] %v", transaction.Hash.String(), response.Error.Code, response.Error.Message)
-				return
-			}
+		}
+		confirmer.options.Logger.Infof("✅ successfully submitted tx=%v to darknodes", transaction.Hash.String())
 
-			if err := confirmer.database.UpdateStatus(transaction.Hash, db.TxStatusConfirmed); err != nil {
-				confirmer.options.Logger.Errorf("[confirmer] cannot update transaction status: %v", err)
-			}
+		if err := confirmer.database.UpdateStatus(transaction.Hash, db.TxStatusSubmitted); err != nil {
+			confirmer.options.Logger.Errorf("[confirmer] cannot update transaction status: %v", err)
 		}
 	}()
 }
 
+// startSubmitting records that the transaction with the given hash is being
+// submitted. It returns false if it is already being submitted.
+func (confirmer *Confirmer) startSubmitting(hash id.Hash) bool {
+	confirmer.submittingMu.Lock()
+	defer confirmer.submittingMu.Unlock()
+
+	if _, ok := confirmer.submitting[hash]; ok {
+		return false
+	}
+	confirmer.submitting[hash] = struct{}{}
+	return true
+}
+
+// stopSubmitting records that the transaction with the given hash is no longer
+// being submitted.
+func (confirmer *Confirmer) stopSubmitting(hash id.Hash) {
+	confirmer.submittingMu.Lock()
+	defer confirmer.submittingMu.Unlock()
+
+	delete(confirmer.submitting, hash)
+}
+
+// submit sends the transaction to the Darknodes and then queries them for it,
+// retrying with backoff until they acknowledge it. An error response to the
+// submission alone is not treated as a failure, because the Darknodes also
+// reject transactions they have already seen.
+func (confirmer *Confirmer) submit(ctx context.Context, transaction tx.Tx) error {
+	request, err := submitTxRequest(transaction)
+	if err != nil {
+		return fmt.Errorf("cannot construct json request for transaction: %v", err)
+	}
+
+	retry := confirmer.options.SubmitRetry
+	interval := retry.Base
+	for attempt := 0; attempt < confirmer.options.SubmitAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%v, last error = %v", ctx.Err(), err)
+			case <-time.After(interval):
+			}
+			interval = time.Duration(float64(interval) * (1 + retry.Factor))
+			if interval > retry.Max {
+				interval = retry.Max
+			}
+		}
+
+		response, submitErr := confirmer.send(ctx, request.Method, request.Params)
+		if submitErr == nil && response.Error != nil {
+			submitErr = fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+		}
+		if submitErr != nil {
+			confirmer.options.Logger.Warnf("[confirmer] error submitting tx=%v (attempt %v): %v", transaction.Hash.String(), attempt+1, submitErr)
+		}
+
+		err = confirmer.acknowledged(ctx, transaction.Hash)
+		if err == nil {
+			return nil
+		}
+		if submitErr != nil {
+			err = submitErr
+		}
+	}
+	return err
+}
+
+// acknowledged returns an error if the Darknodes do not know about the
+// transaction with the given hash.
+func (confirmer *Confirmer) acknowledged(ctx context.Context, hash id.Hash) error {
+	response, err := confirmer.send(ctx, jsonrpc.MethodQueryTx, jsonrpc.ParamsQueryTx{TxHash: hash})
+	if err != nil {
+		return err
+	}
+	if response.Error != nil {
+		return fmt.Errorf("querying tx: [%v] %v", response.Error.Code, response.Error.Message)
+	}
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return fmt.Errorf("cannot marshal queryTx result: %v", err)
+	}
+	var resp jsonrpc.ResponseQueryTx
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("cannot unmarshal queryTx result: %v", err)
+	}
+	if resp.Tx.Hash != hash {
+		return fmt.Errorf("tx not acknowledged by darknodes")
+	}
+	return nil
+}
+
+// send sends a request to the dispatcher and waits for its response.
+func (confirmer *Confirmer) send(ctx context.Context, method string, params interface{}) (jsonrpc.Response, error) {
+	req := http.NewRequestWithResponder(ctx, rand.Int63(), method, params, url.Values{})
+	if ok := confirmer.dispatcher.Send(req); !ok {
+		return jsonrpc.Response{}, fmt.Errorf("cannot send message to dispatcher: too much back pressure")
+	}
+
+	select {
+	case <-ctx.Done():
+		return jsonrpc.Response{}, ctx.Err()
+	case response := <-req.Responder:
+		return response, nil
+	}
+}
+
 // lockTxConfirmed checks if a given lock transaction has received sufficient
 // confirmations.
 func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.Tx) bool {
@@ -149,7 +277,7 @@ func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.
 			confirmer.options.Logger.Errorf("[confirmer] failed to decode input for tx=%v: %v", transaction.Hash.String(), err)
 			return false
 		}
-		_, err := confirmer.bindings.UTXOLockInfo(ctx, lockChain, transaction.Selector.Asset(), multichain.UTXOutpoint{
+		_, err := confirmer.currentBindings().UTXOLockInfo(ctx, lockChain, transaction.Selector.Asset(), multichain.UTXOutpoint{
 			Hash:  input.Txid,
 			Index: input.Txindex,
 		})
@@ -168,7 +296,7 @@ func (confirmer *Confirmer) lockTxConfirmed(ctx context.Context, transaction tx.
 			confirmer.options.Logger.Errorf("[confirmer] failed to decode input for tx=%v: %v", transaction.Hash.String(), err)
 			return false
 		}
-		_, err := confirmer.bindings.AccountLockInfo(ctx, lockChain, transaction.Selector.Asset(), input.Txid)
+		_, err := confirmer.currentBindings().AccountLockInfo(ctx, lockChain, transaction.Selector.Asset(), input.Txid)
 		if err != nil {
 			if !strings.Contains(err.Error(), "insufficient confirmations") {
 				confirmer.options.Logger.Errorf("[confirmer] cannot get output for account tx=%v (%v): %v", input.Txid.String(), transaction.Selector.String(), err)
@@ -193,7 +321,7 @@ func (confirmer *Confirmer) burnTxConfirmed(ctx context.Context, transaction tx.
 		return false
 	}
 
-	_, _, _, err := confirmer.bindings.AccountBurnInfo(ctx, burnChain, transaction.Selector.Asset(), nonce)
+	_, _, _, err := confirmer.currentBindings().AccountBurnInfo(ctx, burnChain, transaction.Selector.Asset(), nonce)
 	if err != nil {
 		if !strings.Contains(err.Error(), "insufficient confirmations") {
 			confirmer.options.Logger.Errorf("[confirmer] cannot get burn info for tx=%v (%v): %v", transaction.Hash.String(), transaction.Selector.String(), err)
@@ -27,7 +27,7 @@ var _ = Describe("Confirmer", func() {
 	}
 
 	Context("when txs have received sufficient confirmations", func() {
-		It("should mark them as confirmed", func() {
+		It("should mark them as submitted", func() {
 			// Initialise confirmer.
 			logger := logrus.New()
 
@@ -79,7 +79,7 @@ var _ = Describe("Confirmer", func() {
 			for i := range hashes {
 				status, err := database.TxStatus(hashes[i])
 				Expect(err).ToNot(HaveOccurred())
-				Expect(status).To(Equal(db.TxStatusConfirmed))
+				Expect(status).To(Equal(db.TxStatusSubmitted))
 			}
 		})
 
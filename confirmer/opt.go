@@ -3,29 +3,39 @@ package confirmer
 import (
 	"time"
 
+	"github.com/renproject/lightnode/http"
 	"github.com/sirupsen/logrus"
 )
 
 // Enumerate default options.
 var (
-	DefaultPollInterval = 30 * time.Second
-	DefaultExpiry       = 14 * 24 * time.Hour
+	DefaultPollInterval   = 30 * time.Second
+	DefaultExpiry         = 14 * 24 * time.Hour
+	DefaultSubmitAttempts = 3
+	DefaultSubmitRetry    = http.DefaultRetryOptions
+	DefaultSubmitTimeout  = time.Minute
 )
 
 // Options to configure the precise behaviour of the confirmer.
 type Options struct {
-	Logger       logrus.FieldLogger
-	PollInterval time.Duration
-	Expiry       time.Duration
+	Logger         logrus.FieldLogger
+	PollInterval   time.Duration
+	Expiry         time.Duration
+	SubmitAttempts int
+	SubmitRetry    http.RetryOptions
+	SubmitTimeout  time.Duration
 }
 
 // DefaultOptions returns new options with default configurations that should
 // work for the majority of use cases.
 func DefaultOptions() Options {
 	return Options{
-		Logger:       logrus.New(),
-		PollInterval: DefaultPollInterval,
-		Expiry:       DefaultExpiry,
+		Logger:         logrus.New(),
+		PollInterval:   DefaultPollInterval,
+		Expiry:         DefaultExpiry,
+		SubmitAttempts: DefaultSubmitAttempts,
+		SubmitRetry:    DefaultSubmitRetry,
+		SubmitTimeout:  DefaultSubmitTimeout,
 	}
 }
 
@@ -46,3 +56,25 @@ func (opts Options) WithExpiry(expiry time.Duration) Options {
 	opts.Expiry = expiry
 	return opts
 }
+
+// WithSubmitAttempts returns new options with the given number of attempts
+// made to submit a transaction to the Darknodes before it is left for the
+// next poll.
+func (opts Options) WithSubmitAttempts(attempts int) Options {
+	opts.SubmitAttempts = attempts
+	return opts
+}
+
+// WithSubmitRetry returns new options with the given backoff between attempts
+// to submit a transaction.
+func (opts Options) WithSubmitRetry(retry http.RetryOptions) Options {
+	opts.SubmitRetry = retry
+	return opts
+}
+
+// WithSubmitTimeout returns new options with the given time allowed for all
+// attempts to submit a transaction, which is independent of the poll interval.
+func (opts Options) WithSubmitTimeout(timeout time.Duration) Options {
+	opts.SubmitTimeout = timeout
+	return opts
+}
@@ -30,6 +30,16 @@ const (
 	GatewayStatusUsed
 )
 
+// WatcherNonceStatus is the outcome of submitting the burn with a nonce.
+type WatcherNonceStatus uint8
+
+const (
+	WatcherNonceStatusNil WatcherNonceStatus = iota
+	WatcherNonceStatusRejected
+	WatcherNonceStatusAccepted
+	WatcherNonceStatusDone
+)
+
 type Scannable interface {
 	Scan(dest ...interface{}) error
 }
@@ -78,6 +88,118 @@ type DB interface {
 
 	// Gateways returns gateways with the given pagination options.
 	Gateways(offset, limit int) ([]tx.Tx, error)
+
+	// InsertPeer inserts the peer into the database, or updates its address
+	// and last seen time if it already exists. The health of an existing peer
+	// is left unchanged.
+	InsertPeer(peer Peer) error
+
+	// UpdatePeerHealth updates the health of the peer with the given
+	// signatory.
+	UpdatePeerHealth(signatory string, latency time.Duration, errors float64) error
+
+	// Peers returns all peers in the database.
+	Peers() ([]Peer, error)
+
+	// DeletePeer deletes the peer with the given signatory.
+	DeletePeer(signatory string) error
+
+	// WatcherCheckpoint returns the last block checked by the watcher for the
+	// given selector. It returns an `sql.ErrNoRows` if the watcher has not
+	// stored a checkpoint yet.
+	WatcherCheckpoint(selector tx.Selector) (uint64, error)
+
+	// UpdateWatcherCheckpoint stores the last block checked by the watcher for
+	// the given selector, along with the hash of the block and the burns found
+	// since the previous checkpoint, in a single transaction. The hash is not
+	// stored if it is empty. The hashes of blocks after the checkpoint are
+	// removed, and only the hashes of the most recent checkpoints are kept.
+	UpdateWatcherCheckpoint(selector tx.Selector, block uint64, blockHash string, burns []WatcherBurn) error
+
+	// WatcherBlockHashes returns the hashes of the blocks at the most recent
+	// checkpoints of the watcher for the given selector, keyed by their
+	// height.
+	WatcherBlockHashes(selector tx.Selector) (map[uint64]string, error)
+
+	// InsertWatcherBurns stores burns found by a watcher without moving its
+	// checkpoint, for example when backfilling a range of blocks.
+	InsertWatcherBurns(burns []WatcherBurn) error
+
+	// WatcherBurnByV0Hash returns the burn with the given v0 hash. It returns
+	// an `sql.ErrNoRows` if the burn cannot be found.
+	WatcherBurnByV0Hash(v0Hash string) (WatcherBurn, error)
+
+	// WatcherBurnByNonce returns the burn for the given selector with the given
+	// nonce. It returns an `sql.ErrNoRows` if the burn cannot be found.
+	WatcherBurnByNonce(selector tx.Selector, nonce string) (WatcherBurn, error)
+
+	// WatcherNonceStatus returns the outcome of submitting the burn for the
+	// given selector with the given nonce, along with the hash of the
+	// transaction that was submitted for it. It returns an `sql.ErrNoRows` if
+	// the burn has not been submitted.
+	WatcherNonceStatus(selector tx.Selector, nonce string) (WatcherNonceStatus, string, error)
+
+	// UpdateWatcherNonceStatus stores the outcome of submitting the
+	// transaction with the given hash for the burn for the given selector with
+	// the given nonce.
+	UpdateWatcherNonceStatus(selector tx.Selector, nonce, hash string, status WatcherNonceStatus) error
+
+	// InsertWatcherDeadLetter stores a burn that cannot be submitted, or
+	// updates the error if it has already been stored.
+	InsertWatcherDeadLetter(letter WatcherDeadLetter) error
+
+	// WatcherDeadLetters returns the burns for the given selector that cannot
+	// be submitted.
+	WatcherDeadLetters(selector tx.Selector) ([]WatcherDeadLetter, error)
+
+	// InsertWatcherPendingNonces stores the nonces of burns for the given
+	// selector that could not be fetched yet, along with when they became
+	// pending. Nonces that are already pending keep their original time.
+	InsertWatcherPendingNonces(selector tx.Selector, nonces []uint64, since time.Time) error
+
+	// WatcherPendingNonces returns the pending nonces for the given selector,
+	// along with when they became pending.
+	WatcherPendingNonces(selector tx.Selector) (map[uint64]time.Time, error)
+
+	// DeleteWatcherPendingNonces removes the given pending nonces for the
+	// given selector.
+	DeleteWatcherPendingNonces(selector tx.Selector, nonces []uint64) error
+}
+
+// Peer is a Darknode that has been discovered by the Lightnode, along with
+// when it was last seen and its health when it was last persisted.
+type Peer struct {
+	Signatory string
+	Address   string
+	LastSeen  time.Time
+	Latency   time.Duration
+	Errors    float64
+}
+
+// MaxWatcherBlockHashes is the number of checkpoints of a watcher for which
+// the block hash is kept, which bounds how far back the watcher can find a
+// common ancestor after a reorg.
+const MaxWatcherBlockHashes = 32
+
+// WatcherBurn is a burn found by a watcher, along with the v0 and v1 hashes of
+// the transaction submitted for it, so that it can be queried using either.
+type WatcherBurn struct {
+	Selector tx.Selector
+	Nonce    string
+	V0Hash   string
+	V1Hash   string
+}
+
+// WatcherDeadLetter is a burn found by a watcher that cannot be submitted, for
+// example because its recipient cannot be decoded.
+type WatcherDeadLetter struct {
+	Selector  tx.Selector
+	Nonce     string
+	Txid      pack.Bytes
+	Amount    pack.U256
+	To        pack.Bytes
+	Error     string
+	CreatedAt time.Time
 }
 
 type database struct {
@@ -261,6 +383,55 @@ CREATE TABLE IF NOT EXISTS gateways (
 		ghash              VARCHAR,
 		version            VARCHAR
 );
+CREATE TABLE IF NOT EXISTS peers (
+		signatory          VARCHAR NOT NULL PRIMARY KEY,
+		address            VARCHAR,
+		last_seen          BIGINT,
+		latency            BIGINT,
+		errors             REAL
+);
+CREATE TABLE IF NOT EXISTS watcher_checkpoints (
+		selector           VARCHAR(255) NOT NULL PRIMARY KEY,
+		block_number       BIGINT,
+		updated_time       BIGINT
+);
+CREATE TABLE IF NOT EXISTS watcher_burns (
+		selector           VARCHAR(255) NOT NULL,
+		nonce              VARCHAR(100) NOT NULL,
+		v0_hash            VARCHAR,
+		v1_hash            VARCHAR,
+		PRIMARY KEY (selector, nonce)
+);
+CREATE TABLE IF NOT EXISTS watcher_block_hashes (
+		selector           VARCHAR(255) NOT NULL,
+		block_number       BIGINT NOT NULL,
+		hash               VARCHAR,
+		PRIMARY KEY (selector, block_number)
+);
+CREATE TABLE IF NOT EXISTS watcher_nonces (
+		selector           VARCHAR(255) NOT NULL,
+		nonce              VARCHAR(100) NOT NULL,
+		hash               VARCHAR,
+		status             SMALLINT,
+		updated_time       BIGINT,
+		PRIMARY KEY (selector, nonce)
+);
+CREATE TABLE IF NOT EXISTS watcher_dead_letters (
+		selector           VARCHAR(255) NOT NULL,
+		nonce              VARCHAR(100) NOT NULL,
+		txid               VARCHAR,
+		amount             VARCHAR(100),
+		to_address         VARCHAR,
+		error              VARCHAR,
+		created_time       BIGINT,
+		PRIMARY KEY (selector, nonce)
+);
+CREATE TABLE IF NOT EXISTS watcher_pending_nonces (
+		selector           VARCHAR(255) NOT NULL,
+		nonce              BIGINT NOT NULL,
+		since_time         BIGINT,
+		PRIMARY KEY (selector, nonce)
+);
 `
 	_, err := db.db.Exec(script)
 	return err
@@ -433,6 +604,290 @@ func (db database) Prune(expiry time.Duration) error {
 	return err
 }
 
+// InsertPeer implements the DB interface.
+func (db database) InsertPeer(peer Peer) error {
+	script := `INSERT INTO peers (signatory, address, last_seen, latency, errors) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (signatory) DO UPDATE SET address = excluded.address, last_seen = excluded.last_seen;`
+	_, err := db.db.Exec(script, peer.Signatory, peer.Address, peer.LastSeen.Unix(), peer.Latency.Milliseconds(), peer.Errors)
+	return err
+}
+
+// UpdatePeerHealth implements the DB interface.
+func (db database) UpdatePeerHealth(signatory string, latency time.Duration, errors float64) error {
+	_, err := db.db.Exec("UPDATE peers SET latency = $1, errors = $2 WHERE signatory = $3;", latency.Milliseconds(), errors, signatory)
+	return err
+}
+
+// Peers implements the DB interface.
+func (db database) Peers() ([]Peer, error) {
+	rows, err := db.db.Query(`SELECT signatory, address, last_seen, latency, errors FROM peers;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	peers := make([]Peer, 0)
+	for rows.Next() {
+		var peer Peer
+		var lastSeen, latency int64
+		if err := rows.Scan(&peer.Signatory, &peer.Address, &lastSeen, &latency, &peer.Errors); err != nil {
+			return nil, err
+		}
+		peer.LastSeen = time.Unix(lastSeen, 0)
+		peer.Latency = time.Duration(latency) * time.Millisecond
+		peers = append(peers, peer)
+	}
+	return peers, rows.Err()
+}
+
+// DeletePeer implements the DB interface.
+func (db database) DeletePeer(signatory string) error {
+	_, err := db.db.Exec("DELETE FROM peers WHERE signatory = $1;", signatory)
+	return err
+}
+
+// WatcherCheckpoint implements the DB interface.
+func (db database) WatcherCheckpoint(selector tx.Selector) (uint64, error) {
+	var block int64
+	if err := db.db.QueryRow("SELECT block_number FROM watcher_checkpoints WHERE selector = $1;", selector.String()).Scan(&block); err != nil {
+		return 0, err
+	}
+	return uint64(block), nil
+}
+
+// UpdateWatcherCheckpoint implements the DB interface.
+func (db database) UpdateWatcherCheckpoint(selector tx.Selector, block uint64, blockHash string, burns []WatcherBurn) error {
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	if err := insertWatcherBurns(sqlTx, burns); err != nil {
+		return err
+	}
+	script := `INSERT INTO watcher_checkpoints (selector, block_number, updated_time) VALUES ($1, $2, $3)
+		ON CONFLICT (selector) DO UPDATE SET block_number = excluded.block_number, updated_time = excluded.updated_time;`
+	if _, err := sqlTx.Exec(script, selector.String(), int64(block), time.Now().Unix()); err != nil {
+		return err
+	}
+
+	// The blocks after the checkpoint are scanned again, so their hashes are
+	// no longer valid.
+	if _, err := sqlTx.Exec("DELETE FROM watcher_block_hashes WHERE selector = $1 AND block_number > $2;", selector.String(), int64(block)); err != nil {
+		return err
+	}
+	if blockHash != "" {
+		script := `INSERT INTO watcher_block_hashes (selector, block_number, hash) VALUES ($1, $2, $3)
+			ON CONFLICT (selector, block_number) DO UPDATE SET hash = excluded.hash;`
+		if _, err := sqlTx.Exec(script, selector.String(), int64(block), blockHash); err != nil {
+			return err
+		}
+		script = `DELETE FROM watcher_block_hashes WHERE selector = $1 AND block_number NOT IN
+			(SELECT block_number FROM watcher_block_hashes WHERE selector = $1 ORDER BY block_number DESC LIMIT $2);`
+		if _, err := sqlTx.Exec(script, selector.String(), MaxWatcherBlockHashes); err != nil {
+			return err
+		}
+	}
+	return sqlTx.Commit()
+}
+
+// WatcherBlockHashes implements the DB interface.
+func (db database) WatcherBlockHashes(selector tx.Selector) (map[uint64]string, error) {
+	rows, err := db.db.Query("SELECT block_number, hash FROM watcher_block_hashes WHERE selector = $1;", selector.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := map[uint64]string{}
+	for rows.Next() {
+		var block int64
+		var hash string
+		if err := rows.Scan(&block, &hash); err != nil {
+			return nil, err
+		}
+		hashes[uint64(block)] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// InsertWatcherBurns implements the DB interface.
+func (db database) InsertWatcherBurns(burns []WatcherBurn) error {
+	if len(burns) == 0 {
+		return nil
+	}
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	if err := insertWatcherBurns(sqlTx, burns); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func insertWatcherBurns(sqlTx *sql.Tx, burns []WatcherBurn) error {
+	for _, burn := range burns {
+		script := `INSERT INTO watcher_burns (selector, nonce, v0_hash, v1_hash) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (selector, nonce) DO UPDATE SET v0_hash = excluded.v0_hash, v1_hash = excluded.v1_hash;`
+		if _, err := sqlTx.Exec(script, burn.Selector.String(), burn.Nonce, burn.V0Hash, burn.V1Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatcherBurnByV0Hash implements the DB interface.
+func (db database) WatcherBurnByV0Hash(v0Hash string) (WatcherBurn, error) {
+	row := db.db.QueryRow("SELECT selector, nonce, v0_hash, v1_hash FROM watcher_burns WHERE v0_hash = $1;", v0Hash)
+	return rowToWatcherBurn(row)
+}
+
+// WatcherBurnByNonce implements the DB interface.
+func (db database) WatcherBurnByNonce(selector tx.Selector, nonce string) (WatcherBurn, error) {
+	row := db.db.QueryRow("SELECT selector, nonce, v0_hash, v1_hash FROM watcher_burns WHERE selector = $1 AND nonce = $2;", selector.String(), nonce)
+	return rowToWatcherBurn(row)
+}
+
+// WatcherNonceStatus implements the DB interface.
+func (db database) WatcherNonceStatus(selector tx.Selector, nonce string) (WatcherNonceStatus, string, error) {
+	var status int
+	var hash string
+	if err := db.db.QueryRow("SELECT status, hash FROM watcher_nonces WHERE selector = $1 AND nonce = $2;", selector.String(), nonce).Scan(&status, &hash); err != nil {
+		return WatcherNonceStatusNil, "", err
+	}
+	return WatcherNonceStatus(status), hash, nil
+}
+
+// UpdateWatcherNonceStatus implements the DB interface.
+func (db database) UpdateWatcherNonceStatus(selector tx.Selector, nonce, hash string, status WatcherNonceStatus) error {
+	script := `INSERT INTO watcher_nonces (selector, nonce, hash, status, updated_time) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (selector, nonce) DO UPDATE SET hash = excluded.hash, status = excluded.status, updated_time = excluded.updated_time;`
+	_, err := db.db.Exec(script, selector.String(), nonce, hash, status, time.Now().Unix())
+	return err
+}
+
+// InsertWatcherDeadLetter implements the DB interface.
+func (db database) InsertWatcherDeadLetter(letter WatcherDeadLetter) error {
+	script := `INSERT INTO watcher_dead_letters (selector, nonce, txid, amount, to_address, error, created_time) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (selector, nonce) DO UPDATE SET error = excluded.error;`
+	_, err := db.db.Exec(script,
+		letter.Selector.String(),
+		letter.Nonce,
+		letter.Txid.String(),
+		letter.Amount.String(),
+		letter.To.String(),
+		letter.Error,
+		time.Now().Unix(),
+	)
+	return err
+}
+
+// WatcherDeadLetters implements the DB interface.
+func (db database) WatcherDeadLetters(selector tx.Selector) ([]WatcherDeadLetter, error) {
+	rows, err := db.db.Query(`SELECT selector, nonce, txid, amount, to_address, error, created_time FROM watcher_dead_letters
+		WHERE selector = $1 ORDER BY created_time ASC;`, selector.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []WatcherDeadLetter{}
+	for rows.Next() {
+		var letter WatcherDeadLetter
+		var selector, txidStr, amountStr, toStr string
+		var createdAt int64
+		if err := rows.Scan(&selector, &letter.Nonce, &txidStr, &amountStr, &toStr, &letter.Error, &createdAt); err != nil {
+			return nil, err
+		}
+		letter.Selector = tx.Selector(selector)
+		if letter.Txid, err = decodeBytes(txidStr); err != nil {
+			return nil, fmt.Errorf("decoding txid %v: %v", txidStr, err)
+		}
+		if letter.Amount, err = decodeU256(amountStr); err != nil {
+			return nil, fmt.Errorf("decoding amount %v: %v", amountStr, err)
+		}
+		if letter.To, err = decodeBytes(toStr); err != nil {
+			return nil, fmt.Errorf("decoding to %v: %v", toStr, err)
+		}
+		letter.CreatedAt = time.Unix(createdAt, 0)
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+// InsertWatcherPendingNonces implements the DB interface.
+func (db database) InsertWatcherPendingNonces(selector tx.Selector, nonces []uint64, since time.Time) error {
+	if len(nonces) == 0 {
+		return nil
+	}
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	for _, nonce := range nonces {
+		script := `INSERT INTO watcher_pending_nonces (selector, nonce, since_time) VALUES ($1, $2, $3)
+			ON CONFLICT (selector, nonce) DO NOTHING;`
+		if _, err := sqlTx.Exec(script, selector.String(), int64(nonce), since.Unix()); err != nil {
+			return err
+		}
+	}
+	return sqlTx.Commit()
+}
+
+// WatcherPendingNonces implements the DB interface.
+func (db database) WatcherPendingNonces(selector tx.Selector) (map[uint64]time.Time, error) {
+	rows, err := db.db.Query("SELECT nonce, since_time FROM watcher_pending_nonces WHERE selector = $1;", selector.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nonces := map[uint64]time.Time{}
+	for rows.Next() {
+		var nonce, since int64
+		if err := rows.Scan(&nonce, &since); err != nil {
+			return nil, err
+		}
+		nonces[uint64(nonce)] = time.Unix(since, 0)
+	}
+	return nonces, rows.Err()
+}
+
+// DeleteWatcherPendingNonces implements the DB interface.
+func (db database) DeleteWatcherPendingNonces(selector tx.Selector, nonces []uint64) error {
+	if len(nonces) == 0 {
+		return nil
+	}
+	sqlTx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	for _, nonce := range nonces {
+		if _, err := sqlTx.Exec("DELETE FROM watcher_pending_nonces WHERE selector = $1 AND nonce = $2;", selector.String(), int64(nonce)); err != nil {
+			return err
+		}
+	}
+	return sqlTx.Commit()
+}
+
+func rowToWatcherBurn(row Scannable) (WatcherBurn, error) {
+	var burn WatcherBurn
+	var selector string
+	if err := row.Scan(&selector, &burn.Nonce, &burn.V0Hash, &burn.V1Hash); err != nil {
+		return WatcherBurn{}, err
+	}
+	burn.Selector = tx.Selector(selector)
+	return burn, nil
+}
+
 func rowToTx(row Scannable) (tx.Tx, error) {
 	var hash, selector, txidStr, amountStr, payloadStr, phashStr, toStr, nonceStr, nhashStr, gpubkeyStr, ghashStr, version string
 	var txindex int
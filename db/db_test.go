@@ -2,6 +2,7 @@ package db_test
 
 import (
 	"database/sql"
+	"fmt"
 	"math/rand"
 	"os"
 	"testing/quick"
@@ -56,7 +57,7 @@ var _ = Describe("Lightnode db", func() {
 	}
 
 	cleanUp := func(db *sql.DB) {
-		dropTxs := "DROP TABLE IF EXISTS txs; DROP TABLE IF EXISTS gateways;"
+		dropTxs := "DROP TABLE IF EXISTS txs; DROP TABLE IF EXISTS gateways; DROP TABLE IF EXISTS peers; DROP TABLE IF EXISTS watcher_checkpoints; DROP TABLE IF EXISTS watcher_burns; DROP TABLE IF EXISTS watcher_block_hashes; DROP TABLE IF EXISTS watcher_nonces; DROP TABLE IF EXISTS watcher_dead_letters; DROP TABLE IF EXISTS watcher_pending_nonces;"
 		_, err := db.Exec(dropTxs)
 		Expect(err).NotTo(HaveOccurred())
 	}
@@ -86,11 +87,25 @@ var _ = Describe("Lightnode db", func() {
 					// Tables should not exist before creation.
 					Expect(CheckTableExistence(dbname, "txs", sqlDB)).Should(HaveOccurred())
 					Expect(CheckTableExistence(dbname, "gateways", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "peers", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_checkpoints", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_burns", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_block_hashes", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_nonces", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_dead_letters", sqlDB)).Should(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_pending_nonces", sqlDB)).Should(HaveOccurred())
 
 					// Tables should exist after creation.
 					Expect(db.Init()).To(Succeed())
 					Expect(CheckTableExistence(dbname, "txs", sqlDB)).NotTo(HaveOccurred())
 					Expect(CheckTableExistence(dbname, "gateways", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "peers", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_checkpoints", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_burns", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_block_hashes", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_nonces", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_dead_letters", sqlDB)).NotTo(HaveOccurred())
+					Expect(CheckTableExistence(dbname, "watcher_pending_nonces", sqlDB)).NotTo(HaveOccurred())
 
 					// Multiple calls of the creation function should not have
 					// any effect on the existing tables.
@@ -338,6 +353,180 @@ var _ = Describe("Lightnode db", func() {
 					Expect(quick.Check(test, &quick.Config{MaxCount: 10})).NotTo(HaveOccurred())
 				})
 			})
+
+			Context("when storing peers", func() {
+				It("should keep the health of a peer when it is seen again", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					peer := Peer{
+						Signatory: "signatory",
+						Address:   "/ip4/127.0.0.1/tcp/18514",
+						LastSeen:  time.Unix(time.Now().Unix()-60, 0),
+					}
+					Expect(db.InsertPeer(peer)).To(Succeed())
+					Expect(db.UpdatePeerHealth(peer.Signatory, 250*time.Millisecond, 0.5)).To(Succeed())
+
+					peer.Address = "/ip4/127.0.0.1/tcp/18516"
+					peer.LastSeen = time.Unix(time.Now().Unix(), 0)
+					Expect(db.InsertPeer(peer)).To(Succeed())
+
+					peers, err := db.Peers()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(peers).To(HaveLen(1))
+					Expect(peers[0].Address).To(Equal(peer.Address))
+					Expect(peers[0].LastSeen).To(Equal(peer.LastSeen))
+					Expect(peers[0].Latency).To(Equal(250 * time.Millisecond))
+					Expect(peers[0].Errors).To(Equal(0.5))
+
+					Expect(db.DeletePeer(peer.Signatory)).To(Succeed())
+					peers, err = db.Peers()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(peers).To(BeEmpty())
+				})
+			})
+
+			Context("when storing watcher checkpoints", func() {
+				It("should store the checkpoint along with the burns found", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					selector := tx.Selector("BTC/fromEthereum")
+					_, err := db.WatcherCheckpoint(selector)
+					Expect(err).To(Equal(sql.ErrNoRows))
+
+					burn := WatcherBurn{
+						Selector: selector,
+						Nonce:    "1",
+						V0Hash:   "v0hash",
+						V1Hash:   "v1hash",
+					}
+					Expect(db.UpdateWatcherCheckpoint(selector, 100, "", []WatcherBurn{burn})).To(Succeed())
+					Expect(db.UpdateWatcherCheckpoint(selector, 200, "", nil)).To(Succeed())
+
+					block, err := db.WatcherCheckpoint(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(block).To(Equal(uint64(200)))
+
+					stored, err := db.WatcherBurnByV0Hash(burn.V0Hash)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored).To(Equal(burn))
+					stored, err = db.WatcherBurnByNonce(selector, burn.Nonce)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(stored).To(Equal(burn))
+				})
+
+				It("should keep the hashes of the most recent checkpoints", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					selector := tx.Selector("BTC/fromEthereum")
+					for block := uint64(1); block <= MaxWatcherBlockHashes+10; block++ {
+						Expect(db.UpdateWatcherCheckpoint(selector, block, fmt.Sprintf("hash%v", block), nil)).To(Succeed())
+					}
+					hashes, err := db.WatcherBlockHashes(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hashes).To(HaveLen(MaxWatcherBlockHashes))
+					Expect(hashes).To(HaveKeyWithValue(uint64(MaxWatcherBlockHashes+10), fmt.Sprintf("hash%v", MaxWatcherBlockHashes+10)))
+					Expect(hashes).NotTo(HaveKey(uint64(10)))
+
+					// Rewinding the checkpoint removes the hashes of the
+					// blocks after it.
+					Expect(db.UpdateWatcherCheckpoint(selector, 30, "", nil)).To(Succeed())
+					hashes, err = db.WatcherBlockHashes(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hashes).To(HaveLen(20))
+					Expect(hashes).To(HaveKeyWithValue(uint64(30), "hash30"))
+
+					hashes, err = db.WatcherBlockHashes(tx.Selector("BTC/fromSolana"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(hashes).To(BeEmpty())
+				})
+			})
+
+			Context("when storing the outcome of burn submissions", func() {
+				It("should return the latest outcome for the nonce", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					selector := tx.Selector("BTC/fromEthereum")
+					_, _, err := db.WatcherNonceStatus(selector, "1")
+					Expect(err).To(Equal(sql.ErrNoRows))
+
+					Expect(db.UpdateWatcherNonceStatus(selector, "1", "hash1", WatcherNonceStatusRejected)).To(Succeed())
+					Expect(db.UpdateWatcherNonceStatus(selector, "1", "hash2", WatcherNonceStatusAccepted)).To(Succeed())
+					status, hash, err := db.WatcherNonceStatus(selector, "1")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(status).To(Equal(WatcherNonceStatusAccepted))
+					Expect(hash).To(Equal("hash2"))
+
+					_, _, err = db.WatcherNonceStatus(tx.Selector("BTC/fromSolana"), "1")
+					Expect(err).To(Equal(sql.ErrNoRows))
+				})
+
+				It("should store burns that cannot be submitted", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					selector := tx.Selector("BTC/fromEthereum")
+					letter := WatcherDeadLetter{
+						Selector: selector,
+						Nonce:    "1",
+						Txid:     pack.Bytes{1, 2, 3},
+						Amount:   pack.NewU256FromU64(1000),
+						To:       pack.Bytes("invalid"),
+						Error:    "invalid address",
+					}
+					Expect(db.InsertWatcherDeadLetter(letter)).To(Succeed())
+					Expect(db.InsertWatcherDeadLetter(letter)).To(Succeed())
+
+					letters, err := db.WatcherDeadLetters(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(letters).To(HaveLen(1))
+					Expect(letters[0].Nonce).To(Equal(letter.Nonce))
+					Expect(letters[0].Txid).To(Equal(letter.Txid))
+					Expect(letters[0].Amount).To(Equal(letter.Amount))
+					Expect(letters[0].To).To(Equal(letter.To))
+					Expect(letters[0].Error).To(Equal(letter.Error))
+				})
+
+				It("should keep when burns first became pending", func() {
+					sqlDB := init(dbname)
+					defer destroy(sqlDB)
+					db := New(sqlDB)
+					Expect(db.Init()).To(Succeed())
+
+					selector := tx.Selector("BTC/fromSolana")
+					since := time.Now().Add(-time.Hour)
+					Expect(db.InsertWatcherPendingNonces(selector, []uint64{1, 2}, since)).To(Succeed())
+					Expect(db.InsertWatcherPendingNonces(selector, []uint64{2, 3}, time.Now())).To(Succeed())
+
+					nonces, err := db.WatcherPendingNonces(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(nonces).To(HaveLen(3))
+					Expect(nonces[2].Unix()).To(Equal(since.Unix()))
+
+					Expect(db.DeleteWatcherPendingNonces(selector, []uint64{1, 2})).To(Succeed())
+					nonces, err = db.WatcherPendingNonces(selector)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(nonces).To(HaveLen(1))
+					Expect(nonces).To(HaveKey(uint64(3)))
+
+					nonces, err = db.WatcherPendingNonces(tx.Selector("BTC/fromEthereum"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(nonces).To(BeEmpty())
+				})
+			})
 		})
 	}
 })
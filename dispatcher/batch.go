@@ -0,0 +1,156 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/http"
+)
+
+// Enumerate default batching options. Batching is disabled by default, as
+// every request waits for the window before it is sent.
+var (
+	DefaultBatchWindow  = time.Duration(0)
+	DefaultMaxBatchSize = 10
+)
+
+type batchResult struct {
+	response jsonrpc.Response
+	latency  time.Duration
+	err      error
+}
+
+type batchCall struct {
+	ctx     context.Context
+	request jsonrpc.Request
+	result  chan batchResult
+}
+
+// pendingBatch is a batch of calls that is waiting for its window to end.
+type pendingBatch struct {
+	calls []batchCall
+}
+
+// batcher groups requests that are sent to the same Darknode within a short
+// window into a single JSON-RPC batch. The JSON-RPC server handles the
+// elements of a client batch concurrently, so they reach the dispatcher at
+// roughly the same time and are forwarded to each Darknode as one batch
+// instead of one round trip per element.
+type batcher struct {
+	client  http.Client
+	window  time.Duration
+	maxSize int
+
+	mu      *sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+func newBatcher(client http.Client, window time.Duration, maxSize int) *batcher {
+	return &batcher{
+		client:  client,
+		window:  window,
+		maxSize: maxSize,
+		mu:      new(sync.Mutex),
+		pending: map[string]*pendingBatch{},
+	}
+}
+
+// send queues the request to be sent to the given URL and waits for its
+// response. Requests are sent immediately if batching is disabled. It also
+// returns the latency of the request, which is measured from when it was
+// actually sent rather than from when it was queued.
+func (b *batcher) send(ctx context.Context, url string, request jsonrpc.Request) (jsonrpc.Response, time.Duration, error) {
+	if b.window <= 0 || b.maxSize <= 1 {
+		start := time.Now()
+		response, err := b.client.SendRequest(ctx, url, request, nil)
+		return response, time.Since(start), err
+	}
+
+	start := time.Now()
+	call := batchCall{
+		ctx:     ctx,
+		request: request,
+		result:  make(chan batchResult, 1),
+	}
+	b.mu.Lock()
+	batch, ok := b.pending[url]
+	if !ok {
+		batch = &pendingBatch{}
+		b.pending[url] = batch
+		time.AfterFunc(b.window, func() { b.flush(url, batch) })
+	}
+	batch.calls = append(batch.calls, call)
+	if len(batch.calls) >= b.maxSize {
+		delete(b.pending, url)
+		go b.sendBatch(url, batch.calls)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return jsonrpc.Response{}, time.Since(start), ctx.Err()
+	case result := <-call.result:
+		return result.response, result.latency, result.err
+	}
+}
+
+// flush sends the given batch of requests for the URL, unless it has already
+// been sent because it was full.
+func (b *batcher) flush(url string, batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending[url] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, url)
+	b.mu.Unlock()
+
+	b.sendBatch(url, batch.calls)
+}
+
+// sendBatch sends the calls to the given URL and fans the responses back out
+// to each call.
+func (b *batcher) sendBatch(url string, calls []batchCall) {
+	start := time.Now()
+	if len(calls) == 1 {
+		response, err := b.client.SendRequest(calls[0].ctx, url, calls[0].request, nil)
+		calls[0].result <- batchResult{response, time.Since(start), err}
+		return
+	}
+
+	// The IDs chosen by clients are not unique across requests, so they are
+	// replaced by the position of the request in the batch.
+	requests := make([]jsonrpc.Request, len(calls))
+	for i := range calls {
+		requests[i] = calls[i].request
+		requests[i].ID = i
+	}
+
+	// Only cancel the batch once every call in it has been cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for _, call := range calls {
+			select {
+			case <-ctx.Done():
+				return
+			case <-call.ctx.Done():
+			}
+		}
+		cancel()
+	}()
+
+	responses, err := b.client.SendBatch(ctx, url, requests)
+	latency := time.Since(start)
+	for i, call := range calls {
+		if err != nil {
+			call.result <- batchResult{jsonrpc.Response{}, latency, err}
+			continue
+		}
+		response := responses[i]
+		response.ID = call.request.ID
+		call.result <- batchResult{response, latency, nil}
+	}
+}
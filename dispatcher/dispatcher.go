@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/renproject/aw/wire"
@@ -24,17 +23,40 @@ import (
 // store so that the addresses of the known darkndoes are kept up to date.
 type Dispatcher struct {
 	logger     logrus.FieldLogger
-	client     http.Client
+	timeout    time.Duration
+	batcher    *batcher
+	endpoints  http.Endpoints
+	policies   Policies
 	multiStore store.MultiAddrStore
+	breakers   *http.Breakers
+	health     *HealthTracker
+	latency    *LatencyTracker
+	routing    *RoutingTable
 }
 
 // New constructs a new `Dispatcher`.
-func New(logger logrus.FieldLogger, timeout time.Duration, multiStore store.MultiAddrStore, opts phi.Options) phi.Task {
+func New(options Options, multiStore store.MultiAddrStore, breakers *http.Breakers, opts phi.Options) phi.Task {
+	for method, policy := range options.Policies {
+		if err := policy.Validate(); err != nil {
+			options.Logger.Panicf("[dispatcher] invalid policy for %v: %v", method, err)
+		}
+	}
+	health := options.Health
+	if health == nil {
+		health = NewHealthTracker(DefaultHealthDecay, DefaultHealthExploration)
+	}
 	return phi.New(
 		&Dispatcher{
-			logger:     logger,
-			client:     http.NewClient(timeout),
+			logger:     options.Logger,
+			timeout:    options.Timeout,
+			batcher:    newBatcher(options.Endpoints.NewClient(options.Timeout), options.BatchWindow, options.MaxBatchSize),
+			endpoints:  options.Endpoints,
+			policies:   options.Policies,
 			multiStore: multiStore,
+			breakers:   breakers,
+			health:     health,
+			routing:    options.Routing,
+			latency:    NewLatencyTracker(DefaultLatencySamples),
 		},
 		opts,
 	)
@@ -49,11 +71,12 @@ func (dispatcher *Dispatcher) Handle(_ phi.Task, message phi.Message) {
 
 	var addrs []wire.Address
 	var err error
+	policy := dispatcher.policies.Get(msg.Method)
 	id := msg.Query.Get("id")
 	if id != "" {
 		addrs, err = dispatcher.multiAddr(id)
 	} else {
-		addrs, err = dispatcher.multiAddrs(msg.Method)
+		addrs, err = dispatcher.multiAddrs(policy)
 	}
 	if err != nil {
 		dispatcher.logger.Errorf("[dispatcher] failed to send %v message to [%v], error getting multi-address: %v", msg.Method, id, err)
@@ -61,48 +84,186 @@ func (dispatcher *Dispatcher) Handle(_ phi.Task, message phi.Message) {
 		return
 	}
 
+	params, err := json.Marshal(msg.Params)
+	if err != nil {
+		dispatcher.logger.Errorf("[dispatcher] invalid params=%v: %v", msg.Params, err)
+		msg.RespondWithErr(jsonrpc.ErrorCodeInvalidParams, err)
+		return
+	}
+	req := jsonrpc.Request{
+		Version: "2.0",
+		ID:      msg.ID,
+		Method:  msg.Method,
+		Params:  params,
+	}
+
 	// Send the request to the darknodes and pipe the response to the iterator
-	ctx, cancel := context.WithCancel(msg.Context)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(msg.Context, policy.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(msg.Context)
+	}
+	// Every request has its own deadline and is not cancelled once the
+	// iterator has a response, so that Darknodes which are always slower than
+	// the others still count against their health and circuit breakers. It is
+	// only cancelled early if the client goes away.
+	timeout := policy.Timeout
+	if timeout == 0 {
+		timeout = dispatcher.timeout
+	}
+	var reqCtx context.Context
+	var reqCancel context.CancelFunc
+	if timeout > 0 {
+		reqCtx, reqCancel = context.WithTimeout(msg.Context, timeout)
+	} else {
+		reqCtx, reqCancel = context.WithCancel(msg.Context)
+	}
 	responses := make(chan jsonrpc.Response, len(addrs))
-	resIter := dispatcher.newResponseIter(msg.Method)
 
+	collector := newPeerResponses(len(addrs))
+	done := make(chan struct{})
+
+	var resIter Iterator
+	if policy.Iterator == IteratorHedged {
+		percentile := policy.Percentile
+		if percentile == 0 {
+			percentile = DefaultHedgePercentile
+		}
+		delay := dispatcher.latency.Percentile(msg.Method, percentile)
+		hedge := make(chan struct{}, len(addrs))
+		resIter = NewHedgedResponseIterator(hedge)
+		go func() {
+			dispatcher.sendHedged(ctx, reqCtx, req, addrs, delay, hedge, collector, responses)
+			reqCancel()
+			close(done)
+		}()
+	} else {
+		resIter = dispatcher.newResponseIter(policy)
+		go func() {
+			phi.ParForAll(addrs, func(i int) {
+				if response, ok := dispatcher.send(reqCtx, addrs[i], req, collector); ok {
+					responses <- response
+				}
+			})
+			reqCancel()
+			close(responses)
+			close(done)
+		}()
+	}
+
+	// Once every request has finished, check whether the Darknodes disagreed.
 	go func() {
-		phi.ParForAll(addrs, func(i int) {
-			addrParts := strings.Split(addrs[i].Value, ":")
-			if len(addrParts) != 2 {
-				dispatcher.logger.Errorf("[dispatcher] invalid address value=%v: %v", addrs[i].Value, err)
-				return
-			}
-			port, err := strconv.Atoi(addrParts[1])
-			if err != nil {
-				dispatcher.logger.Errorf("[dispatcher] invalid port=%v: %v", addrParts[1], err)
-				return
-			}
-			addrString := fmt.Sprintf("http://%s:%v", addrParts[0], port+1)
-			params, err := json.Marshal(msg.Params)
-			if err != nil {
-				dispatcher.logger.Errorf("[dispatcher] invalid params=%v: %v", msg.Params, err)
+		<-done
+		dispatcher.checkDivergence(msg.Method, collector.all())
+	}()
+
+	// Admin callers can ask for the response of every Darknode, in which case
+	// the iterator must not cancel the remaining requests.
+	debug := msg.Query.Get(http.QueryKeyDebug) == http.DebugPeers
+	iterCancel := cancel
+	if debug {
+		iterCancel = func() {}
+	}
+
+	go func() {
+		response := resIter.Collect(msg.ID, iterCancel, responses)
+		if debug {
+			<-done
+			cancel()
+			response = jsonrpc.NewResponse(msg.ID, DebugResult{
+				Result: response.Result,
+				Error:  response.Error,
+				Peers:  collector.all(),
+			}, nil)
+		}
+		msg.Responder <- response
+	}()
+}
+
+// send sends the request to the given Darknode and records the outcome. It
+// returns false if no response was received.
+func (dispatcher *Dispatcher) send(ctx context.Context, addr wire.Address, req jsonrpc.Request, collector *peerResponses) (jsonrpc.Response, bool) {
+	addrString, err := dispatcher.endpoints.URL(addr)
+	if err != nil {
+		dispatcher.logger.Errorf("[dispatcher] %v", err)
+		return jsonrpc.Response{}, false
+	}
+
+	if !dispatcher.breakers.Allow(addr.Value) {
+		dispatcher.logger.Debugf("[dispatcher] skipping peer=%v with open circuit breaker", addr.Value)
+		return jsonrpc.Response{}, false
+	}
+	response, latency, err := dispatcher.batcher.send(ctx, addrString, req)
+
+	switch {
+	case err == nil || ctx.Err() == nil:
+		dispatcher.health.Observe(addr, latency, err)
+		dispatcher.breakers.Record(addr.Value, err)
+	case ctx.Err() == context.DeadlineExceeded:
+		// The Darknode did not respond in time, which counts against its
+		// health as much as an error does.
+		dispatcher.health.Observe(addr, latency, ctx.Err())
+		dispatcher.breakers.Record(addr.Value, ctx.Err())
+	default:
+		// The request was cancelled because the client went away. The
+		// Darknode is at least as slow as the time it was given, which is
+		// only recorded if it was given long enough.
+		dispatcher.health.ObserveCensored(addr, latency)
+		dispatcher.breakers.Release(addr.Value)
+	}
+	if err != nil {
+		dispatcher.logger.Errorf("[dispatcher] sending request: %v", err)
+		return jsonrpc.Response{}, false
+	}
+	if response.Error == nil {
+		dispatcher.latency.Observe(req.Method, latency)
+	}
+	collector.add(addr, response)
+	return response, true
+}
+
+// sendHedged sends the request to the given Darknodes one at a time, in order.
+// The request is only sent to the next Darknode if no response has arrived
+// within the delay, or if the previous request failed. Once the iterator has a
+// successful response it cancels the context and no more requests are sent,
+// but the requests that were already sent run until the request context is
+// done.
+func (dispatcher *Dispatcher) sendHedged(ctx, reqCtx context.Context, req jsonrpc.Request, addrs []wire.Address, delay time.Duration, hedge chan struct{}, collector *peerResponses, responses chan<- jsonrpc.Response) {
+	wg := new(sync.WaitGroup)
+	defer func() {
+		wg.Wait()
+		close(responses)
+	}()
+
+	for i := range addrs {
+		if i > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
 				return
+			case <-hedge:
+			case <-timer.C:
 			}
-			req := jsonrpc.Request{
-				Version: "2.0",
-				ID:      msg.ID,
-				Method:  msg.Method,
-				Params:  params,
-			}
-			response, err := dispatcher.client.SendRequest(ctx, addrString, req, nil)
-			if err != nil {
-				dispatcher.logger.Errorf("[dispatcher] sending request: %v", err)
+			timer.Stop()
+		}
+
+		wg.Add(1)
+		go func(addr wire.Address) {
+			defer wg.Done()
+			response, ok := dispatcher.send(reqCtx, addr, req, collector)
+			if !ok {
+				select {
+				case hedge <- struct{}{}:
+				default:
+				}
 				return
 			}
 			responses <- response
-		})
-		close(responses)
-	}()
-
-	go func() {
-		msg.Responder <- resIter.Collect(msg.ID, cancel, responses)
-	}()
+		}(addrs[i])
+	}
 }
 
 // multiAddrs returns the multi-address for the given Darknode ID.
@@ -115,25 +276,71 @@ func (dispatcher *Dispatcher) multiAddr(darknodeID string) ([]wire.Address, erro
 }
 
 // multiAddrs returns the multi-addresses for the Darknodes based on the given
-// method.
-func (dispatcher *Dispatcher) multiAddrs(method string) ([]wire.Address, error) {
-	switch method {
-	case jsonrpc.MethodSubmitTx:
-		return dispatcher.multiStore.RandomBootstrapAddrs(3)
-	case jsonrpc.MethodQueryTx:
-		return dispatcher.multiStore.BootstrapAll()
-	case jsonrpc.MethodQueryStat:
-		return dispatcher.multiStore.RandomAddrs(3)
+// policy. Healthier Darknodes are preferred over less healthy ones.
+func (dispatcher *Dispatcher) multiAddrs(policy Policy) ([]wire.Address, error) {
+	var addrs []wire.Address
+	var err error
+	switch policy.Peers {
+	case PeerSetAll:
+		addrs, err = dispatcher.multiStore.AddrsAll()
+	case PeerSetShard:
+		addrs = dispatcher.shardAddrs()
+		if len(addrs) == 0 || len(addrs) < policy.Fanout {
+			// Requests for a shard are sent to the Bootstrap nodes until
+			// enough members of the shard are known.
+			addrs, err = dispatcher.multiStore.BootstrapAll()
+		}
 	default:
-		return dispatcher.multiStore.RandomBootstrapAddrs(5)
+		addrs, err = dispatcher.multiStore.BootstrapAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip Darknodes whose circuit breakers are open.
+	available := make([]wire.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		if dispatcher.breakers.Available(addr.Value) {
+			available = append(available, addr)
+		}
+	}
+	if len(available) == 0 && len(addrs) > 0 {
+		return nil, fmt.Errorf("circuit breakers open for all %v darknodes", len(addrs))
+	}
+	addrs = available
+
+	n := policy.Fanout
+	if n == 0 {
+		n = len(addrs)
+	}
+	return dispatcher.health.Select(addrs, n), nil
+}
+
+// shardAddrs returns the multi-addresses of the known members of the shard
+// responsible for transactions.
+func (dispatcher *Dispatcher) shardAddrs() []wire.Address {
+	if dispatcher.routing == nil {
+		return nil
+	}
+	members := dispatcher.routing.Members()
+	addrs := make([]wire.Address, 0, len(members))
+	for _, member := range members {
+		addr, err := dispatcher.multiStore.Get(member)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
 	}
+	return addrs
 }
 
-// newResponseIter returns the iterator type for the given method.
-func (dispatcher *Dispatcher) newResponseIter(method string) Iterator {
-	switch method {
-	case jsonrpc.MethodQueryTx:
+// newResponseIter returns the iterator type for the given policy.
+func (dispatcher *Dispatcher) newResponseIter(policy Policy) Iterator {
+	switch policy.Iterator {
+	case IteratorMajority:
 		return NewMajorityResponseIterator(dispatcher.logger)
+	case IteratorQuorum:
+		return NewQuorumResponseIterator(policy.Quorum)
 	default:
 		return NewFirstResponseIterator()
 	}
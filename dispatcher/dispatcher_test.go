@@ -2,8 +2,12 @@ package dispatcher_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -13,10 +17,12 @@ import (
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
+	"github.com/renproject/id"
 	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/dispatcher"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/store"
+	"github.com/renproject/pack"
 	"github.com/renproject/phi"
 	"github.com/sirupsen/logrus"
 )
@@ -26,7 +32,14 @@ func initDispatcher(ctx context.Context, bootstrapAddrs []wire.Address, timeout
 	logger := logrus.New()
 	table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
 	multiStore := store.New(table, bootstrapAddrs)
-	dispatcher := dispatcher.New(logger, timeout, multiStore, opts)
+	dispatcher := dispatcher.New(
+		dispatcher.DefaultOptions().
+			WithLogger(logger).
+			WithTimeout(timeout),
+		multiStore,
+		http.NewBreakers(logger, http.DefaultBreakerOptions),
+		opts,
+	)
 
 	go dispatcher.Run(ctx)
 
@@ -46,6 +59,48 @@ func initDarknodes(ctx context.Context, n int) []*MockDarknode {
 	return dns
 }
 
+// initPeers starts a JSON-RPC server for every handler and returns the
+// addresses of the servers along with the endpoints used to reach them.
+func initPeers(handlers []nethttp.HandlerFunc) ([]wire.Address, http.Endpoints, func()) {
+	addrs := make([]wire.Address, len(handlers))
+	servers := make([]*httptest.Server, len(handlers))
+	urls := map[string]string{}
+	for i, handler := range handlers {
+		servers[i] = httptest.NewServer(handler)
+		addrs[i] = wire.NewUnsignedAddress(wire.TCP, fmt.Sprintf("127.0.0.1:%v", 4444+i), uint64(time.Now().Unix()))
+		Expect(addrs[i].Sign(id.NewPrivKey())).To(Succeed())
+		urls[addrs[i].Value] = servers[i].URL
+	}
+	endpoints, err := http.NewEndpoints(http.EndpointOptions{URLs: urls})
+	Expect(err).ToNot(HaveOccurred())
+	return addrs, endpoints, func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+// okHandler responds to every request with the same result.
+func okHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
+	var req jsonrpc.Request
+	Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+	Expect(json.NewEncoder(w).Encode(jsonrpc.NewResponse(req.ID, map[string]string{"status": "ok"}, nil))).To(Succeed())
+}
+
+// countingHandler responds to every request with the same result and counts
+// the requests it has received.
+func countingHandler(count *int64) nethttp.HandlerFunc {
+	return func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		atomic.AddInt64(count, 1)
+		okHandler(w, r)
+	}
+}
+
+// hangingHandler never responds until the request is cancelled.
+func hangingHandler(w nethttp.ResponseWriter, r *nethttp.Request) {
+	<-r.Context().Done()
+}
+
 var _ = Describe("Dispatcher", func() {
 	Context("When running", func() {
 		It("Should send valid requests to the darknodes based on their policy", func() {
@@ -69,5 +124,173 @@ var _ = Describe("Dispatcher", func() {
 				Expect(response.Error).Should(BeNil())
 			}
 		})
+
+		It("Should return the response of every darknode when debugging", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			darknodes := initDarknodes(ctx, 13)
+			multis := make([]wire.Address, 13)
+			for i := range multis {
+				multis[i] = darknodes[i].Me
+			}
+			sender := initDispatcher(ctx, multis, time.Second)
+
+			id, params := ValidRequest(jsonrpc.MethodQueryBlock)
+			query := url.Values{}
+			query.Set(http.QueryKeyDebug, http.DebugPeers)
+			req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlock, params, query)
+			Expect(sender.Send(req)).To(BeTrue())
+
+			var response jsonrpc.Response
+			Eventually(req.Responder, 5*time.Second).Should(Receive(&response))
+			Expect(response.Error).Should(BeNil())
+			result, ok := response.Result.(dispatcher.DebugResult)
+			Expect(ok).To(BeTrue())
+			Expect(result.Error).Should(BeNil())
+			Expect(result.Peers).NotTo(BeEmpty())
+			Expect(len(result.Peers)).To(BeNumerically("<=", dispatcher.DefaultPolicies.Get(jsonrpc.MethodQueryBlock).Fanout))
+		})
+
+		It("Should route shard requests to the members of the shard once enough are known", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			counts := make([]int64, 5)
+			handlers := make([]nethttp.HandlerFunc, len(counts))
+			for i := range handlers {
+				handlers[i] = countingHandler(&counts[i])
+			}
+			addrs, endpoints, closePeers := initPeers(handlers)
+			defer closePeers()
+
+			// The first two darknodes are Bootstrap nodes and the others are
+			// members of the shard.
+			logger := logrus.New()
+			multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), addrs[:2])
+			for _, addr := range addrs[2:] {
+				Expect(multiStore.Insert(addr)).To(Succeed())
+			}
+			routing := dispatcher.NewRoutingTable()
+			sender := dispatcher.New(
+				dispatcher.DefaultOptions().
+					WithLogger(logger).
+					WithTimeout(time.Second).
+					WithEndpoints(endpoints).
+					WithBatchWindow(0).
+					WithRouting(routing).
+					WithPolicies(dispatcher.DefaultPolicies.With(dispatcher.Policies{
+						jsonrpc.MethodQueryTx: {
+							Peers:    dispatcher.PeerSetShard,
+							Fanout:   3,
+							Iterator: dispatcher.IteratorFirst,
+						},
+					})),
+				multiStore,
+				http.NewBreakers(logger, http.DefaultBreakerOptions),
+				phi.Options{Cap: 10},
+			)
+			go sender.Run(ctx)
+
+			sendRequest := func() {
+				id, params := ValidRequest(jsonrpc.MethodQueryTx)
+				req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryTx, params, url.Values{})
+				Expect(sender.Send(req)).To(BeTrue())
+
+				var response jsonrpc.Response
+				Eventually(req.Responder).Should(Receive(&response))
+				Expect(response.Error).Should(BeNil())
+			}
+			updateMembers := func(epoch byte, members []wire.Address) {
+				nodes := make([]map[string]interface{}, len(members))
+				for i, member := range members {
+					signatory, err := member.Signatory()
+					Expect(err).ToNot(HaveOccurred())
+					nodes[i] = map[string]interface{}{"signatory": signatory}
+				}
+				data, err := json.Marshal(nodes)
+				Expect(err).ToNot(HaveOccurred())
+
+				system := MockSystemState()
+				system.Epoch.Hash = pack.Bytes32{epoch}
+				Expect(json.Unmarshal(data, &system.Nodes)).To(Succeed())
+				changed, err := routing.Update(system)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(changed).To(BeTrue())
+				Expect(routing.Members()).To(HaveLen(len(members)))
+			}
+			memberRequests := func() int64 {
+				return atomic.LoadInt64(&counts[2]) + atomic.LoadInt64(&counts[3]) + atomic.LoadInt64(&counts[4])
+			}
+			bootstrapRequests := func() int64 {
+				return atomic.LoadInt64(&counts[0]) + atomic.LoadInt64(&counts[1])
+			}
+
+			// Fewer members than the fanout are known, so the request is sent
+			// to the Bootstrap nodes.
+			updateMembers(1, addrs[2:4])
+			sendRequest()
+			Eventually(bootstrapRequests).Should(BeNumerically(">", 0))
+			Expect(memberRequests()).To(BeZero())
+
+			// Once enough members are known, only they are sent the request.
+			before := bootstrapRequests()
+			updateMembers(2, addrs[2:])
+			sendRequest()
+			Eventually(memberRequests).Should(Equal(int64(3)))
+			Consistently(bootstrapRequests, 100*time.Millisecond).Should(Equal(before))
+		})
+
+		It("Should open the circuit breaker of a darknode that never responds in time", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			addrs, endpoints, closePeers := initPeers([]nethttp.HandlerFunc{okHandler, okHandler, hangingHandler})
+			defer closePeers()
+
+			logger := logrus.New()
+			breakers := http.NewBreakers(logger, http.BreakerOptions{FailureThreshold: 2, Cooldown: time.Minute})
+			health := dispatcher.NewHealthTracker(dispatcher.DefaultHealthDecay, 0)
+			multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), addrs)
+			sender := dispatcher.New(
+				dispatcher.DefaultOptions().
+					WithLogger(logger).
+					WithTimeout(time.Second).
+					WithEndpoints(endpoints).
+					WithBatchWindow(0).
+					WithHealth(health).
+					WithPolicies(dispatcher.DefaultPolicies.With(dispatcher.Policies{
+						jsonrpc.MethodQueryBlock: {
+							Peers:    dispatcher.PeerSetBootstrap,
+							Iterator: dispatcher.IteratorMajority,
+							Timeout:  200 * time.Millisecond,
+						},
+					})),
+				multiStore,
+				breakers,
+				phi.Options{Cap: 10},
+			)
+			go sender.Run(ctx)
+
+			// The majority responds without the hanging darknode, but its
+			// request still runs until it times out.
+			for i := 0; i < 2; i++ {
+				id, params := ValidRequest(jsonrpc.MethodQueryBlock)
+				req := http.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryBlock, params, url.Values{})
+				Expect(sender.Send(req)).To(BeTrue())
+
+				var response jsonrpc.Response
+				Eventually(req.Responder).Should(Receive(&response))
+				Expect(response.Error).Should(BeNil())
+				Eventually(func() uint64 {
+					return health.Health(addrs[2]).Samples
+				}).Should(Equal(uint64(i + 1)))
+			}
+
+			Expect(breakers.State(addrs[2].Value)).To(Equal(http.BreakerOpen))
+			Expect(breakers.State(addrs[0].Value)).To(Equal(http.BreakerClosed))
+			Expect(health.Health(addrs[2]).Errors).To(BeNumerically(">", 0))
+			Expect(health.Health(addrs[2]).Score()).To(BeNumerically(">", health.Health(addrs[0]).Score()))
+		})
 	})
 })
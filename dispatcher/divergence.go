@@ -0,0 +1,194 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+// divergences counts the number of requests, per method, for which the
+// Darknodes returned different successful responses.
+var divergences = expvar.NewMap("dispatcher_divergences")
+
+// maxDiffValueLen is the maximum length of a value included in a diff.
+const maxDiffValueLen = 128
+
+// PeerResponse is the response returned by a single Darknode.
+type PeerResponse struct {
+	Peer     string           `json:"peer"`
+	Address  string           `json:"address"`
+	Response jsonrpc.Response `json:"response"`
+}
+
+// DebugResult is the result returned to admin callers that request the full
+// per-peer breakdown of a response.
+type DebugResult struct {
+	Result interface{}    `json:"result,omitempty"`
+	Error  *jsonrpc.Error `json:"error,omitempty"`
+	Peers  []PeerResponse `json:"peers"`
+}
+
+// peerResponses collects the responses returned by each Darknode for a single
+// request. It is safe for concurrent use.
+type peerResponses struct {
+	mu        *sync.Mutex
+	responses []PeerResponse
+}
+
+func newPeerResponses(capacity int) *peerResponses {
+	return &peerResponses{
+		mu:        new(sync.Mutex),
+		responses: make([]PeerResponse, 0, capacity),
+	}
+}
+
+func (collector *peerResponses) add(addr wire.Address, response jsonrpc.Response) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	collector.responses = append(collector.responses, PeerResponse{
+		Peer:     peerKey(addr),
+		Address:  addr.Value,
+		Response: response,
+	})
+}
+
+func (collector *peerResponses) all() []PeerResponse {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	responses := make([]PeerResponse, len(collector.responses))
+	copy(responses, collector.responses)
+	return responses
+}
+
+// groupResponses groups the successful responses by their result, from the
+// largest group to the smallest. Error responses are ignored as they are
+// usually caused by Darknodes lagging behind rather than disagreeing.
+func groupResponses(responses []PeerResponse) [][]PeerResponse {
+	groups := [][]PeerResponse{}
+	for _, response := range responses {
+		if response.Response.Error != nil {
+			continue
+		}
+		found := false
+		for i := range groups {
+			if reflect.DeepEqual(groups[i][0].Response.Result, response.Response.Result) {
+				groups[i] = append(groups[i], response)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []PeerResponse{response})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i]) > len(groups[j])
+	})
+	return groups
+}
+
+// checkDivergence reports any disagreement between the successful responses
+// returned by the Darknodes for a request.
+func (dispatcher *Dispatcher) checkDivergence(method string, responses []PeerResponse) {
+	groups := groupResponses(responses)
+	if len(groups) < 2 {
+		return
+	}
+	divergences.Add(method, 1)
+
+	majority := groups[0]
+	for _, minority := range groups[1:] {
+		diff, err := diffResults(majority[0].Response.Result, minority[0].Response.Result)
+		if err != nil {
+			diff = []string{fmt.Sprintf("cannot diff results: %v", err)}
+		}
+		dispatcher.logger.Errorf("[dispatcher] darknodes diverged on %v: majority=%v minority=%v diff=[%v]", method, peers(majority), peers(minority), strings.Join(diff, "; "))
+	}
+}
+
+// peers returns the identifiers of the Darknodes that returned the responses.
+func peers(responses []PeerResponse) []string {
+	ids := make([]string, len(responses))
+	for i := range responses {
+		ids[i] = responses[i].Peer
+	}
+	return ids
+}
+
+// diffResults returns the JSON paths at which the two results differ, along
+// with the differing values.
+func diffResults(a, b interface{}) ([]string, error) {
+	var aValue, bValue interface{}
+	if err := remarshal(a, &aValue); err != nil {
+		return nil, err
+	}
+	if err := remarshal(b, &bValue); err != nil {
+		return nil, err
+	}
+	diff := []string{}
+	diffValues("result", aValue, bValue, &diff)
+	return diff, nil
+}
+
+func remarshal(value interface{}, dst *interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func diffValues(path string, a, b interface{}, diff *[]string) {
+	switch aValue := a.(type) {
+	case map[string]interface{}:
+		bValue, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := map[string]struct{}{}
+		for key := range aValue {
+			keys[key] = struct{}{}
+		}
+		for key := range bValue {
+			keys[key] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diffValues(path+"."+key, aValue[key], bValue[key], diff)
+		}
+		return
+	case []interface{}:
+		bValue, ok := b.([]interface{})
+		if !ok || len(aValue) != len(bValue) {
+			break
+		}
+		for i := range aValue {
+			diffValues(fmt.Sprintf("%v[%v]", path, i), aValue[i], bValue[i], diff)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*diff = append(*diff, fmt.Sprintf("%v: %v != %v", path, truncate(a), truncate(b)))
+	}
+}
+
+func truncate(value interface{}) string {
+	str := fmt.Sprintf("%v", value)
+	if len(str) > maxDiffValueLen {
+		return str[:maxDiffValueLen] + "..."
+	}
+	return str
+}
@@ -0,0 +1,193 @@
+package dispatcher
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/renproject/aw/wire"
+)
+
+// Enumerate default health tracking parameters.
+var (
+	// DefaultHealthDecay is the weight given to the most recent observation
+	// when updating the rolling latency and error scores of a peer.
+	DefaultHealthDecay = 0.2
+
+	// DefaultHealthExploration is the probability with which a less healthy
+	// peer is selected in place of a healthier one, so that peers which have
+	// recovered are eventually used again.
+	DefaultHealthExploration = 0.1
+
+	// DefaultErrorPenalty is the latency (in seconds) that a peer which
+	// always fails is considered to have. It is scaled by the error score of
+	// the peer.
+	DefaultErrorPenalty = 30.0
+)
+
+// PeerHealth is the rolling health score of a Darknode.
+type PeerHealth struct {
+	Latency time.Duration `json:"latency"`
+	Errors  float64       `json:"errors"`
+	Samples uint64        `json:"samples"`
+}
+
+// Score returns a single value representing the health of the peer. Lower
+// values are better. Peers that have never been observed have a score of zero
+// so that they are tried optimistically.
+func (health PeerHealth) Score() float64 {
+	return health.Latency.Seconds() + health.Errors*DefaultErrorPenalty
+}
+
+// HealthTracker keeps a rolling latency and error score for every Darknode it
+// has sent requests to, and uses these scores to prefer healthy Darknodes when
+// selecting which ones to send requests to. It is safe for concurrent use.
+type HealthTracker struct {
+	mu          *sync.RWMutex
+	decay       float64
+	exploration float64
+	peers       map[string]PeerHealth
+}
+
+// NewHealthTracker returns a new `HealthTracker`. The decay is the weight
+// given to new observations and the exploration is the probability of
+// selecting a random peer instead of the healthiest remaining one.
+func NewHealthTracker(decay, exploration float64) *HealthTracker {
+	return &HealthTracker{
+		mu:          new(sync.RWMutex),
+		decay:       decay,
+		exploration: exploration,
+		peers:       map[string]PeerHealth{},
+	}
+}
+
+// Observe records the outcome of a request sent to the given address.
+func (tracker *HealthTracker) Observe(addr wire.Address, latency time.Duration, err error) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	errValue := 0.0
+	if err != nil {
+		errValue = 1.0
+	}
+
+	key := peerKey(addr)
+	health, ok := tracker.peers[key]
+	if !ok {
+		tracker.peers[key] = PeerHealth{
+			Latency: latency,
+			Errors:  errValue,
+			Samples: 1,
+		}
+		return
+	}
+	health.Latency = time.Duration((1-tracker.decay)*float64(health.Latency) + tracker.decay*float64(latency))
+	health.Errors = (1-tracker.decay)*health.Errors + tracker.decay*errValue
+	health.Samples++
+	tracker.peers[key] = health
+}
+
+// ObserveCensored records a request to the given address that was cancelled
+// before it finished. The latency of the peer is at least the time the request
+// had been running for, so it is only recorded if it is longer than the
+// latency the peer is known to have. Requests that were cancelled earlier say
+// nothing about the peer and are skipped.
+func (tracker *HealthTracker) ObserveCensored(addr wire.Address, elapsed time.Duration) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	key := peerKey(addr)
+	health, ok := tracker.peers[key]
+	if !ok {
+		tracker.peers[key] = PeerHealth{
+			Latency: elapsed,
+			Samples: 1,
+		}
+		return
+	}
+	if elapsed <= health.Latency {
+		return
+	}
+	health.Latency = time.Duration((1-tracker.decay)*float64(health.Latency) + tracker.decay*float64(elapsed))
+	health.Samples++
+	tracker.peers[key] = health
+}
+
+// Health returns the current health of the given address.
+func (tracker *HealthTracker) Health(addr wire.Address) PeerHealth {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+
+	return tracker.peers[peerKey(addr)]
+}
+
+// Restore sets the health of the peer with the given key, for example when
+// reloading the health of peers after a restart.
+func (tracker *HealthTracker) Restore(key string, health PeerHealth) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.peers[key] = health
+}
+
+// Snapshot returns the current health of every peer that has been observed,
+// keyed by the same key used by the `store.MultiAddrStore`.
+func (tracker *HealthTracker) Snapshot() map[string]PeerHealth {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+
+	snapshot := make(map[string]PeerHealth, len(tracker.peers))
+	for key, health := range tracker.peers {
+		snapshot[key] = health
+	}
+	return snapshot
+}
+
+// Select returns up to n of the given addresses, ordered from healthiest to
+// least healthy. With probability equal to the exploration rate, each
+// position is instead filled by a random address from the remaining ones.
+func (tracker *HealthTracker) Select(addrs []wire.Address, n int) []wire.Address {
+	if n > len(addrs) {
+		n = len(addrs)
+	}
+
+	// Shuffle before sorting so that peers with equal scores are selected
+	// uniformly at random.
+	selected := make([]wire.Address, len(addrs))
+	copy(selected, addrs)
+	rand.Shuffle(len(selected), func(i, j int) {
+		selected[i], selected[j] = selected[j], selected[i]
+	})
+
+	tracker.mu.RLock()
+	scores := make(map[string]float64, len(selected))
+	for _, addr := range selected {
+		scores[addr.String()] = tracker.peers[peerKey(addr)].Score()
+	}
+	tracker.mu.RUnlock()
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return scores[selected[i].String()] < scores[selected[j].String()]
+	})
+
+	for i := 0; i < n; i++ {
+		if rand.Float64() >= tracker.exploration || i == len(selected)-1 {
+			continue
+		}
+		j := i + 1 + rand.Intn(len(selected)-i-1)
+		selected[i], selected[j] = selected[j], selected[i]
+	}
+	return selected[:n]
+}
+
+// peerKey returns the key used to identify the given address. Addresses are
+// identified by their signatory where possible, which is consistent with the
+// `store.MultiAddrStore`.
+func peerKey(addr wire.Address) string {
+	signatory, err := addr.Signatory()
+	if err != nil {
+		return addr.Value
+	}
+	return signatory.String()
+}
@@ -0,0 +1,94 @@
+package dispatcher_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
+)
+
+var _ = Describe("Health tracker", func() {
+	randomAddrs := func(n int) []wire.Address {
+		addrs := make([]wire.Address, n)
+		for i := range addrs {
+			addrs[i] = wire.NewUnsignedAddress(wire.TCP, fmt.Sprintf("127.0.0.1:%v", 18515+i), uint64(time.Now().Unix()))
+			Expect(addrs[i].Sign(id.NewPrivKey())).To(Succeed())
+		}
+		return addrs
+	}
+
+	Context("when selecting peers", func() {
+		It("should prefer healthy peers over slow or failing ones", func() {
+			tracker := NewHealthTracker(DefaultHealthDecay, 0)
+			addrs := randomAddrs(5)
+			tracker.Observe(addrs[0], 2*time.Second, nil)
+			tracker.Observe(addrs[1], 10*time.Millisecond, errors.New("connection refused"))
+			tracker.Observe(addrs[2], 50*time.Millisecond, nil)
+			tracker.Observe(addrs[3], 20*time.Millisecond, nil)
+			tracker.Observe(addrs[4], time.Second, nil)
+
+			selected := tracker.Select(addrs, 3)
+			Expect(selected).To(Equal([]wire.Address{addrs[3], addrs[2], addrs[4]}))
+		})
+
+		It("should never return more peers than available", func() {
+			tracker := NewHealthTracker(DefaultHealthDecay, DefaultHealthExploration)
+			addrs := randomAddrs(3)
+			Expect(tracker.Select(addrs, 5)).To(HaveLen(3))
+			Expect(tracker.Select(addrs, 2)).To(HaveLen(2))
+		})
+
+		It("should eventually select unhealthy peers when exploring", func() {
+			tracker := NewHealthTracker(DefaultHealthDecay, 0.5)
+			addrs := randomAddrs(2)
+			tracker.Observe(addrs[0], 10*time.Millisecond, nil)
+			tracker.Observe(addrs[1], 10*time.Millisecond, errors.New("timeout"))
+
+			explored := false
+			for i := 0; i < 100; i++ {
+				if tracker.Select(addrs, 1)[0].String() == addrs[1].String() {
+					explored = true
+					break
+				}
+			}
+			Expect(explored).To(BeTrue())
+		})
+	})
+
+	Context("when observing responses", func() {
+		It("should recover the score of a peer once it succeeds again", func() {
+			tracker := NewHealthTracker(DefaultHealthDecay, 0)
+			addr := randomAddrs(1)[0]
+			tracker.Observe(addr, time.Second, errors.New("timeout"))
+			before := tracker.Health(addr).Score()
+			for i := 0; i < 10; i++ {
+				tracker.Observe(addr, 10*time.Millisecond, nil)
+			}
+			Expect(tracker.Health(addr).Score()).To(BeNumerically("<", before))
+			Expect(tracker.Health(addr).Samples).To(Equal(uint64(11)))
+		})
+
+		It("should only record cancelled requests that ran longer than the latency of the peer", func() {
+			tracker := NewHealthTracker(DefaultHealthDecay, 0)
+			addr := randomAddrs(1)[0]
+			tracker.Observe(addr, 100*time.Millisecond, nil)
+
+			tracker.ObserveCensored(addr, 10*time.Millisecond)
+			Expect(tracker.Health(addr).Latency).To(Equal(100 * time.Millisecond))
+			Expect(tracker.Health(addr).Samples).To(Equal(uint64(1)))
+
+			for i := 0; i < 10; i++ {
+				tracker.ObserveCensored(addr, 5*time.Second)
+			}
+			Expect(tracker.Health(addr).Latency).To(BeNumerically(">", time.Second))
+			Expect(tracker.Health(addr).Errors).To(BeZero())
+			Expect(tracker.Health(addr).Samples).To(Equal(uint64(11)))
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package dispatcher
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Enumerate default hedging parameters.
+var (
+	// DefaultHedgePercentile is the latency percentile after which another
+	// request is sent when using the hedged iterator.
+	DefaultHedgePercentile = 90
+
+	// DefaultHedgeDelay is the delay before sending another request when
+	// there are not enough latency samples for the method.
+	DefaultHedgeDelay = 500 * time.Millisecond
+
+	// DefaultLatencySamples is the number of recent latencies kept for each
+	// method.
+	DefaultLatencySamples = 100
+
+	// minLatencySamples is the number of samples required before the
+	// percentile is used instead of the default delay.
+	minLatencySamples = 10
+)
+
+// LatencyTracker keeps the most recent successful response latencies for each
+// method so that percentiles can be computed. It is safe for concurrent use.
+type LatencyTracker struct {
+	mu      *sync.Mutex
+	size    int
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+// NewLatencyTracker returns a new `LatencyTracker` which keeps the given
+// number of samples for each method.
+func NewLatencyTracker(size int) *LatencyTracker {
+	return &LatencyTracker{
+		mu:      new(sync.Mutex),
+		size:    size,
+		samples: map[string][]time.Duration{},
+		next:    map[string]int{},
+	}
+}
+
+// Observe records the latency of a successful response for the method.
+func (tracker *LatencyTracker) Observe(method string, latency time.Duration) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	samples := tracker.samples[method]
+	if len(samples) < tracker.size {
+		tracker.samples[method] = append(samples, latency)
+		return
+	}
+	samples[tracker.next[method]] = latency
+	tracker.next[method] = (tracker.next[method] + 1) % tracker.size
+}
+
+// Percentile returns the given percentile (between 0 and 100) of the recent
+// latencies for the method. It returns the default delay if there are not
+// enough samples.
+func (tracker *LatencyTracker) Percentile(method string, percentile int) time.Duration {
+	tracker.mu.Lock()
+	samples := make([]time.Duration, len(tracker.samples[method]))
+	copy(samples, tracker.samples[method])
+	tracker.mu.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return DefaultHedgeDelay
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	index := (len(samples) - 1) * percentile / 100
+	return samples[index]
+}
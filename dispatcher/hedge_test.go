@@ -0,0 +1,77 @@
+package dispatcher_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+	. "github.com/renproject/lightnode/testutils"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+var _ = Describe("Hedging", func() {
+	Context("latency tracker", func() {
+		It("should use the default delay until there are enough samples", func() {
+			tracker := NewLatencyTracker(DefaultLatencySamples)
+			Expect(tracker.Percentile("ren_queryBlock", 90)).To(Equal(DefaultHedgeDelay))
+
+			tracker.Observe("ren_queryBlock", time.Millisecond)
+			Expect(tracker.Percentile("ren_queryBlock", 90)).To(Equal(DefaultHedgeDelay))
+		})
+
+		It("should return the percentile of the most recent samples", func() {
+			tracker := NewLatencyTracker(100)
+			for i := 1; i <= 100; i++ {
+				tracker.Observe("ren_queryBlock", time.Duration(i)*time.Millisecond)
+			}
+			Expect(tracker.Percentile("ren_queryBlock", 0)).To(Equal(time.Millisecond))
+			Expect(tracker.Percentile("ren_queryBlock", 90)).To(Equal(90 * time.Millisecond))
+			Expect(tracker.Percentile("ren_queryBlock", 100)).To(Equal(100 * time.Millisecond))
+
+			// Older samples should be replaced by newer ones.
+			for i := 0; i < 100; i++ {
+				tracker.Observe("ren_queryBlock", time.Second)
+			}
+			Expect(tracker.Percentile("ren_queryBlock", 0)).To(Equal(time.Second))
+			Expect(tracker.Percentile("ren_queryTx", 90)).To(Equal(DefaultHedgeDelay))
+		})
+	})
+
+	Context("hedged response iterator", func() {
+		It("should signal for another request on unsuccessful responses", func() {
+			hedge := make(chan struct{}, 3)
+			iter := NewHedgedResponseIterator(hedge)
+
+			responses := make(chan jsonrpc.Response, 3)
+			ctx, cancel := context.WithCancel(context.Background())
+			data, err := json.Marshal(1)
+			Expect(err).NotTo(HaveOccurred())
+			expected := RandomResponse(true, data)
+			responses <- RandomResponse(false, nil)
+			responses <- RandomResponse(false, nil)
+			responses <- expected
+
+			Expect(iter.Collect(0.0, cancel, responses)).To(Equal(expected))
+			Expect(hedge).To(HaveLen(2))
+
+			// Ensure the context is canceled by the iterator.
+			_, ok := <-ctx.Done()
+			Expect(ok).Should(BeFalse())
+		})
+
+		It("should return an error if no response is successful", func() {
+			hedge := make(chan struct{}, 1)
+			iter := NewHedgedResponseIterator(hedge)
+
+			responses := make(chan jsonrpc.Response, 3)
+			_, cancel := context.WithCancel(context.Background())
+			close(responses)
+
+			Expect(iter.Collect(0.0, cancel, responses).Error).NotTo(BeNil())
+		})
+	})
+})
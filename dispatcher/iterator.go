@@ -49,6 +49,49 @@ func (iter firstResponseIterator) Collect(id interface{}, cancel context.CancelF
 	return most.(jsonrpc.Response)
 }
 
+// hedgedResponseIterator returns the first successful response it gets, like
+// the firstResponseIterator. Whenever it gets an unsuccessful response it
+// signals that the request should be sent to another darknode without waiting
+// for the hedging delay.
+type hedgedResponseIterator struct {
+	hedge     chan<- struct{}
+	responses *interfaceMap
+}
+
+// NewHedgedResponseIterator creates a new hedgedResponseIterator which
+// signals on the given channel when another request should be sent.
+func NewHedgedResponseIterator(hedge chan<- struct{}) Iterator {
+	return hedgedResponseIterator{
+		hedge: hedge,
+	}
+}
+
+// Collect implements the `Iterator` interface.
+func (iter hedgedResponseIterator) Collect(id interface{}, cancel context.CancelFunc, responses <-chan jsonrpc.Response) jsonrpc.Response {
+	iter.responses = newInterfaceMap(cap(responses))
+	defer cancel()
+
+	for response := range responses {
+		if response.Error == nil {
+			return response
+		}
+		iter.responses.store(response)
+		select {
+		case iter.hedge <- struct{}{}:
+		default:
+		}
+	}
+	most := iter.responses.most()
+
+	// Failed to get a valid response from any of the nodes (rare).
+	if most == nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "unable to query the network", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+
+	return most.(jsonrpc.Response)
+}
+
 // majorityResponseIterator select and returns the response returned by majority
 // darknodes.
 type majorityResponseIterator struct {
@@ -84,6 +127,38 @@ func (iter majorityResponseIterator) Collect(id interface{}, cancel context.Canc
 	return most.(jsonrpc.Response)
 }
 
+// quorumResponseIterator returns the first response that has been returned by
+// a given number of darknodes.
+type quorumResponseIterator struct {
+	quorum    int
+	responses *interfaceMap
+}
+
+// NewQuorumResponseIterator returns a new quorumResponseIterator which
+// requires the given number of identical responses.
+func NewQuorumResponseIterator(quorum int) Iterator {
+	return quorumResponseIterator{
+		quorum: quorum,
+	}
+}
+
+// Collect implements the `Iterator` interface.
+func (iter quorumResponseIterator) Collect(id interface{}, cancel context.CancelFunc, responses <-chan jsonrpc.Response) jsonrpc.Response {
+	iter.responses = newInterfaceMap(cap(responses))
+	iter.responses.threshold = iter.quorum - 1
+	defer cancel()
+
+	for response := range responses {
+		if ok := iter.responses.store(response); ok {
+			return response
+		}
+	}
+
+	// Failed to get enough identical responses from the nodes.
+	jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "unable to reach quorum", nil)
+	return jsonrpc.NewResponse(id, nil, &jsonErr)
+}
+
 // interfaceMap use to is a customized map for storing interface{}. It uses
 // reflect.Deepequal function to compare interface{}.
 type interfaceMap struct {
@@ -170,4 +170,62 @@ var _ = Describe("iterator", func() {
 			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
 		})
 	})
+
+	Context("quorum response iterator", func() {
+		It("should return the response once the quorum has been reached", func() {
+			iter := NewQuorumResponseIterator(3)
+
+			test := func() bool {
+				responses := make(chan jsonrpc.Response, 13)
+				ctx, cancel := context.WithCancel(context.Background())
+
+				// Simulate piping responses from Darknodes to the channel.
+				data, err := json.Marshal(0)
+				Expect(err).NotTo(HaveOccurred())
+				expected := RandomResponse(true, data)
+				for i := 0; i < 13; i++ {
+					if i%2 == 0 {
+						responses <- expected
+					} else {
+						other, err := json.Marshal(i)
+						Expect(err).NotTo(HaveOccurred())
+						responses <- RandomResponse(true, other)
+					}
+				}
+
+				// Collect the response selected by the iterator.
+				res := iter.Collect(0.0, cancel, responses)
+				Expect(res).Should(Equal(expected))
+
+				// Ensure the context is canceled by the iterator.
+				_, ok := <-ctx.Done()
+				Expect(ok).Should(BeFalse())
+				return len(responses) == 8
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+		})
+
+		It("should return an error if the quorum cannot be reached", func() {
+			iter := NewQuorumResponseIterator(3)
+
+			test := func() bool {
+				responses := make(chan jsonrpc.Response, 13)
+				_, cancel := context.WithCancel(context.Background())
+
+				for i := 0; i < 13; i++ {
+					data, err := json.Marshal(i)
+					Expect(err).NotTo(HaveOccurred())
+					responses <- RandomResponse(true, data)
+				}
+				close(responses)
+
+				// Collect the response selected by the iterator.
+				response := iter.Collect(0.0, cancel, responses)
+				return response.Error != nil
+			}
+
+			Expect(quick.Check(test, nil)).NotTo(HaveOccurred())
+		})
+	})
 })
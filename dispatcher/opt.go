@@ -0,0 +1,87 @@
+package dispatcher
+
+import (
+	"time"
+
+	"github.com/renproject/lightnode/http"
+	"github.com/sirupsen/logrus"
+)
+
+// Options to configure the precise behaviour of the dispatcher.
+type Options struct {
+	Logger       logrus.FieldLogger
+	Timeout      time.Duration
+	Policies     Policies
+	Endpoints    http.Endpoints
+	BatchWindow  time.Duration
+	MaxBatchSize int
+	Health       *HealthTracker
+	Routing      *RoutingTable
+}
+
+// DefaultOptions returns new options with default configurations that should
+// work for the majority of use cases.
+func DefaultOptions() Options {
+	return Options{
+		Logger:       logrus.New(),
+		Timeout:      http.DefaultClientTimeout,
+		Policies:     DefaultPolicies,
+		Endpoints:    http.Endpoints{},
+		BatchWindow:  DefaultBatchWindow,
+		MaxBatchSize: DefaultMaxBatchSize,
+	}
+}
+
+// WithLogger returns new options with the given logger.
+func (opts Options) WithLogger(logger logrus.FieldLogger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithTimeout returns new options with the given client timeout.
+func (opts Options) WithTimeout(timeout time.Duration) Options {
+	opts.Timeout = timeout
+	return opts
+}
+
+// WithPolicies returns new options with the given dispatch policies.
+func (opts Options) WithPolicies(policies Policies) Options {
+	opts.Policies = policies
+	return opts
+}
+
+// WithEndpoints returns new options with the given Darknode endpoints.
+func (opts Options) WithEndpoints(endpoints http.Endpoints) Options {
+	opts.Endpoints = endpoints
+	return opts
+}
+
+// WithBatchWindow returns new options with the given batch window. Requests
+// sent to the same Darknode within the window are forwarded as a single batch.
+// Batching is disabled if the window is zero.
+func (opts Options) WithBatchWindow(window time.Duration) Options {
+	opts.BatchWindow = window
+	return opts
+}
+
+// WithMaxBatchSize returns new options with the given maximum number of
+// requests forwarded to a Darknode in a single batch.
+func (opts Options) WithMaxBatchSize(size int) Options {
+	opts.MaxBatchSize = size
+	return opts
+}
+
+// WithHealth returns new options with the given health tracker, so that the
+// health of the Darknodes can be shared with other components. A new tracker
+// is created if none is given.
+func (opts Options) WithHealth(health *HealthTracker) Options {
+	opts.Health = health
+	return opts
+}
+
+// WithRouting returns new options with the given routing table, which is used
+// to send shard requests to the members of the relevant shard.
+func (opts Options) WithRouting(routing *RoutingTable) Options {
+	opts.Routing = routing
+	return opts
+}
@@ -0,0 +1,214 @@
+package dispatcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+// PolicyFallback is the key of the policy used for methods that do not have a
+// policy of their own.
+const PolicyFallback = "fallback"
+
+// PeerSet is the set of Darknodes from which the peers for a request are
+// selected.
+type PeerSet string
+
+// Enumerate the supported peer sets.
+const (
+	// PeerSetBootstrap selects from the Bootstrap nodes.
+	PeerSetBootstrap = PeerSet("bootstrap")
+	// PeerSetAll selects from all known Darknodes.
+	PeerSetAll = PeerSet("all")
+	// PeerSetShard selects from the members of the shard responsible for the
+	// request, according to the routing table of the current epoch. Until
+	// enough members of the shard are known to reach the fanout, the
+	// Bootstrap nodes are used. No policy uses it by default.
+	PeerSetShard = PeerSet("shard")
+)
+
+// IteratorType determines how the responses from the selected peers are
+// combined into a single response.
+type IteratorType string
+
+// Enumerate the supported iterator types.
+const (
+	// IteratorFirst returns the first successful response.
+	IteratorFirst = IteratorType("first")
+	// IteratorMajority returns the response returned by the majority of peers.
+	IteratorMajority = IteratorType("majority")
+	// IteratorQuorum returns the first response returned by a given number
+	// of peers.
+	IteratorQuorum = IteratorType("quorum")
+	// IteratorHedged sends the request to the healthiest peer first and only
+	// sends it to the next peer if no successful response has arrived within
+	// a latency percentile for the method. It returns the first successful
+	// response.
+	IteratorHedged = IteratorType("hedged")
+)
+
+// Policy determines which peers a request is sent to and how their responses
+// are combined.
+type Policy struct {
+	// Peers is the set of Darknodes that peers are selected from.
+	Peers PeerSet
+	// Fanout is the number of peers the request is sent to. A value of zero
+	// sends the request to every peer in the set.
+	Fanout int
+	// Iterator is the strategy used to combine the responses.
+	Iterator IteratorType
+	// Quorum is the number of identical responses required when using the
+	// quorum iterator.
+	Quorum int
+	// Percentile is the latency percentile used to decide when to send
+	// another request when using the hedged iterator. A value of zero uses
+	// the default percentile.
+	Percentile int
+	// Timeout is the time allowed for each request. A value of zero uses the
+	// client timeout.
+	Timeout time.Duration
+}
+
+// String returns the policy in the format accepted by `ParsePolicy`.
+func (policy Policy) String() string {
+	iter := string(policy.Iterator)
+	if policy.Iterator == IteratorQuorum {
+		iter = fmt.Sprintf("%v-%v", IteratorQuorum, policy.Quorum)
+	}
+	if policy.Iterator == IteratorHedged && policy.Percentile != 0 {
+		iter = fmt.Sprintf("%v-%v", IteratorHedged, policy.Percentile)
+	}
+	return fmt.Sprintf("%v:%v:%v:%v", policy.Peers, policy.Fanout, iter, policy.Timeout.String())
+}
+
+// Validate returns an error if the policy cannot be used.
+func (policy Policy) Validate() error {
+	switch policy.Peers {
+	case PeerSetBootstrap, PeerSetAll, PeerSetShard:
+	default:
+		return fmt.Errorf("unknown peer set %v", policy.Peers)
+	}
+	if policy.Fanout < 0 {
+		return fmt.Errorf("invalid fanout %v", policy.Fanout)
+	}
+	switch policy.Iterator {
+	case IteratorFirst, IteratorMajority:
+	case IteratorQuorum:
+		if policy.Quorum <= 0 {
+			return fmt.Errorf("invalid quorum %v", policy.Quorum)
+		}
+		if policy.Fanout != 0 && policy.Quorum > policy.Fanout {
+			return fmt.Errorf("quorum %v exceeds fanout %v", policy.Quorum, policy.Fanout)
+		}
+	case IteratorHedged:
+		if policy.Percentile < 0 || policy.Percentile > 100 {
+			return fmt.Errorf("invalid percentile %v", policy.Percentile)
+		}
+	default:
+		return fmt.Errorf("unknown iterator %v", policy.Iterator)
+	}
+	if policy.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %v", policy.Timeout)
+	}
+	return nil
+}
+
+// ParsePolicy parses a policy of the form "peers:fanout:iterator[:timeout]",
+// where the timeout is either a duration or a number of seconds. For example,
+// "bootstrap:0:quorum-3:10" sends requests to all Bootstrap nodes, waits for
+// three identical responses and times out after ten seconds, as does
+// "bootstrap:0:quorum-3:10s". The hedged iterator optionally takes a
+// latency percentile, for example "bootstrap:5:hedged-95".
+func ParsePolicy(value string) (Policy, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Policy{}, fmt.Errorf("invalid policy %v", value)
+	}
+
+	fanout, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid fanout %v: %v", parts[1], err)
+	}
+	policy := Policy{
+		Peers:    PeerSet(parts[0]),
+		Fanout:   fanout,
+		Iterator: IteratorType(parts[2]),
+	}
+	if strings.HasPrefix(parts[2], string(IteratorQuorum)+"-") {
+		quorum, err := strconv.Atoi(strings.TrimPrefix(parts[2], string(IteratorQuorum)+"-"))
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid quorum %v: %v", parts[2], err)
+		}
+		policy.Iterator = IteratorQuorum
+		policy.Quorum = quorum
+	}
+	if strings.HasPrefix(parts[2], string(IteratorHedged)+"-") {
+		percentile, err := strconv.Atoi(strings.TrimPrefix(parts[2], string(IteratorHedged)+"-"))
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid percentile %v: %v", parts[2], err)
+		}
+		policy.Iterator = IteratorHedged
+		policy.Percentile = percentile
+	}
+	if len(parts) == 4 {
+		timeout, err := time.ParseDuration(parts[3])
+		if err != nil {
+			seconds, secondsErr := strconv.Atoi(parts[3])
+			if secondsErr != nil {
+				return Policy{}, fmt.Errorf("invalid timeout %v: %v", parts[3], err)
+			}
+			timeout = time.Duration(seconds) * time.Second
+		}
+		policy.Timeout = timeout
+	}
+	return policy, policy.Validate()
+}
+
+// Policies maps methods to the policy used to dispatch them.
+type Policies map[string]Policy
+
+// DefaultPolicies are the policies used if none are specified.
+var DefaultPolicies = Policies{
+	jsonrpc.MethodSubmitTx:  {Peers: PeerSetBootstrap, Fanout: 3, Iterator: IteratorFirst},
+	jsonrpc.MethodQueryTx:   {Peers: PeerSetBootstrap, Fanout: 0, Iterator: IteratorMajority},
+	jsonrpc.MethodQueryStat: {Peers: PeerSetAll, Fanout: 3, Iterator: IteratorFirst},
+	PolicyFallback:          {Peers: PeerSetBootstrap, Fanout: 5, Iterator: IteratorFirst},
+}
+
+// Get returns the policy for the given method. If the method does not have a
+// policy, the fallback policy is returned.
+func (policies Policies) Get(method string) Policy {
+	if policy, ok := policies[method]; ok {
+		return policy
+	}
+	if policy, ok := policies[PolicyFallback]; ok {
+		return policy
+	}
+	return DefaultPolicies[PolicyFallback]
+}
+
+// Uses returns whether any of the policies selects peers from the given set.
+func (policies Policies) Uses(peers PeerSet) bool {
+	for _, policy := range policies {
+		if policy.Peers == peers {
+			return true
+		}
+	}
+	return false
+}
+
+// With returns a copy of the policies with the given policies overriding
+// existing ones for the same methods.
+func (policies Policies) With(overrides Policies) Policies {
+	merged := make(Policies, len(policies)+len(overrides))
+	for method, policy := range policies {
+		merged[method] = policy
+	}
+	for method, policy := range overrides {
+		merged[method] = policy
+	}
+	return merged
+}
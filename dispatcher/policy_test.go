@@ -0,0 +1,89 @@
+package dispatcher_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+
+	"github.com/renproject/darknode/jsonrpc"
+)
+
+var _ = Describe("Policies", func() {
+	Context("when parsing policies", func() {
+		It("should parse valid policies", func() {
+			policy, err := ParsePolicy("bootstrap:0:quorum-3:10")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(Policy{
+				Peers:    PeerSetBootstrap,
+				Fanout:   0,
+				Iterator: IteratorQuorum,
+				Quorum:   3,
+				Timeout:  10 * time.Second,
+			}))
+
+			policy, err = ParsePolicy("all:5:first")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy).To(Equal(Policy{
+				Peers:    PeerSetAll,
+				Fanout:   5,
+				Iterator: IteratorFirst,
+			}))
+		})
+
+		It("should return the same policy after formatting it", func() {
+			policies := DefaultPolicies.With(Policies{
+				"ren_slow":   {Peers: PeerSetAll, Fanout: 3, Iterator: IteratorFirst, Timeout: 1500 * time.Millisecond},
+				"ren_hedged": {Peers: PeerSetBootstrap, Fanout: 5, Iterator: IteratorHedged, Percentile: 95, Timeout: 2 * time.Minute},
+			})
+			for _, policy := range policies {
+				parsed, err := ParsePolicy(policy.String())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(parsed).To(Equal(policy))
+			}
+
+			policy, err := ParsePolicy("all:3:first:250ms")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.Timeout).To(Equal(250 * time.Millisecond))
+		})
+
+		It("should reject invalid policies", func() {
+			for _, value := range []string{
+				"",
+				"bootstrap:3",
+				"everyone:3:first",
+				"bootstrap:-1:first",
+				"bootstrap:three:first",
+				"bootstrap:3:fastest",
+				"bootstrap:3:quorum-0",
+				"bootstrap:3:quorum-4",
+				"bootstrap:3:first:soon",
+			} {
+				_, err := ParsePolicy(value)
+				Expect(err).To(HaveOccurred(), value)
+			}
+		})
+	})
+
+	Context("when getting the policy for a method", func() {
+		It("should use the fallback policy for unknown methods", func() {
+			Expect(DefaultPolicies.Get("ren_unknown")).To(Equal(DefaultPolicies[PolicyFallback]))
+			Expect(Policies{}.Get("ren_unknown")).To(Equal(DefaultPolicies[PolicyFallback]))
+		})
+
+		It("should prefer overridden policies", func() {
+			override := Policy{Peers: PeerSetAll, Fanout: 7, Iterator: IteratorMajority}
+			policies := DefaultPolicies.With(Policies{jsonrpc.MethodSubmitTx: override})
+			Expect(policies.Get(jsonrpc.MethodSubmitTx)).To(Equal(override))
+			Expect(policies.Get(jsonrpc.MethodQueryTx)).To(Equal(DefaultPolicies[jsonrpc.MethodQueryTx]))
+			Expect(DefaultPolicies.Get(jsonrpc.MethodSubmitTx)).NotTo(Equal(override))
+		})
+
+		It("should only route to shards if a policy opts in", func() {
+			Expect(DefaultPolicies.Uses(PeerSetShard)).To(BeFalse())
+			policies := DefaultPolicies.With(Policies{jsonrpc.MethodSubmitTx: {Peers: PeerSetShard, Fanout: 3, Iterator: IteratorFirst}})
+			Expect(policies.Uses(PeerSetShard)).To(BeTrue())
+		})
+	})
+})
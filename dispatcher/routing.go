@@ -0,0 +1,133 @@
+package dispatcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/id"
+	"github.com/renproject/pack"
+)
+
+// Epoch identifies an epoch of the Darknodes.
+type Epoch struct {
+	Number uint64
+	Hash   pack.Bytes32
+}
+
+// RoutingTable tracks the current epoch and the members of the shards
+// responsible for transactions, as reported in the System state of the
+// Darknodes. It is safe for concurrent use.
+type RoutingTable struct {
+	mu      *sync.RWMutex
+	epoch   Epoch
+	shards  []pack.Bytes32
+	members []string
+}
+
+// NewRoutingTable returns an empty `RoutingTable`. Until it is updated, the
+// dispatcher routes shard requests to the Bootstrap nodes.
+func NewRoutingTable() *RoutingTable {
+	return &RoutingTable{
+		mu: new(sync.RWMutex),
+	}
+}
+
+// Update replaces the routing table with the shards and members in the given
+// System state, if it is for a different epoch. It returns whether the epoch
+// changed.
+func (table *RoutingTable) Update(system engine.SystemState) (bool, error) {
+	epoch := Epoch{
+		Number: uint64(system.Epoch.Number),
+		Hash:   system.Epoch.Hash,
+	}
+
+	table.mu.RLock()
+	unchanged := table.epoch == epoch && len(table.members) > 0
+	table.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	members, err := nodeSignatories(system.Nodes)
+	if err != nil {
+		return false, err
+	}
+	shards := make([]pack.Bytes32, len(system.Shards.Primary))
+	for i := range system.Shards.Primary {
+		shards[i] = system.Shards.Primary[i].Shard
+	}
+
+	table.mu.Lock()
+	defer table.mu.Unlock()
+
+	table.epoch = epoch
+	table.shards = shards
+	table.members = members
+	return true, nil
+}
+
+// Epoch returns the current epoch.
+func (table *RoutingTable) Epoch() Epoch {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	return table.epoch
+}
+
+// Shards returns the primary shards of the current epoch.
+func (table *RoutingTable) Shards() []pack.Bytes32 {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	shards := make([]pack.Bytes32, len(table.shards))
+	copy(shards, table.shards)
+	return shards
+}
+
+// Members returns the signatories of the members of the primary shards, which
+// handle transaction queries and submissions. The System state does not
+// assign Darknodes to individual shards, so every Darknode in the current
+// epoch is a member of the primary shards. It returns nothing if the routing
+// table has not been updated yet.
+func (table *RoutingTable) Members() []string {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	members := make([]string, len(table.members))
+	copy(members, table.members)
+	return members
+}
+
+// nodeSignatories returns the signatories of the Darknodes in the System
+// state. Only the signatory of each node is needed, so the nodes are decoded
+// from their JSON representation and both the `signatory` and `id` keys are
+// accepted.
+func nodeSignatories(nodes interface{}) ([]string, error) {
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling nodes: %v", err)
+	}
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unmarshaling nodes: %v", err)
+	}
+
+	signatories := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		for _, key := range []string{"signatory", "id"} {
+			raw, ok := entry[key]
+			if !ok {
+				continue
+			}
+			var signatory id.Signatory
+			if err := json.Unmarshal(raw, &signatory); err != nil {
+				return nil, fmt.Errorf("unmarshaling node %v: %v", key, err)
+			}
+			signatories = append(signatories, signatory.String())
+			break
+		}
+	}
+	return signatories, nil
+}
@@ -0,0 +1,33 @@
+package dispatcher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/dispatcher"
+	. "github.com/renproject/lightnode/testutils"
+
+	"github.com/renproject/pack"
+)
+
+var _ = Describe("Routing table", func() {
+	Context("when updating from the system state", func() {
+		It("should track the epoch and the primary shards", func() {
+			table := NewRoutingTable()
+			Expect(table.Members()).To(BeEmpty())
+
+			system := MockSystemState()
+			changed, err := table.Update(system)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(table.Epoch()).To(Equal(Epoch{Number: 0, Hash: pack.Bytes32{}}))
+			Expect(table.Shards()).To(HaveLen(len(system.Shards.Primary)))
+
+			system.Epoch.Number = 1
+			system.Epoch.Hash = pack.Bytes32{1}
+			changed, err = table.Update(system)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(table.Epoch()).To(Equal(Epoch{Number: 1, Hash: pack.Bytes32{1}}))
+		})
+	})
+})
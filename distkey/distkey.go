@@ -0,0 +1,123 @@
+// Package distkey tracks the distributed public key of RenVM, which is used to
+// build gateways and burn transactions. The key is configured at startup, and
+// then follows the key of the primary shard reported by the Darknodes.
+package distkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"expvar"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/renproject/id"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// mismatch is set to one while a distributed public key that does not match
+// the configured key is reported by any Darknode, so that operators can be
+// alerted to update it.
+var mismatch = expvar.NewInt("distkey_mismatch")
+
+// DefaultQuorum is the number of distinct Darknodes that must report a new key
+// before it is used.
+var DefaultQuorum = 2
+
+// Tracker keeps the distributed public key that is currently in use. A new key
+// reported by the Darknodes is only used once it is reported by a quorum of
+// distinct Darknodes, so that a single faulty Darknode cannot replace the key.
+// It is safe for concurrent use.
+type Tracker struct {
+	logger logrus.FieldLogger
+	quorum int
+
+	mu         *sync.RWMutex
+	configured []byte
+	current    *id.PubKey
+	reported   map[string][]byte
+}
+
+// NewTracker returns a new `Tracker` which uses the configured key until a
+// different key has been reported by the given number of distinct Darknodes.
+func NewTracker(logger logrus.FieldLogger, configured *id.PubKey, quorum int) *Tracker {
+	return &Tracker{
+		logger:     logger,
+		quorum:     quorum,
+		mu:         new(sync.RWMutex),
+		configured: compress(configured),
+		current:    configured,
+		reported:   map[string][]byte{},
+	}
+}
+
+// PubKey returns the distributed public key that is currently in use.
+func (tracker *Tracker) PubKey() *id.PubKey {
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+
+	return tracker.current
+}
+
+// Observe records the compressed public key of the primary shard, as reported
+// in the System state of the given Darknode. Only the most recent key reported
+// by each Darknode is kept. It returns an error if the key is invalid.
+func (tracker *Tracker) Observe(darknode string, shardPubKey pack.Bytes) error {
+	key, err := crypto.DecompressPubkey(shardPubKey)
+	if err != nil {
+		return fmt.Errorf("decompressing shard pubkey: %v", err)
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.reported[darknode] = shardPubKey
+	tracker.updateMismatch()
+
+	if bytes.Equal(shardPubKey, compress(tracker.current)) {
+		return nil
+	}
+	votes := 0
+	for _, reported := range tracker.reported {
+		if bytes.Equal(reported, shardPubKey) {
+			votes++
+		}
+	}
+	if votes < tracker.quorum {
+		tracker.logger.Warnf("[distkey] darknode %v reported new shard pubkey %v (%v/%v)", darknode, shardPubKey, votes, tracker.quorum)
+		return nil
+	}
+
+	previous := compress(tracker.current)
+	tracker.current = (*id.PubKey)(key)
+	tracker.logger.Warnf("[distkey] switched distributed public key from %v to %v", pack.Bytes(previous), shardPubKey)
+	return nil
+}
+
+// updateMismatch sets the mismatch metric if the key in use, or the key
+// reported by any Darknode, does not match the configured key. It must be
+// called with the lock held.
+func (tracker *Tracker) updateMismatch() {
+	mismatched := compress(tracker.current)
+	for _, reported := range tracker.reported {
+		if !bytes.Equal(reported, tracker.configured) {
+			mismatched = reported
+		}
+	}
+	if bytes.Equal(mismatched, tracker.configured) {
+		mismatch.Set(0)
+		return
+	}
+	if mismatch.Value() == 0 {
+		tracker.logger.Errorf("[distkey] distributed public key %v does not match the configured key %v", pack.Bytes(mismatched), pack.Bytes(tracker.configured))
+	}
+	mismatch.Set(1)
+}
+
+func compress(pubKey *id.PubKey) []byte {
+	if pubKey == nil {
+		return nil
+	}
+	return crypto.CompressPubkey((*ecdsa.PublicKey)(pubKey))
+}
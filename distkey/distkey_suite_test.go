@@ -0,0 +1,13 @@
+package distkey_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDistkey(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Distkey Suite")
+}
@@ -0,0 +1,84 @@
+package distkey_test
+
+import (
+	"crypto/ecdsa"
+	"expvar"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/distkey"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/renproject/id"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Distributed public key tracker", func() {
+	compress := func(pubKey *id.PubKey) pack.Bytes {
+		return crypto.CompressPubkey((*ecdsa.PublicKey)(pubKey))
+	}
+
+	Context("when the shard key changes", func() {
+		It("should switch once the key has been reported by a quorum of darknodes", func() {
+			configured := id.NewPrivKey().PubKey()
+			rotated := id.NewPrivKey().PubKey()
+			tracker := NewTracker(logrus.New(), configured, 2)
+
+			Expect(tracker.Observe("a", compress(configured))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+
+			Expect(tracker.Observe("b", compress(rotated))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+
+			Expect(tracker.Observe("a", compress(rotated))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(rotated)))
+		})
+
+		It("should not switch if the key is only reported by a single darknode", func() {
+			configured := id.NewPrivKey().PubKey()
+			rotated := id.NewPrivKey().PubKey()
+			tracker := NewTracker(logrus.New(), configured, 2)
+
+			for i := 0; i < 5; i++ {
+				Expect(tracker.Observe("a", compress(rotated))).To(Succeed())
+			}
+			Expect(tracker.Observe("b", compress(configured))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+		})
+
+		It("should only count the most recent key reported by each darknode", func() {
+			configured := id.NewPrivKey().PubKey()
+			rotated := id.NewPrivKey().PubKey()
+			tracker := NewTracker(logrus.New(), configured, 2)
+
+			Expect(tracker.Observe("a", compress(rotated))).To(Succeed())
+			Expect(tracker.Observe("a", compress(configured))).To(Succeed())
+			Expect(tracker.Observe("b", compress(rotated))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+		})
+
+		It("should report a mismatch as soon as a darknode reports a different key", func() {
+			configured := id.NewPrivKey().PubKey()
+			tracker := NewTracker(logrus.New(), configured, 2)
+
+			Expect(tracker.Observe("a", compress(configured))).To(Succeed())
+			Expect(expvar.Get("distkey_mismatch").String()).To(Equal("0"))
+
+			Expect(tracker.Observe("b", compress(id.NewPrivKey().PubKey()))).To(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+			Expect(expvar.Get("distkey_mismatch").String()).To(Equal("1"))
+
+			Expect(tracker.Observe("b", compress(configured))).To(Succeed())
+			Expect(expvar.Get("distkey_mismatch").String()).To(Equal("0"))
+		})
+
+		It("should reject invalid keys", func() {
+			configured := id.NewPrivKey().PubKey()
+			tracker := NewTracker(logrus.New(), configured, 1)
+
+			Expect(tracker.Observe("a", pack.Bytes{1, 2, 3})).NotTo(Succeed())
+			Expect(compress(tracker.PubKey())).To(Equal(compress(configured)))
+		})
+	})
+})
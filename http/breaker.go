@@ -0,0 +1,213 @@
+package http
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Enumerate default circuit breaker options.
+var (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerCooldown         = 30 * time.Second
+)
+
+// breakerStates and breakerTransitions expose the state of the circuit
+// breakers, and the number of times they have changed state, as metrics.
+var (
+	breakerStates      = expvar.NewMap("breaker_states")
+	breakerTransitions = expvar.NewMap("breaker_transitions")
+)
+
+// BreakerState is the state of the circuit breaker for a single peer.
+type BreakerState uint8
+
+// Enumerate the circuit breaker states.
+const (
+	// BreakerClosed allows all requests to the peer.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all requests to the peer until the cooldown has
+	// passed.
+	BreakerOpen
+	// BreakerHalfOpen allows a single probe request to the peer. The breaker
+	// closes if it succeeds and opens again if it fails.
+	BreakerHalfOpen
+)
+
+// String implements the `fmt.Stringer` interface.
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerOptions are used to configure the circuit breakers.
+type BreakerOptions struct {
+	FailureThreshold int           // Consecutive failures before opening.
+	Cooldown         time.Duration // Time spent open before probing.
+}
+
+// DefaultBreakerOptions are the recommended circuit breaker settings.
+var DefaultBreakerOptions = BreakerOptions{
+	FailureThreshold: DefaultBreakerFailureThreshold,
+	Cooldown:         DefaultBreakerCooldown,
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Breakers keeps a circuit breaker for every peer that requests are sent to.
+// A breaker opens after a number of consecutive failures, after which requests
+// to the peer are rejected until the cooldown has passed. It is safe for
+// concurrent use and is meant to be shared by everything sending requests to
+// the Darknodes.
+type Breakers struct {
+	logger   logrus.FieldLogger
+	options  BreakerOptions
+	mu       *sync.Mutex
+	breakers map[string]*breaker
+}
+
+// NewBreakers returns a new set of circuit breakers.
+func NewBreakers(logger logrus.FieldLogger, options BreakerOptions) *Breakers {
+	return &Breakers{
+		logger:   logger,
+		options:  options,
+		mu:       new(sync.Mutex),
+		breakers: map[string]*breaker{},
+	}
+}
+
+// Available returns whether requests to the peer would currently be allowed,
+// without changing the state of its breaker.
+func (breakers *Breakers) Available(peer string) bool {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.breakers[peer]
+	if !ok {
+		return true
+	}
+	switch b.state {
+	case BreakerOpen:
+		return time.Since(b.openedAt) >= breakers.options.Cooldown
+	case BreakerHalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+// Allow returns whether a request can be sent to the peer. If the breaker has
+// been open for longer than the cooldown, it becomes half-open and allows a
+// single probe request. Every allowed request must be followed by a call to
+// `Record` or `Release`.
+func (breakers *Breakers) Allow(peer string) bool {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b := breakers.get(peer)
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < breakers.options.Cooldown {
+			return false
+		}
+		breakers.transition(peer, b, BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record records the outcome of a request sent to the peer.
+func (breakers *Breakers) Record(peer string, err error) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b := breakers.get(peer)
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			breakers.transition(peer, b, BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= breakers.options.FailureThreshold) {
+		b.openedAt = time.Now()
+		breakers.transition(peer, b, BreakerOpen)
+	}
+}
+
+// Release is called instead of `Record` when an allowed request finished
+// without an outcome, for example because it was cancelled.
+func (breakers *Breakers) Release(peer string) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	breakers.get(peer).probing = false
+}
+
+// State returns the current state of the breaker for the peer.
+func (breakers *Breakers) State(peer string) BreakerState {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	b, ok := breakers.breakers[peer]
+	if !ok {
+		return BreakerClosed
+	}
+	return b.state
+}
+
+// get returns the breaker for the peer, creating it if it does not exist. It
+// must be called while holding the mutex.
+func (breakers *Breakers) get(peer string) *breaker {
+	b, ok := breakers.breakers[peer]
+	if !ok {
+		b = &breaker{state: BreakerClosed}
+		breakers.breakers[peer] = b
+	}
+	return b
+}
+
+// transition changes the state of the breaker and reports the change. It must
+// be called while holding the mutex.
+func (breakers *Breakers) transition(peer string, b *breaker, state BreakerState) {
+	from := b.state
+	b.state = state
+
+	stateVar := new(expvar.String)
+	stateVar.Set(state.String())
+	breakerStates.Set(peer, stateVar)
+	breakerTransitions.Add(state.String(), 1)
+
+	switch state {
+	case BreakerOpen:
+		breakers.logger.Warnf("[breaker] %v -> %v for peer=%v after %v failures", from, state, peer, b.failures)
+	default:
+		breakers.logger.Infof("[breaker] %v -> %v for peer=%v", from, state, peer)
+	}
+}
@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+var _ = Describe("Circuit breakers", func() {
+	options := BreakerOptions{
+		FailureThreshold: 3,
+		Cooldown:         100 * time.Millisecond,
+	}
+	failure := errors.New("connection refused")
+
+	Context("when a peer keeps failing", func() {
+		It("should open after the failure threshold", func() {
+			breakers := NewBreakers(logrus.New(), options)
+			for i := 0; i < options.FailureThreshold; i++ {
+				Expect(breakers.Allow("peer")).To(BeTrue())
+				breakers.Record("peer", failure)
+			}
+			Expect(breakers.State("peer")).To(Equal(BreakerOpen))
+			Expect(breakers.Available("peer")).To(BeFalse())
+			Expect(breakers.Allow("peer")).To(BeFalse())
+
+			// Other peers should not be affected.
+			Expect(breakers.State("other")).To(Equal(BreakerClosed))
+			Expect(breakers.Allow("other")).To(BeTrue())
+		})
+
+		It("should not open if failures are not consecutive", func() {
+			breakers := NewBreakers(logrus.New(), options)
+			for i := 0; i < 2*options.FailureThreshold; i++ {
+				breakers.Record("peer", failure)
+				breakers.Record("peer", nil)
+			}
+			Expect(breakers.State("peer")).To(Equal(BreakerClosed))
+		})
+	})
+
+	Context("when the cooldown has passed", func() {
+		open := func() *Breakers {
+			breakers := NewBreakers(logrus.New(), options)
+			for i := 0; i < options.FailureThreshold; i++ {
+				breakers.Record("peer", failure)
+			}
+			time.Sleep(options.Cooldown)
+			return breakers
+		}
+
+		It("should allow a single probe request", func() {
+			breakers := open()
+			Expect(breakers.Available("peer")).To(BeTrue())
+			Expect(breakers.Allow("peer")).To(BeTrue())
+			Expect(breakers.State("peer")).To(Equal(BreakerHalfOpen))
+			Expect(breakers.Allow("peer")).To(BeFalse())
+
+			// Releasing the probe allows another one.
+			breakers.Release("peer")
+			Expect(breakers.Allow("peer")).To(BeTrue())
+		})
+
+		It("should close if the probe succeeds", func() {
+			breakers := open()
+			Expect(breakers.Allow("peer")).To(BeTrue())
+			breakers.Record("peer", nil)
+			Expect(breakers.State("peer")).To(Equal(BreakerClosed))
+			Expect(breakers.Allow("peer")).To(BeTrue())
+		})
+
+		It("should open again if the probe fails", func() {
+			breakers := open()
+			Expect(breakers.Allow("peer")).To(BeTrue())
+			breakers.Record("peer", failure)
+			Expect(breakers.State("peer")).To(Equal(BreakerOpen))
+			Expect(breakers.Allow("peer")).To(BeFalse())
+		})
+	})
+})
@@ -65,6 +65,74 @@ func (c Client) SendRequest(ctx context.Context, url string, request jsonrpc.Req
 	return c.retry(ctx, r, options)
 }
 
+// SendBatch sends the `jsonrpc.Request`s to the given URL as a single JSON-RPC
+// batch. The requests must have unique IDs. The responses are returned in the
+// same order as the requests, and requests that were left unanswered by the
+// server are given an error response.
+func (c Client) SendBatch(ctx context.Context, url string, requests []jsonrpc.Request) ([]jsonrpc.Response, error) {
+	// Construct HTTP request.
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, fmt.Errorf("[client] could not marshal batch: %v", err)
+	}
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("[client] could not create http request: %v", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	response, err := c.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(response.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	// Servers reply with a single response if they reject the whole batch.
+	var resps []jsonrpc.Response
+	if err := json.Unmarshal(raw, &resps); err != nil {
+		var resp jsonrpc.Response
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, fmt.Errorf("[client] could not unmarshal batch response: %v", err)
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("[client] batch rejected: %v", resp.Error.Message)
+		}
+		return nil, fmt.Errorf("[client] unexpected response to batch")
+	}
+
+	// Match the responses to the requests using their IDs.
+	byID := make(map[string]jsonrpc.Response, len(resps))
+	for _, resp := range resps {
+		byID[batchKey(resp.ID)] = resp
+	}
+	responses := make([]jsonrpc.Response, len(requests))
+	for i, request := range requests {
+		resp, ok := byID[batchKey(request.ID)]
+		if !ok {
+			jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "missing response in batch", nil)
+			resp = jsonrpc.NewResponse(request.ID, nil, &jsonErr)
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
+// batchKey returns the key used to match a response in a batch to its request.
+// IDs are compared using their JSON encoding, because numeric IDs are decoded
+// as floats.
+func batchKey(id interface{}) string {
+	data, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprintf("%v", id)
+	}
+	return string(data)
+}
+
 // send the request without retrying.
 func (c Client) send(r *http.Request) (jsonrpc.Response, error) {
 	response, err := c.Do(r)
@@ -2,6 +2,8 @@ package http_test
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"testing/quick"
 	"time"
@@ -67,4 +69,46 @@ var _ = Describe("Client", func() {
 			Expect(err).Should(HaveOccurred())
 		})
 	})
+
+	Context("when sending batches", func() {
+		It("should match the responses to the requests", func() {
+			client := NewClient(DefaultClientTimeout)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var requests []jsonrpc.Request
+				Expect(json.NewDecoder(r.Body).Decode(&requests)).To(Succeed())
+
+				// Respond in reverse order and skip the first request.
+				responses := []jsonrpc.Response{}
+				for i := len(requests) - 1; i > 0; i-- {
+					responses = append(responses, jsonrpc.NewResponse(requests[i].ID, requests[i].Method, nil))
+				}
+				Expect(json.NewEncoder(w).Encode(responses)).To(Succeed())
+			}))
+			defer server.Close()
+
+			requests := make([]jsonrpc.Request, 3)
+			for i := range requests {
+				requests[i] = RandomRequest(RandomMethod())
+				requests[i].ID = i
+			}
+			responses, err := client.SendBatch(context.Background(), server.URL, requests)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(responses).To(HaveLen(len(requests)))
+			Expect(responses[0].Error).ToNot(BeNil())
+			for i := 1; i < len(requests); i++ {
+				Expect(responses[i].Error).To(BeNil())
+				Expect(responses[i].Result).To(Equal(requests[i].Method))
+			}
+		})
+
+		It("should return an error if the batch is rejected", func() {
+			client := NewClient(DefaultClientTimeout)
+			server := httptest.NewServer(SimpleHandler(true, nil))
+			defer server.Close()
+
+			requests := []jsonrpc.Request{RandomRequest(RandomMethod()), RandomRequest(RandomMethod())}
+			_, err := client.SendBatch(context.Background(), server.URL, requests)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
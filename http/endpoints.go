@@ -0,0 +1,119 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/renproject/aw/wire"
+)
+
+// EndpointOptions are used to configure how the JSON-RPC endpoints of the
+// Darknodes are resolved and connected to.
+type EndpointOptions struct {
+	// URLs maps Darknodes, identified either by their signatory or by the
+	// value of their multi-address, to an explicit JSON-RPC URL.
+	URLs map[string]string
+	// CAFile is a PEM bundle of certificate authorities that are trusted in
+	// addition to the system ones.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and key
+	// used for mutual TLS.
+	CertFile string
+	KeyFile  string
+}
+
+// Endpoints resolves the JSON-RPC URLs of Darknodes from their multi-addresses
+// and constructs clients that can connect to them. Darknodes without an
+// explicit URL are assumed to serve JSON-RPC over HTTP on the port after their
+// P2P port. The zero value only uses this convention.
+type Endpoints struct {
+	urls      map[string]string
+	tlsConfig *tls.Config
+}
+
+// NewEndpoints returns new `Endpoints` with the given options. It returns an
+// error if the URLs or TLS files are invalid.
+func NewEndpoints(options EndpointOptions) (Endpoints, error) {
+	urls := make(map[string]string, len(options.URLs))
+	for peer, rawURL := range options.URLs {
+		if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+			return Endpoints{}, fmt.Errorf("invalid url for %v: %v", peer, rawURL)
+		}
+		urls[peer] = rawURL
+	}
+
+	if options.CAFile == "" && options.CertFile == "" && options.KeyFile == "" {
+		return Endpoints{urls: urls}, nil
+	}
+	tlsConfig := &tls.Config{}
+	if options.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return Endpoints{}, fmt.Errorf("reading ca file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return Endpoints{}, fmt.Errorf("no certificates found in %v", options.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return Endpoints{}, fmt.Errorf("loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return Endpoints{
+		urls:      urls,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+// URL returns the JSON-RPC URL of the Darknode with the given multi-address.
+func (endpoints Endpoints) URL(addr wire.Address) (string, error) {
+	if signatory, err := addr.Signatory(); err == nil {
+		if url, ok := endpoints.urls[signatory.String()]; ok {
+			return url, nil
+		}
+	}
+	if url, ok := endpoints.urls[addr.Value]; ok {
+		return url, nil
+	}
+
+	host, portString, err := net.SplitHostPort(addr.Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid address value=%v: %v", addr.Value, err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", fmt.Errorf("invalid port=%v: %v", portString, err)
+	}
+	return fmt.Sprintf("http://%v", net.JoinHostPort(host, strconv.Itoa(port+1))), nil
+}
+
+// NewClient returns a new client with the given timeout that uses the
+// configured certificate authorities and client certificate.
+func (endpoints Endpoints) NewClient(timeout time.Duration) Client {
+	if endpoints.tlsConfig == nil {
+		return NewClient(timeout)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = endpoints.tlsConfig.Clone()
+	return Client{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package http_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/renproject/lightnode/http"
+
+	"github.com/renproject/aw/wire"
+)
+
+var _ = Describe("Darknode endpoints", func() {
+	Context("when no url has been configured for a darknode", func() {
+		It("should use the port after the p2p port", func() {
+			endpoints := Endpoints{}
+			url, err := endpoints.URL(wire.Address{Value: "127.0.0.1:18514"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("http://127.0.0.1:18515"))
+		})
+
+		It("should support ipv6 addresses", func() {
+			endpoints := Endpoints{}
+			url, err := endpoints.URL(wire.Address{Value: "[::1]:18514"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("http://[::1]:18515"))
+		})
+
+		It("should return an error for invalid addresses", func() {
+			endpoints := Endpoints{}
+			_, err := endpoints.URL(wire.Address{Value: "127.0.0.1"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when a url has been configured for a darknode", func() {
+		It("should use the configured url", func() {
+			endpoints, err := NewEndpoints(EndpointOptions{
+				URLs: map[string]string{"127.0.0.1:18514": "https://darknode.example.com/rpc"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			url, err := endpoints.URL(wire.Address{Value: "127.0.0.1:18514"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("https://darknode.example.com/rpc"))
+
+			url, err = endpoints.URL(wire.Address{Value: "127.0.0.2:18514"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(url).To(Equal("http://127.0.0.2:18515"))
+		})
+
+		It("should reject urls without an http scheme", func() {
+			_, err := NewEndpoints(EndpointOptions{
+				URLs: map[string]string{"127.0.0.1:18514": "darknode.example.com"},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when the tls files do not exist", func() {
+		It("should return an error", func() {
+			_, err := NewEndpoints(EndpointOptions{CAFile: "does-not-exist.pem"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
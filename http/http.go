@@ -7,6 +7,13 @@ import (
 	"github.com/renproject/darknode/jsonrpc"
 )
 
+// Admin callers can set the debug query parameter to `DebugPeers` to receive
+// the response of every Darknode instead of only the combined response.
+const (
+	QueryKeyDebug = "debug"
+	DebugPeers    = "peers"
+)
+
 type RequestWithResponder struct {
 	Context   context.Context
 	ID        interface{}
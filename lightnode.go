@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/go-redis/redis/v7"
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/jsonrpc"
@@ -15,6 +18,8 @@ import (
 	"github.com/renproject/lightnode/confirmer"
 	"github.com/renproject/lightnode/db"
 	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/distkey"
+	"github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/resolver"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/updater"
@@ -36,7 +41,12 @@ type Lightnode struct {
 	server    *jsonrpc.Server
 	updater   updater.Updater
 	confirmer confirmer.Confirmer
-	watchers  map[multichain.Chain]map[multichain.Asset]watcher.Watcher
+	watchers  *watcherSet
+	config    *configRefresher
+
+	// subscriptions are the WebSocket subscriptions of the EVM chains, which
+	// are shared by the watchers of their gateways.
+	subscriptions []watcher.EthChainSubscription
 
 	// Tasks
 	cacher     phi.Task
@@ -77,7 +87,23 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 
 	// Initialise the multi-address store.
 	table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
-	multiStore := store.New(table, options.BootstrapAddrs)
+	multiStore, err := store.NewPersistent(logger, table, options.BootstrapAddrs, db, options.PeerExpiry)
+	if err != nil {
+		logger.Panicf("failed to load multi-address store: %v", err)
+	}
+
+	// Restore the health of the Darknodes from before the restart.
+	health := dispatcher.NewHealthTracker(dispatcher.DefaultHealthDecay, dispatcher.DefaultHealthExploration)
+	peers, err := multiStore.Health()
+	if err != nil {
+		logger.Panicf("failed to load darknode health: %v", err)
+	}
+	for _, peer := range peers {
+		health.Restore(peer.Signatory, dispatcher.PeerHealth{
+			Latency: peer.Latency,
+			Errors:  peer.Errors,
+		})
+	}
 
 	// Initialise the blockchain adapter.
 	bindingsOpts := binding.DefaultOptions().
@@ -108,8 +134,56 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 	// ==== END GROSS HACK
 	//
 
-	updater := updater.New(logger, multiStore, options.UpdaterPollRate, options.ClientTimeout)
-	dispatcher := dispatcher.New(logger, options.ClientTimeout, multiStore, opts)
+	// Initialise the circuit breakers shared by everything that sends requests
+	// to the Darknodes.
+	breakers := http.NewBreakers(logger, http.BreakerOptions{
+		FailureThreshold: options.BreakerFailureThreshold,
+		Cooldown:         options.BreakerCooldown,
+	})
+	endpoints, err := http.NewEndpoints(options.Endpoints)
+	if err != nil {
+		logger.Panicf("invalid darknode endpoints: %v", err)
+	}
+
+	// Shard membership is only tracked if requests are routed to shards.
+	var routing *dispatcher.RoutingTable
+	if options.DispatchPolicies.Uses(dispatcher.PeerSetShard) {
+		routing = dispatcher.NewRoutingTable()
+	}
+
+	// Follow the distributed public key of the primary shard, starting with
+	// the configured key.
+	distPubKey := distkey.NewTracker(logger, options.DistPubKey, distkey.DefaultQuorum)
+	updater := updater.New(
+		updater.DefaultOptions().
+			WithLogger(logger).
+			WithPollRate(options.UpdaterPollRate).
+			WithProbeRate(options.UpdaterProbeRate).
+			WithProbeFailureThreshold(options.ProbeFailureThreshold).
+			WithCrawlDepth(options.CrawlDepth).
+			WithCrawlBudget(options.CrawlBudget).
+			WithTimeout(options.ClientTimeout).
+			WithEndpoints(endpoints).
+			WithHealth(health).
+			WithRouting(routing).
+			WithDistPubKey(distPubKey),
+		multiStore,
+		breakers,
+	)
+	dispatcher := dispatcher.New(
+		dispatcher.DefaultOptions().
+			WithLogger(logger).
+			WithTimeout(options.ClientTimeout).
+			WithPolicies(options.DispatchPolicies).
+			WithEndpoints(endpoints).
+			WithBatchWindow(options.DispatchBatchWindow).
+			WithMaxBatchSize(options.MaxBatchSize).
+			WithHealth(health).
+			WithRouting(routing),
+		multiStore,
+		breakers,
+		opts,
+	)
 	ttlCache := kv.NewTTLCache(ctx, kv.NewMemDB(kv.JSONCodec), "cacher", options.TTL)
 	cacher := cacher.New(dispatcher, logger, ttlCache, opts, db)
 
@@ -121,14 +195,18 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 		}
 	}
 	verifier := resolver.NewVerifier(hostChains, verifierBindings)
-	resolverI := resolver.New(options.Network, logger, cacher, multiStore, db, serverOptions, compatStore, bindings, verifier)
+
+	// The watchers are registered once the resolver they submit burns to has
+	// been created, but the resolver needs them to backfill burns.
+	watchers := newWatcherSet(logger, options.Whitelist)
+	resolverI := resolver.New(options.Network, logger, cacher, multiStore, db, serverOptions, compatStore, bindings, verifier, options.AdminToken, watchers)
 	limiter := resolver.NewRateLimiter(resolver.RateLimiterConf{
 		GlobalMethodRate: options.LimiterGlobalRates,
 		IpMethodRate:     options.LimiterIPRates,
 		Ttl:              options.LimiterTTL,
 		MaxClients:       options.LimiterMaxClients,
 	})
-	server := jsonrpc.NewServer(serverOptions, resolverI, resolver.NewValidator(verifierBindings, options.DistPubKey, compatStore, &limiter, logger))
+	server := jsonrpc.NewServer(serverOptions, resolverI, resolver.NewValidator(verifierBindings, distPubKey, compatStore, &limiter, logger))
 	confirmer := confirmer.New(
 		confirmer.DefaultOptions().
 			WithLogger(logger).
@@ -139,52 +217,119 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 		bindings,
 	)
 
-	whitelistMap := map[tx.Selector]bool{}
-	for _, i := range options.Whitelist {
-		whitelistMap[i] = true
-	}
-
-	watchers := map[multichain.Chain]map[multichain.Asset]watcher.Watcher{}
-
+	// Register a watcher for every gateway, so that watchers can be started
+	// and stopped as selectors are added to or removed from the whitelist.
 	// Ethereum watchers
 	ethGateways := bindings.EthereumGateways()
 	ethClients := bindings.EthereumClients()
-	for chain, contracts := range ethGateways {
-		for asset, bindings := range contracts {
-			selector := tx.Selector(fmt.Sprintf("%v/from%v", asset, chain))
-			if !whitelistMap[selector] {
-				logger.Info("not watching", selector)
+
+	// Scan the head and the burn logs of each EVM chain once for all of its
+	// gateways. Chains with several RPC endpoints have a fetcher for each of
+	// them, which the watchers fail over between.
+	contractGateways := bindings.ContractGateways()
+	chainFetchers := map[multichain.Chain][]watcher.EthChainFetcher{}
+	chainRPCNames := map[multichain.Chain][]string{}
+	for chain := range ethGateways {
+		chainFetchers[chain] = []watcher.EthChainFetcher{watcher.NewEthChainFetcher(ethClients[chain], options.WatcherPollRate, options.WatcherConfidenceInterval, options.WatcherMaxBlockAdvance)}
+		chainRPCNames[chain] = []string{rpcName(bindingsOpts.Chains[chain].RPC.String())}
+		rpcs := options.WatcherRPCs[chain]
+		for i := 1; i < len(rpcs); i++ {
+			ethClient, err := ethclient.Dial(rpcs[i])
+			if err != nil {
+				logger.Errorf("[watcher] cannot connect to %v rpc %v: %v", chain, rpcName(rpcs[i]), err)
 				continue
 			}
-			if watchers[chain] == nil {
-				watchers[chain] = map[multichain.Asset]watcher.Watcher{}
+			chainFetchers[chain] = append(chainFetchers[chain], watcher.NewEthChainFetcher(ethClient, options.WatcherPollRate, options.WatcherConfidenceInterval, options.WatcherMaxBlockAdvance))
+			chainRPCNames[chain] = append(chainRPCNames[chain], rpcName(rpcs[i]))
+		}
+	}
+
+	// Subscribe to the new blocks and the burn logs of the EVM chains with a
+	// WebSocket endpoint once for all of their gateways, so that their
+	// watchers are notified of new blocks.
+	subscriptions := map[multichain.Chain]watcher.EthChainSubscription{}
+	for chain, wsURL := range options.WatcherSubscriptionURLs {
+		chainOpts, ok := bindingsOpts.Chains[chain]
+		if !ok {
+			continue
+		}
+		chainOpts.RPC = pack.String(wsURL)
+		subscriptionOpts := binding.DefaultOptions().
+			WithNetwork(options.Network).
+			WithChainOptions(chain, chainOpts)
+		addresses := []common.Address{}
+		for _, address := range contractGateways[chain] {
+			if common.IsHexAddress(string(address)) {
+				addresses = append(addresses, common.HexToAddress(string(address)))
 			}
-			burnLogFetcher := watcher.NewEthBurnLogFetcher(bindings)
-			blockHeightFetcher := watcher.NewEthBlockHeightFetcher(ethClients[chain])
-			watchers[chain][selector.Asset()] = watcher.NewWatcher(logger, options.Network, selector, verifierBindings, burnLogFetcher, blockHeightFetcher, resolverI, client, options.DistPubKey, options.WatcherPollRate, options.WatcherMaxBlockAdvance, options.WatcherConfidenceInterval)
-			logger.Info("watching", selector)
+		}
+		subscriptions[chain] = watcher.NewEthChainSubscription(logger, string(chain), binding.New(subscriptionOpts).EthereumClients()[chain], addresses)
+	}
+
+	for chain, contracts := range ethGateways {
+		chain := chain
+		for asset, bindings := range contracts {
+			asset, bindings := asset, bindings
+			selector := tx.Selector(fmt.Sprintf("%v/from%v", asset, chain))
+			watchers.add(selector, func(backfill bool) watcher.Watcher {
+				var burnLogFetcher watcher.BurnLogFetcher = watcher.NewEthBurnLogFetcher(bindings)
+				var blockHeightFetcher watcher.BlockHeightFetcher = watcher.NewEthBlockHeightFetcher(ethClients[chain])
+				if address := string(contractGateways[chain][asset]); common.IsHexAddress(address) {
+					endpoints := []watcher.Endpoint{}
+					for i, chainFetcher := range chainFetchers[chain] {
+						gatewayFetcher := chainFetcher.Gateway(common.HexToAddress(address), bindings)
+						if backfill {
+							gatewayFetcher = chainFetcher.BackfillGateway(common.HexToAddress(address), bindings)
+						}
+						endpoints = append(endpoints, watcher.Endpoint{
+							Name:               chainRPCNames[chain][i],
+							BurnLogFetcher:     gatewayFetcher,
+							BlockHeightFetcher: gatewayFetcher,
+						})
+					}
+					burnLogFetcher, blockHeightFetcher = endpoints[0].BurnLogFetcher, endpoints[0].BlockHeightFetcher
+					if len(endpoints) > 1 {
+						fetcher := watcher.NewFailoverFetcher(logger, string(chain), endpoints, options.WatcherMaxHeadLag)
+						burnLogFetcher, blockHeightFetcher = fetcher, fetcher
+					}
+				} else {
+					logger.Warnf("[watcher] unknown gateway address for %v, fetching its burns separately", selector)
+				}
+				// Backfills only scan old blocks, which are never served from
+				// the subscription.
+				if subscription, ok := subscriptions[chain]; ok && !backfill {
+					address := common.HexToAddress(string(contractGateways[chain][asset]))
+					if fetcher, ok := subscription.Gateway(address, burnLogFetcher, blockHeightFetcher); ok {
+						burnLogFetcher, blockHeightFetcher = fetcher, fetcher
+					}
+				}
+				return watcher.NewWatcher(logger, options.Network, selector, verifierBindings, burnLogFetcher, blockHeightFetcher, resolverI, client, db, distPubKey, options.WatcherPollRate, options.WatcherMaxBlockAdvance, options.WatcherConfidenceInterval)
+			})
 		}
 	}
 
 	// Solana watchers
-	solanaGateways := bindings.ContractGateways()[multichain.Solana]
-	solClient := solanaRPC.NewClient(bindingsOpts.Chains[multichain.Solana].RPC.String())
+	solanaGateways := contractGateways[multichain.Solana]
+	solRPC := bindingsOpts.Chains[multichain.Solana].RPC.String()
+	solClient := solanaRPC.NewClient(solRPC)
 	for asset, bindings := range solanaGateways {
+		bindings := bindings
 		chain := multichain.Solana
 		selector := tx.Selector(fmt.Sprintf("%v/from%v", asset, chain))
-		if !whitelistMap[selector] {
-			logger.Info("not watching ", selector)
-			continue
-		}
-		if watchers[chain] == nil {
-			watchers[chain] = map[multichain.Asset]watcher.Watcher{}
-		}
-		solanaFetcher := watcher.NewSolFetcher(solClient, string(bindings))
-		watchers[chain][selector.Asset()] = watcher.NewWatcher(logger, options.Network, selector, verifierBindings, solanaFetcher, solanaFetcher, resolverI, client, options.DistPubKey, options.WatcherPollRate, options.WatcherMaxBlockAdvance, options.WatcherConfidenceInterval)
-		logger.Info("watching ", selector)
-		logger.Info("at ", bindings)
+		watchers.add(selector, func(backfill bool) watcher.Watcher {
+			logger.Info("at ", bindings)
+			solanaFetcher := watcher.NewSolFetcher(solClient, solRPC, db, selector, string(bindings), options.SolanaGatewayStateSeeds[string(bindings)])
+			return watcher.NewWatcher(logger, options.Network, selector, verifierBindings, solanaFetcher, solanaFetcher, resolverI, client, db, distPubKey, options.WatcherPollRate, options.WatcherMaxBlockAdvance, options.WatcherConfidenceInterval)
+		})
 	}
 
+	chainSubscriptions := make([]watcher.EthChainSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		chainSubscriptions = append(chainSubscriptions, subscription)
+	}
+
+	configRefresher := newConfigRefresher(options, logger, endpoints, watchers, confirmer)
+
 	return Lightnode{
 		options:    options,
 		logger:     logger,
@@ -195,6 +340,9 @@ func New(options Options, ctx context.Context, logger logrus.FieldLogger, sqlDB
 		server:     server,
 		confirmer:  confirmer,
 		watchers:   watchers,
+		config:     configRefresher,
+
+		subscriptions: chainSubscriptions,
 	}
 }
 
@@ -206,11 +354,21 @@ func (lightnode Lightnode) Run(ctx context.Context) {
 
 	// Note: the following should be disabled when running locally.
 	go lightnode.confirmer.Run(ctx)
-	for _, assetMap := range lightnode.watchers {
-		for _, watcher := range assetMap {
-			go watcher.Run(ctx)
-		}
+	for _, subscription := range lightnode.subscriptions {
+		go subscription.Run(ctx)
 	}
+	lightnode.watchers.Run(ctx)
+	go lightnode.config.Run(ctx)
 
 	lightnode.server.Listen(ctx, fmt.Sprintf(":%s", lightnode.options.Port))
 }
+
+// rpcName returns the host of the RPC endpoint, which identifies the endpoint
+// in logs without leaking any API keys in its path or query.
+func rpcName(rpc string) string {
+	u, err := url.Parse(rpc)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
@@ -8,7 +8,11 @@ import (
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	"github.com/renproject/lightnode/confirmer"
+	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/resolver"
+	"github.com/renproject/lightnode/updater"
+	"github.com/renproject/lightnode/watcher"
 	"github.com/renproject/multichain"
 	"golang.org/x/time/rate"
 )
@@ -23,16 +27,28 @@ var (
 	DefaultClientTimeout             = 15 * time.Second
 	DefaultTTL                       = 3 * time.Second
 	DefaultUpdaterPollRate           = 5 * time.Minute
+	DefaultUpdaterProbeRate          = updater.DefaultProbeRate
+	DefaultProbeFailureThreshold     = updater.DefaultProbeFailureThreshold
+	DefaultCrawlDepth                = updater.DefaultCrawlDepth
+	DefaultCrawlBudget               = updater.DefaultCrawlBudget
 	DefaultConfirmerPollRate         = confirmer.DefaultPollInterval
 	DefaultWatcherPollRate           = 15 * time.Second
 	DefaultWatcherMaxBlockAdvance    = uint64(1000)
 	DefaultWatcherConfidenceInterval = uint64(6)
+	DefaultWatcherMaxHeadLag         = watcher.DefaultMaxHeadLag
 	DefaultTransactionExpiry         = confirmer.DefaultExpiry
 	DefaultBootstrapAddrs            = []wire.Address{}
 	DefaultLimiterIPRates            = map[string]rate.Limit{"fallback": resolver.LimiterDefaultIPRate}
 	DefaultLimiterGlobalRates        = map[string]rate.Limit{"fallback": resolver.LimiterDefaultGlobalRate}
 	DefaultLimiterTTL                = resolver.LimiterDefaultTTL
 	DefaultLimiterMaxClients         = resolver.LimiterDefaultMaxClients
+	DefaultDispatchPolicies          = dispatcher.DefaultPolicies
+	DefaultBreakerFailureThreshold   = http.DefaultBreakerFailureThreshold
+	DefaultBreakerCooldown           = http.DefaultBreakerCooldown
+	DefaultDispatchBatchWindow       = dispatcher.DefaultBatchWindow
+	DefaultPeerExpiry                = 24 * time.Hour
+	DefaultConfigRefreshRate         = 10 * time.Minute
+	DefaultConfigQuorum              = 2
 )
 
 // Options to configure the precise behaviour of the Lightnode.
@@ -47,6 +63,10 @@ type Options struct {
 	ClientTimeout             time.Duration
 	TTL                       time.Duration
 	UpdaterPollRate           time.Duration
+	UpdaterProbeRate          time.Duration
+	ProbeFailureThreshold     int
+	CrawlDepth                int
+	CrawlBudget               int
 	ConfirmerPollRate         time.Duration
 	WatcherPollRate           time.Duration
 	WatcherMaxBlockAdvance    uint64
@@ -59,6 +79,19 @@ type Options struct {
 	LimiterIPRates            map[string]rate.Limit
 	LimiterTTL                time.Duration
 	LimiterMaxClients         int
+	DispatchPolicies          dispatcher.Policies
+	BreakerFailureThreshold   int
+	BreakerCooldown           time.Duration
+	AdminToken                string
+	Endpoints                 http.EndpointOptions
+	DispatchBatchWindow       time.Duration
+	PeerExpiry                time.Duration
+	ConfigRefreshRate         time.Duration
+	ConfigQuorum              int
+	SolanaGatewayStateSeeds   map[string]string
+	WatcherRPCs               map[multichain.Chain][]string
+	WatcherMaxHeadLag         uint64
+	WatcherSubscriptionURLs   map[multichain.Chain]string
 }
 
 // DefaultOptions returns new options with default configurations that should
@@ -74,6 +107,10 @@ func DefaultOptions() Options {
 		ClientTimeout:             DefaultClientTimeout,
 		TTL:                       DefaultTTL,
 		UpdaterPollRate:           DefaultUpdaterPollRate,
+		UpdaterProbeRate:          DefaultUpdaterProbeRate,
+		ProbeFailureThreshold:     DefaultProbeFailureThreshold,
+		CrawlDepth:                DefaultCrawlDepth,
+		CrawlBudget:               DefaultCrawlBudget,
 		ConfirmerPollRate:         DefaultConfirmerPollRate,
 		WatcherPollRate:           DefaultWatcherPollRate,
 		WatcherMaxBlockAdvance:    DefaultWatcherMaxBlockAdvance,
@@ -83,6 +120,17 @@ func DefaultOptions() Options {
 		LimiterGlobalRates:        DefaultLimiterGlobalRates,
 		LimiterIPRates:            DefaultLimiterIPRates,
 		LimiterMaxClients:         DefaultLimiterMaxClients,
+		DispatchPolicies:          DefaultDispatchPolicies,
+		BreakerFailureThreshold:   DefaultBreakerFailureThreshold,
+		BreakerCooldown:           DefaultBreakerCooldown,
+		DispatchBatchWindow:       DefaultDispatchBatchWindow,
+		PeerExpiry:                DefaultPeerExpiry,
+		ConfigRefreshRate:         DefaultConfigRefreshRate,
+		ConfigQuorum:              DefaultConfigQuorum,
+		SolanaGatewayStateSeeds:   map[string]string{},
+		WatcherRPCs:               map[multichain.Chain][]string{},
+		WatcherMaxHeadLag:         DefaultWatcherMaxHeadLag,
+		WatcherSubscriptionURLs:   map[multichain.Chain]string{},
 	}
 }
 
@@ -220,3 +268,126 @@ func (opts Options) WithLimiterMaxClients(maxClients int) Options {
 	opts.LimiterMaxClients = maxClients
 	return opts
 }
+
+// WithDispatchPolicies is used to set which Darknodes each method is sent to
+// and how their responses are combined.
+func (opts Options) WithDispatchPolicies(policies dispatcher.Policies) Options {
+	opts.DispatchPolicies = policies
+	return opts
+}
+
+// WithBreakerFailureThreshold updates the number of consecutive failures after
+// which requests to a Darknode are stopped.
+func (opts Options) WithBreakerFailureThreshold(threshold int) Options {
+	opts.BreakerFailureThreshold = threshold
+	return opts
+}
+
+// WithBreakerCooldown updates how long requests to a failing Darknode are
+// stopped for before it is probed again.
+func (opts Options) WithBreakerCooldown(cooldown time.Duration) Options {
+	opts.BreakerCooldown = cooldown
+	return opts
+}
+
+// WithAdminToken updates the token used to authenticate admin callers. Admin
+// features are disabled if the token is empty.
+func (opts Options) WithAdminToken(token string) Options {
+	opts.AdminToken = token
+	return opts
+}
+
+// WithEndpoints updates how the JSON-RPC endpoints of the Darknodes are
+// resolved, and the TLS files used to connect to them.
+func (opts Options) WithEndpoints(endpoints http.EndpointOptions) Options {
+	opts.Endpoints = endpoints
+	return opts
+}
+
+// WithDispatchBatchWindow updates how long requests for the same Darknode are
+// collected before being forwarded as a single batch. Zero disables batching.
+func (opts Options) WithDispatchBatchWindow(window time.Duration) Options {
+	opts.DispatchBatchWindow = window
+	return opts
+}
+
+// WithPeerExpiry updates how long a Darknode that has not been seen is kept
+// in the persisted multi-address store.
+func (opts Options) WithPeerExpiry(expiry time.Duration) Options {
+	opts.PeerExpiry = expiry
+	return opts
+}
+
+// WithUpdaterProbeRate updates how often the liveness of the Darknodes is
+// probed. Zero disables probing.
+func (opts Options) WithUpdaterProbeRate(probeRate time.Duration) Options {
+	opts.UpdaterProbeRate = probeRate
+	return opts
+}
+
+// WithProbeFailureThreshold updates the number of consecutive failed probes
+// after which a Darknode is evicted.
+func (opts Options) WithProbeFailureThreshold(threshold int) Options {
+	opts.ProbeFailureThreshold = threshold
+	return opts
+}
+
+// WithCrawlDepth updates how many hops beyond the Bootstrap nodes are crawled
+// to discover Darknodes. Zero only queries the Bootstrap nodes.
+func (opts Options) WithCrawlDepth(depth int) Options {
+	opts.CrawlDepth = depth
+	return opts
+}
+
+// WithCrawlBudget updates the maximum number of discovered Darknodes queried
+// for their peers during each poll.
+func (opts Options) WithCrawlBudget(budget int) Options {
+	opts.CrawlBudget = budget
+	return opts
+}
+
+// WithConfigRefreshRate updates the rate at which the config is fetched from
+// the bootstrap nodes and applied while the Lightnode is running.
+func (opts Options) WithConfigRefreshRate(refreshRate time.Duration) Options {
+	opts.ConfigRefreshRate = refreshRate
+	return opts
+}
+
+// WithConfigQuorum updates the number of bootstrap nodes that must agree on a
+// config before it is applied.
+func (opts Options) WithConfigQuorum(quorum int) Options {
+	opts.ConfigQuorum = quorum
+	return opts
+}
+
+// WithSolanaGatewayStateSeeds updates the seeds of the state accounts of the
+// Solana gateways, keyed by the address of the gateway. The seed depends on the
+// version of the gateway, and gateways without a seed use the seed of the
+// current version.
+func (opts Options) WithSolanaGatewayStateSeeds(seeds map[string]string) Options {
+	opts.SolanaGatewayStateSeeds = seeds
+	return opts
+}
+
+// WithWatcherRPCs updates the RPC endpoints of the EVM chains that the
+// watchers fail over between, in order of preference.
+func (opts Options) WithWatcherRPCs(rpcs map[multichain.Chain][]string) Options {
+	opts.WatcherRPCs = rpcs
+	return opts
+}
+
+// WithWatcherMaxHeadLag updates how many blocks an RPC endpoint can be behind
+// or ahead of the other endpoints of the same chain before the watchers ignore
+// it.
+func (opts Options) WithWatcherMaxHeadLag(maxLag uint64) Options {
+	opts.WatcherMaxHeadLag = maxLag
+	return opts
+}
+
+// WithWatcherSubscriptionURLs updates the WebSocket endpoints of the EVM
+// chains that the watchers subscribe to for new blocks and burn logs. Chains
+// without an endpoint are only polled.
+func (opts Options) WithWatcherSubscriptionURLs(urls map[multichain.Chain]string) Options {
+	opts.WatcherSubscriptionURLs = urls
+	return opts
+}
@@ -0,0 +1,39 @@
+package resolver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+
+	lhttp "github.com/renproject/lightnode/http"
+)
+
+// isAdmin returns whether the request was made by an admin caller. Admin
+// callers authenticate by sending the admin token as a bearer token in the
+// Authorization header. If no admin token is configured, there are no admin
+// callers.
+func (resolver *Resolver) isAdmin(r *http.Request) bool {
+	if resolver.adminToken == "" || r == nil {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(resolver.adminToken)) == 1
+}
+
+// query returns the query parameters of the request. Parameters reserved for
+// admin callers are removed if the caller is not an admin.
+func (resolver *Resolver) query(r *http.Request) url.Values {
+	if r == nil {
+		return url.Values{}
+	}
+	query := r.URL.Query()
+	if !resolver.isAdmin(r) {
+		query.Del(lhttp.QueryKeyDebug)
+	}
+	return query
+}
@@ -0,0 +1,188 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// Enumerate default backfill options.
+var (
+	// DefaultBackfillTimeout is how long a backfill job can run before it is
+	// cancelled.
+	DefaultBackfillTimeout = time.Hour
+
+	// DefaultBackfillRetention is how long the result of a backfill job is
+	// kept after it has finished.
+	DefaultBackfillRetention = 24 * time.Hour
+)
+
+// MethodBackfillWatcher is the admin method that starts re-scanning a range of
+// blocks for the burns of a selector.
+const MethodBackfillWatcher = "ren_backfillWatcher"
+
+// MethodQueryBackfill is the admin method that reports the progress of a
+// backfill job.
+const MethodQueryBackfill = "ren_queryBackfill"
+
+// ParamsBackfillWatcher are the parameters of the `ren_backfillWatcher`
+// method. The range of blocks is inclusive.
+type ParamsBackfillWatcher struct {
+	Selector tx.Selector `json:"selector"`
+	From     pack.U64    `json:"from"`
+	To       pack.U64    `json:"to"`
+}
+
+// ParamsQueryBackfill are the parameters of the `ren_queryBackfill` method.
+type ParamsQueryBackfill struct {
+	Job string `json:"job"`
+}
+
+// BackfillJobStatus is the status of a backfill job.
+type BackfillJobStatus string
+
+// Enumerate the statuses of a backfill job.
+const (
+	BackfillJobRunning = BackfillJobStatus("running")
+	BackfillJobDone    = BackfillJobStatus("done")
+	BackfillJobFailed  = BackfillJobStatus("failed")
+)
+
+// BackfillJob is a backfill that runs in the background. It is returned by
+// both the `ren_backfillWatcher` and `ren_queryBackfill` methods.
+type BackfillJob struct {
+	ID         string                  `json:"id"`
+	Selector   tx.Selector             `json:"selector"`
+	From       pack.U64                `json:"from"`
+	To         pack.U64                `json:"to"`
+	Status     BackfillJobStatus       `json:"status"`
+	Error      string                  `json:"error,omitempty"`
+	Result     *watcher.BackfillResult `json:"result,omitempty"`
+	StartedAt  time.Time               `json:"startedAt"`
+	FinishedAt time.Time               `json:"finishedAt,omitempty"`
+}
+
+// backfillJobs runs backfills in the background, so that they are not bound
+// by the timeout of the request that started them, and keeps their results
+// until they are queried. It is safe for concurrent use.
+type backfillJobs struct {
+	logger    logrus.FieldLogger
+	timeout   time.Duration
+	retention time.Duration
+
+	mu     *sync.Mutex
+	nextID uint64
+	jobs   map[string]*BackfillJob
+}
+
+func newBackfillJobs(logger logrus.FieldLogger, timeout, retention time.Duration) *backfillJobs {
+	return &backfillJobs{
+		logger:    logger,
+		timeout:   timeout,
+		retention: retention,
+		mu:        new(sync.Mutex),
+		jobs:      map[string]*BackfillJob{},
+	}
+}
+
+// start runs the backfill in the background and returns the job tracking it.
+func (jobs *backfillJobs) start(watchers Watchers, params ParamsBackfillWatcher) BackfillJob {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	// Forget the jobs that finished a while ago.
+	now := time.Now()
+	for id, job := range jobs.jobs {
+		if job.Status != BackfillJobRunning && now.Sub(job.FinishedAt) > jobs.retention {
+			delete(jobs.jobs, id)
+		}
+	}
+
+	jobs.nextID++
+	job := &BackfillJob{
+		ID:        strconv.FormatUint(jobs.nextID, 10),
+		Selector:  params.Selector,
+		From:      params.From,
+		To:        params.To,
+		Status:    BackfillJobRunning,
+		StartedAt: now,
+	}
+	jobs.jobs[job.ID] = job
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), jobs.timeout)
+		defer cancel()
+
+		result, err := watchers.Backfill(ctx, params.Selector, uint64(params.From), uint64(params.To))
+
+		jobs.mu.Lock()
+		defer jobs.mu.Unlock()
+
+		job.FinishedAt = time.Now()
+		if err != nil {
+			jobs.logger.Errorf("[responder] failed to backfill %v from=%v to=%v: %v", params.Selector, params.From, params.To, err)
+			job.Status = BackfillJobFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = BackfillJobDone
+		job.Result = &result
+	}()
+	return *job
+}
+
+// get returns the job with the given ID.
+func (jobs *backfillJobs) get(id string) (BackfillJob, bool) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	job, ok := jobs.jobs[id]
+	if !ok {
+		return BackfillJob{}, false
+	}
+	return *job, true
+}
+
+// BackfillWatcher starts re-scanning a range of blocks for the burns of a
+// selector in the background, submitting the burns that have not been seen
+// before, and returns the job tracking it. It can only be called by admin
+// callers.
+func (resolver *Resolver) BackfillWatcher(ctx context.Context, id interface{}, params *ParamsBackfillWatcher, req *http.Request) jsonrpc.Response {
+	if !resolver.isAdmin(req) {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidRequest, "unauthorized", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if resolver.watchers == nil {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "backfilling is not supported", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	if params.To < params.From {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("invalid range from=%v to=%v", params.From, params.To), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	return jsonrpc.NewResponse(id, resolver.backfills.start(resolver.watchers, *params), nil)
+}
+
+// QueryBackfill returns the progress of a backfill job, along with its result
+// once it has finished. It can only be called by admin callers.
+func (resolver *Resolver) QueryBackfill(ctx context.Context, id interface{}, params *ParamsQueryBackfill, req *http.Request) jsonrpc.Response {
+	if !resolver.isAdmin(req) {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidRequest, "unauthorized", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	job, ok := resolver.backfills.get(params.Job)
+	if !ok {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInvalidParams, fmt.Sprintf("unknown backfill job %v", params.Job), nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	return jsonrpc.NewResponse(id, job, nil)
+}
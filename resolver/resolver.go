@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
-	"net/url"
 
 	"github.com/btcsuite/btcutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -42,10 +41,13 @@ type Resolver struct {
 	serverOptions     jsonrpc.Options
 	compatStore       v0.CompatStore
 	bindings          binding.Bindings
+	adminToken        string
+	watchers          Watchers
+	backfills         *backfillJobs
 }
 
 func New(network multichain.Network, logger logrus.FieldLogger, cacher phi.Task, multiStore store.MultiAddrStore, db db.DB,
-	serverOptions jsonrpc.Options, compatStore v0.CompatStore, bindings binding.Bindings, verifier Verifier) *Resolver {
+	serverOptions jsonrpc.Options, compatStore v0.CompatStore, bindings binding.Bindings, verifier Verifier, adminToken string, watchers Watchers) *Resolver {
 	requests := make(chan lhttp.RequestWithResponder, 128)
 	txChecker := newTxChecker(logger, requests, verifier, db)
 	go txChecker.Run()
@@ -60,6 +62,9 @@ func New(network multichain.Network, logger logrus.FieldLogger, cacher phi.Task,
 		serverOptions:     serverOptions,
 		compatStore:       compatStore,
 		bindings:          bindings,
+		adminToken:        adminToken,
+		watchers:          watchers,
+		backfills:         newBackfillJobs(logger, DefaultBackfillTimeout, DefaultBackfillRetention),
 	}
 }
 
@@ -164,6 +169,28 @@ func (resolver *Resolver) Fallback(ctx context.Context, id interface{}, method s
 			})
 		}
 		return resolver.QueryTxByTxid(ctx, id, &parsedParams, req)
+	case MethodBackfillWatcher:
+		var parsedParams ParamsBackfillWatcher
+		err := json.Unmarshal(params.(json.RawMessage), &parsedParams)
+		if err != nil {
+			return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			})
+		}
+		return resolver.BackfillWatcher(ctx, id, &parsedParams, req)
+	case MethodQueryBackfill:
+		var parsedParams ParamsQueryBackfill
+		err := json.Unmarshal(params.(json.RawMessage), &parsedParams)
+		if err != nil {
+			return jsonrpc.NewResponse(id, nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			})
+		}
+		return resolver.QueryBackfill(ctx, id, &parsedParams, req)
+	case MethodQueryWatcherStatus:
+		return resolver.QueryWatcherStatus(ctx, id, req)
 	}
 	return jsonrpc.NewResponse(id, nil, nil)
 }
@@ -330,8 +357,9 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 
 	// If the transaction has not reached sufficient confirmations (i.e. the
 	// Darknodes do not yet know about the transaction), respond with a
-	// custom confirming status.
-	if status != db.TxStatusConfirmed {
+	// custom confirming status. Transactions marked as confirmed were
+	// submitted by earlier versions of the Lightnode.
+	if status != db.TxStatusConfirmed && status != db.TxStatusSubmitted {
 		transaction, err := resolver.db.Tx(params.TxHash)
 		if err == nil {
 			if v0tx {
@@ -361,10 +389,7 @@ func (resolver *Resolver) QueryTx(ctx context.Context, id interface{}, params *j
 		}
 	}
 
-	query := url.Values{}
-	if req != nil {
-		query = req.URL.Query()
-	}
+	query := resolver.query(req)
 
 	reqWithResponder := lhttp.NewRequestWithResponder(ctx, id, jsonrpc.MethodQueryTx, params, query)
 	if ok := resolver.cacher.Send(reqWithResponder); !ok {
@@ -652,9 +677,8 @@ func (resolver *Resolver) QueryTxs(ctx context.Context, id interface{}, params *
 }
 
 func (resolver *Resolver) handleMessage(ctx context.Context, id interface{}, method string, params interface{}, r *http.Request, isCompat bool) jsonrpc.Response {
-	query := url.Values{}
+	query := resolver.query(r)
 	if r != nil {
-		query = r.URL.Query()
 		darknodeID := query.Get("id")
 		if darknodeID != "" {
 			if _, err := resolver.multiStore.Get(darknodeID); err != nil {
@@ -35,6 +35,7 @@ import (
 	"github.com/renproject/darknode/tx/txutil"
 	"github.com/renproject/kv"
 	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/distkey"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/testutils"
 	"github.com/renproject/pack"
@@ -47,8 +48,26 @@ func (v mockVerifier) VerifyTx(ctx context.Context, tx tx.Tx) error {
 	return nil
 }
 
+// mockWatchers backfills once it is released.
+type mockWatchers struct {
+	release chan struct{}
+}
+
+func (watchers mockWatchers) Backfill(ctx context.Context, selector tx.Selector, from, to uint64) (watcher.BackfillResult, error) {
+	select {
+	case <-ctx.Done():
+		return watcher.BackfillResult{}, ctx.Err()
+	case <-watchers.release:
+	}
+	return watcher.BackfillResult{Selector: selector, From: pack.NewU64(from), To: pack.NewU64(to)}, nil
+}
+
+func (watchers mockWatchers) Status() []watcher.Status {
+	return []watcher.Status{}
+}
+
 var _ = Describe("Resolver", func() {
-	init := func(ctx context.Context) (*Resolver, jsonrpc.Validator, *redis.Client) {
+	initWithWatchers := func(ctx context.Context, adminToken string, watchers Watchers) (*Resolver, jsonrpc.Validator, *redis.Client) {
 		logger := logrus.New()
 
 		table := kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses")
@@ -112,14 +131,18 @@ var _ = Describe("Resolver", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 
 		limiter := NewRateLimiter(DefaultRateLimitConf())
-		validator := NewValidator(bindings, (*id.PubKey)(pubkey), compatStore, &limiter, logger)
+		validator := NewValidator(bindings, distkey.NewTracker(logger, (*id.PubKey)(pubkey), distkey.DefaultQuorum), compatStore, &limiter, logger)
 
 		mockVerifier := mockVerifier{}
-		resolver := New(multichain.NetworkTestnet, logger, cacher, multiaddrStore, database, jsonrpc.Options{}, compatStore, bindings, mockVerifier)
+		resolver := New(multichain.NetworkTestnet, logger, cacher, multiaddrStore, database, jsonrpc.Options{}, compatStore, bindings, mockVerifier, adminToken, watchers)
 
 		return resolver, validator, client
 	}
 
+	init := func(ctx context.Context) (*Resolver, jsonrpc.Validator, *redis.Client) {
+		return initWithWatchers(ctx, "", nil)
+	}
+
 	cleanup := func() {
 		Expect(os.Remove("./resolver_test.db")).Should(BeNil())
 	}
@@ -606,4 +629,45 @@ var _ = Describe("Resolver", func() {
 			}),
 		))
 	})
+
+	It("should backfill in the background for admin callers", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		watchers := mockWatchers{release: make(chan struct{})}
+		resolver, _, _ := initWithWatchers(ctx, "secret", watchers)
+		defer cleanup()
+
+		params := ParamsBackfillWatcher{
+			Selector: tx.Selector("BTC/fromEthereum"),
+			From:     pack.NewU64(10),
+			To:       pack.NewU64(20),
+		}
+		resp := resolver.BackfillWatcher(ctx, nil, &params, &http.Request{Header: http.Header{}})
+		Expect(resp.Error).ToNot(BeNil())
+
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Authorization", "Bearer secret")
+		resp = resolver.BackfillWatcher(ctx, nil, &params, req)
+		Expect(resp.Error).To(BeNil())
+		job := resp.Result.(BackfillJob)
+		Expect(job.Status).To(Equal(BackfillJobRunning))
+
+		// The job keeps running after the request has returned.
+		resp = resolver.QueryBackfill(ctx, nil, &ParamsQueryBackfill{Job: job.ID}, req)
+		Expect(resp.Error).To(BeNil())
+		Expect(resp.Result.(BackfillJob).Status).To(Equal(BackfillJobRunning))
+
+		close(watchers.release)
+		Eventually(func() BackfillJobStatus {
+			resp := resolver.QueryBackfill(ctx, nil, &ParamsQueryBackfill{Job: job.ID}, req)
+			Expect(resp.Error).To(BeNil())
+			return resp.Result.(BackfillJob).Status
+		}).Should(Equal(BackfillJobDone))
+		resp = resolver.QueryBackfill(ctx, nil, &ParamsQueryBackfill{Job: job.ID}, req)
+		Expect(resp.Result.(BackfillJob).Result.To).To(Equal(pack.NewU64(20)))
+
+		resp = resolver.QueryBackfill(ctx, nil, &ParamsQueryBackfill{Job: "unknown"}, req)
+		Expect(resp.Error).ToNot(BeNil())
+	})
 })
@@ -11,21 +11,21 @@ import (
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
-	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/distkey"
 	"github.com/sirupsen/logrus"
 )
 
 // The lightnode Validator checks requests and also casts in case of compat changes
 type LightnodeValidator struct {
 	bindings binding.Bindings
-	pubkey   *id.PubKey
+	pubkey   *distkey.Tracker
 	store    v0.CompatStore
 	logger   logrus.FieldLogger
 	limiter  *LightnodeRateLimiter
 }
 
-func NewValidator(bindings binding.Bindings, pubkey *id.PubKey, store v0.CompatStore, limiter *LightnodeRateLimiter, logger logrus.FieldLogger) *LightnodeValidator {
+func NewValidator(bindings binding.Bindings, pubkey *distkey.Tracker, store v0.CompatStore, limiter *LightnodeRateLimiter, logger logrus.FieldLogger) *LightnodeValidator {
 	return &LightnodeValidator{
 		bindings: bindings,
 		pubkey:   pubkey,
@@ -124,7 +124,7 @@ func (validator *LightnodeValidator) ValidateRequest(ctx context.Context, r *htt
 
 		var params v0.ParamsSubmitTx
 		if err := json.Unmarshal(req.Params, &params); err == nil {
-			castParams, err := v0.V1TxParamsFromTx(ctx, params, validator.bindings, validator.pubkey, validator.store)
+			castParams, err := v0.V1TxParamsFromTx(ctx, params, validator.bindings, validator.pubkey.PubKey(), validator.store)
 			if err != nil {
 				validator.logger.Errorf("[validator]: failed to validate compat tx submission: %v", err)
 				return nil, jsonrpc.NewResponse(req.ID, nil, &jsonrpc.Error{
@@ -0,0 +1,40 @@
+package resolver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/watcher"
+)
+
+// MethodQueryWatcherStatus is the method that reports the progress of the
+// watchers.
+const MethodQueryWatcherStatus = "ren_queryWatcherStatus"
+
+// Watchers gives access to the watchers of the Lightnode.
+type Watchers interface {
+	// Backfill re-scans a range of blocks for the burns of a selector,
+	// without moving the checkpoint of its watcher.
+	Backfill(ctx context.Context, selector tx.Selector, from, to uint64) (watcher.BackfillResult, error)
+
+	// Status returns the progress of every watcher.
+	Status() []watcher.Status
+}
+
+// ResponseQueryWatcherStatus is the response of the `ren_queryWatcherStatus`
+// method.
+type ResponseQueryWatcherStatus struct {
+	Watchers []watcher.Status `json:"watchers"`
+}
+
+// QueryWatcherStatus reports, for every watcher, the last checked block, the
+// latest block of the chain, the last error and the burns recently found, so
+// that stuck watchers can be detected.
+func (resolver *Resolver) QueryWatcherStatus(ctx context.Context, id interface{}, req *http.Request) jsonrpc.Response {
+	if resolver.watchers == nil {
+		return jsonrpc.NewResponse(id, ResponseQueryWatcherStatus{Watchers: []watcher.Status{}}, nil)
+	}
+	return jsonrpc.NewResponse(id, ResponseQueryWatcherStatus{Watchers: resolver.watchers.Status()}, nil)
+}
@@ -1,17 +1,35 @@
 package store
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
 	"github.com/renproject/kv/db"
+	ldb "github.com/renproject/lightnode/db"
+	"github.com/sirupsen/logrus"
+)
+
+// Errors returned when inserting a multi-address that would replace a newer or
+// different multi-address signed by the same Darknode.
+var (
+	ErrStaleAddress       = errors.New("multi-address is older than the stored one")
+	ErrConflictingAddress = errors.New("multi-address conflicts with the stored one with the same nonce")
 )
 
 // MultiAddrStore is a store of `wire.Address`es.
 type MultiAddrStore struct {
 	store          db.Table
 	bootstrapAddrs []wire.Address
+
+	// database persists the entries of the store, along with their last seen
+	// time and health, so they survive restarts. It is nil if the store is
+	// not persisted.
+	database ldb.DB
+	expiry   time.Duration
 }
 
 // New constructs a new `MultiAddrStore`.
@@ -29,6 +47,57 @@ func New(store db.Table, bootstrapAddrs []wire.Address) MultiAddrStore {
 	return multiStore
 }
 
+// NewPersistent constructs a new `MultiAddrStore` whose entries are also
+// written to the given database. Entries that were seen within the expiry are
+// reloaded from the database, and older ones are removed. Reloaded entries are
+// verified in the same way as inserted ones. Entries that cannot be decoded,
+// or that are not signed by the Darknode they are stored for, are logged and
+// removed, so that a corrupt entry does not prevent the Lightnode from
+// starting.
+func NewPersistent(logger logrus.FieldLogger, store db.Table, bootstrapAddrs []wire.Address, database ldb.DB, expiry time.Duration) (MultiAddrStore, error) {
+	multiStore := New(store, bootstrapAddrs)
+	multiStore.database = database
+	multiStore.expiry = expiry
+
+	peers, err := database.Peers()
+	if err != nil {
+		return MultiAddrStore{}, fmt.Errorf("loading peers: %v", err)
+	}
+	for _, peer := range peers {
+		if time.Since(peer.LastSeen) > expiry {
+			if err := database.DeletePeer(peer.Signatory); err != nil {
+				return MultiAddrStore{}, fmt.Errorf("deleting stale peer %v: %v", peer.Signatory, err)
+			}
+			continue
+		}
+		addr, err := wire.DecodeString(peer.Address)
+		if err == nil {
+			var signatory id.Signatory
+			signatory, err = multiStore.verify(addr)
+			if err == nil && signatory.String() != peer.Signatory {
+				err = fmt.Errorf("signed by %v", signatory)
+			}
+		}
+		switch err {
+		case nil:
+		case ErrStaleAddress, ErrConflictingAddress:
+			// The Bootstrap node has a newer multi-address in the options.
+			logger.Warnf("[store] ignoring peer %v with multi-address %v: %v", peer.Signatory, peer.Address, err)
+			continue
+		default:
+			logger.Warnf("[store] removing peer %v with invalid multi-address %v: %v", peer.Signatory, peer.Address, err)
+			if err := database.DeletePeer(peer.Signatory); err != nil {
+				return MultiAddrStore{}, fmt.Errorf("deleting invalid peer %v: %v", peer.Signatory, err)
+			}
+			continue
+		}
+		if err := store.Insert(peer.Signatory, addr.String()); err != nil {
+			return MultiAddrStore{}, err
+		}
+	}
+	return multiStore, nil
+}
+
 // Get retrieves a multi-address from the store.
 func (multiStore *MultiAddrStore) Get(id string) (wire.Address, error) {
 	var addrString string
@@ -38,14 +107,45 @@ func (multiStore *MultiAddrStore) Get(id string) (wire.Address, error) {
 	return wire.DecodeString(addrString)
 }
 
-// Insert puts the given multi-address into the store.
+// Insert puts the given multi-address into the store. Multi-addresses are
+// keyed by the signatory recovered from their signature, so a Darknode can
+// only be impersonated with its private key. A multi-address is rejected if
+// the store already has a newer one for the same Darknode, or a different one
+// with the same nonce, which prevents old multi-addresses from being replayed.
 func (multiStore *MultiAddrStore) Insert(addr wire.Address) error {
-	signatory, err := addr.Signatory()
+	signatory, err := multiStore.verify(addr)
 	if err != nil {
 		return err
 	}
+	if err := multiStore.store.Insert(signatory.String(), addr.String()); err != nil {
+		return err
+	}
+	if multiStore.database == nil {
+		return nil
+	}
+	return multiStore.database.InsertPeer(ldb.Peer{
+		Signatory: signatory.String(),
+		Address:   addr.String(),
+		LastSeen:  time.Now(),
+	})
+}
 
-	return multiStore.store.Insert(signatory.String(), addr.String())
+// verify returns the signatory of the given multi-address, or an error if it
+// cannot replace the multi-address stored for the same Darknode.
+func (multiStore *MultiAddrStore) verify(addr wire.Address) (id.Signatory, error) {
+	signatory, err := addr.Signatory()
+	if err != nil {
+		return id.Signatory{}, fmt.Errorf("invalid signature: %v", err)
+	}
+	if existing, err := multiStore.Get(signatory.String()); err == nil {
+		switch {
+		case addr.Nonce < existing.Nonce:
+			return id.Signatory{}, ErrStaleAddress
+		case addr.Nonce == existing.Nonce && (addr.Protocol != existing.Protocol || addr.Value != existing.Value):
+			return id.Signatory{}, ErrConflictingAddress
+		}
+	}
+	return signatory, nil
 }
 
 // Delete removes the given multi-address from the store.
@@ -54,7 +154,62 @@ func (multiStore *MultiAddrStore) Delete(addr wire.Address) error {
 	if err != nil {
 		return err
 	}
-	return multiStore.store.Delete(signatory.String())
+	if err := multiStore.store.Delete(signatory.String()); err != nil {
+		return err
+	}
+	if multiStore.database == nil {
+		return nil
+	}
+	return multiStore.database.DeletePeer(signatory.String())
+}
+
+// UpdateHealth persists the health of the Darknode with the given signatory.
+// It does nothing if the store is not persisted.
+func (multiStore *MultiAddrStore) UpdateHealth(signatory string, latency time.Duration, errors float64) error {
+	if multiStore.database == nil {
+		return nil
+	}
+	return multiStore.database.UpdatePeerHealth(signatory, latency, errors)
+}
+
+// Health returns the persisted health of the Darknodes in the store. It
+// returns nothing if the store is not persisted.
+func (multiStore *MultiAddrStore) Health() ([]ldb.Peer, error) {
+	if multiStore.database == nil {
+		return nil, nil
+	}
+	return multiStore.database.Peers()
+}
+
+// Prune removes the Darknodes that have not been seen within the expiry.
+// Bootstrap nodes are never removed. It does nothing if the store is not
+// persisted.
+func (multiStore *MultiAddrStore) Prune() error {
+	if multiStore.database == nil {
+		return nil
+	}
+	peers, err := multiStore.database.Peers()
+	if err != nil {
+		return err
+	}
+	bootstrap := map[string]bool{}
+	for _, addr := range multiStore.bootstrapAddrs {
+		if signatory, err := addr.Signatory(); err == nil {
+			bootstrap[signatory.String()] = true
+		}
+	}
+	for _, peer := range peers {
+		if bootstrap[peer.Signatory] || time.Since(peer.LastSeen) <= multiStore.expiry {
+			continue
+		}
+		if err := multiStore.store.Delete(peer.Signatory); err != nil && err != db.ErrKeyNotFound {
+			return err
+		}
+		if err := multiStore.database.DeletePeer(peer.Signatory); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Size returns the number of entries in the store.
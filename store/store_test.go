@@ -1,8 +1,13 @@
 package store_test
 
 import (
+	"database/sql"
 	"fmt"
 	"math/rand"
+	"os"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -11,6 +16,8 @@ import (
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/id"
 	"github.com/renproject/kv"
+	"github.com/renproject/lightnode/db"
+	"github.com/sirupsen/logrus"
 )
 
 func RandomOkAddrValue(r *rand.Rand) string {
@@ -165,4 +172,163 @@ var _ = Describe("Store", func() {
 			Expect(len(addrs)).To(Equal(expectedSize))
 		})
 	})
+
+	Context("when inserting multi-addresses for the same darknode", func() {
+		It("should prefer newer multi-addresses and reject replayed ones", func() {
+			key := id.NewPrivKey()
+			signed := func(value string, nonce uint64) wire.Address {
+				addr := wire.NewUnsignedAddress(wire.TCP, value, nonce)
+				Expect(addr.Sign(key)).NotTo(HaveOccurred())
+				return addr
+			}
+			addrStore := New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), nil)
+
+			original := signed("127.0.0.1:18514", 1)
+			Expect(addrStore.Insert(original)).ShouldNot(HaveOccurred())
+			Expect(addrStore.Insert(original)).ShouldNot(HaveOccurred())
+
+			newer := signed("127.0.0.2:18514", 2)
+			Expect(addrStore.Insert(newer)).ShouldNot(HaveOccurred())
+			Expect(addrStore.Insert(original)).Should(Equal(ErrStaleAddress))
+			Expect(addrStore.Insert(signed("127.0.0.3:18514", 2))).Should(Equal(ErrConflictingAddress))
+
+			signatory, err := newer.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			fetchedAddr, err := addrStore.Get(signatory.String())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fetchedAddr).To(Equal(newer))
+		})
+
+		It("should reject unsigned multi-addresses", func() {
+			addrStore := New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), nil)
+			addr := wire.NewUnsignedAddress(wire.TCP, "127.0.0.1:18514", 1)
+			Expect(addrStore.Insert(addr)).Should(HaveOccurred())
+		})
+	})
+
+	Context("when persisted", func() {
+		logger := logrus.New()
+		logger.SetLevel(logrus.FatalLevel)
+
+		AfterEach(func() {
+			os.Remove("./store_test.db")
+		})
+
+		It("should reload addresses after a restart and prune stale ones", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			sqlDB, err := sql.Open("sqlite3", "./store_test.db")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer sqlDB.Close()
+			database := db.New(sqlDB)
+			Expect(database.Init()).Should(Succeed())
+
+			bootstrap := randomAddress(r)
+			addrStore, err := NewPersistent(logger, kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), []wire.Address{bootstrap}, database, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+			fresh, stale := randomAddress(r), randomAddress(r)
+			Expect(addrStore.Insert(fresh)).ShouldNot(HaveOccurred())
+			Expect(addrStore.Insert(stale)).ShouldNot(HaveOccurred())
+
+			// Pretend the stale address was last seen a long time ago.
+			staleSignatory, err := stale.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: staleSignatory.String(),
+				Address:   stale.String(),
+				LastSeen:  time.Now().Add(-2 * time.Hour),
+			})).Should(Succeed())
+
+			// A new store should only reload the fresh address.
+			addrStore, err = NewPersistent(logger, kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), []wire.Address{bootstrap}, database, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+			size, err := addrStore.Size()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(size).To(Equal(2))
+			freshSignatory, err := fresh.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			fetchedAddr, err := addrStore.Get(freshSignatory.String())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(fetchedAddr).To(Equal(fresh))
+
+			// Addresses that become stale are pruned.
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: freshSignatory.String(),
+				Address:   fresh.String(),
+				LastSeen:  time.Now().Add(-2 * time.Hour),
+			})).Should(Succeed())
+			Expect(addrStore.Prune()).Should(Succeed())
+			size, err = addrStore.Size()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(size).To(Equal(1))
+		})
+
+		It("should remove addresses that cannot be decoded", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			sqlDB, err := sql.Open("sqlite3", "./store_test.db")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer sqlDB.Close()
+			database := db.New(sqlDB)
+			Expect(database.Init()).Should(Succeed())
+
+			valid := randomAddress(r)
+			validSignatory, err := valid.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: validSignatory.String(),
+				Address:   valid.String(),
+				LastSeen:  time.Now(),
+			})).Should(Succeed())
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: "invalid",
+				Address:   "not a multi-address",
+				LastSeen:  time.Now(),
+			})).Should(Succeed())
+
+			addrStore, err := NewPersistent(logger, kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), nil, database, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+			size, err := addrStore.Size()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(size).To(Equal(1))
+			peers, err := database.Peers()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(peers).To(HaveLen(1))
+			Expect(peers[0].Signatory).To(Equal(validSignatory.String()))
+		})
+
+		It("should not reload addresses that are not signed by their darknode", func() {
+			r := rand.New(rand.NewSource(GinkgoRandomSeed()))
+			sqlDB, err := sql.Open("sqlite3", "./store_test.db")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer sqlDB.Close()
+			database := db.New(sqlDB)
+			Expect(database.Init()).Should(Succeed())
+
+			// An address stored for another darknode.
+			victim := randomAddress(r)
+			victimSignatory, err := victim.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: victimSignatory.String(),
+				Address:   randomAddress(r).String(),
+				LastSeen:  time.Now(),
+			})).Should(Succeed())
+
+			// An unsigned address.
+			unsigned := wire.NewUnsignedAddress(wire.TCP, "127.0.0.1:18514", 1)
+			Expect(database.InsertPeer(db.Peer{
+				Signatory: "unsigned",
+				Address:   unsigned.String(),
+				LastSeen:  time.Now(),
+			})).Should(Succeed())
+
+			addrStore, err := NewPersistent(logger, kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), nil, database, time.Hour)
+			Expect(err).ShouldNot(HaveOccurred())
+			size, err := addrStore.Size()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(size).To(Equal(0))
+			peers, err := database.Peers()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(peers).To(BeEmpty())
+		})
+	})
 })
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/darknode/tx"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/phi"
 )
@@ -32,5 +33,11 @@ func (dispatcher *MockDispatcher) Handle(_ phi.Task, message phi.Message) {
 		msg.RespondWithErr(1, fmt.Errorf("set to fail"))
 	}
 
+	// Acknowledge every transaction that is queried.
+	if params, ok := msg.Params.(jsonrpc.ParamsQueryTx); ok {
+		msg.Responder <- jsonrpc.NewResponse(msg.ID, jsonrpc.ResponseQueryTx{Tx: tx.Tx{Hash: params.TxHash}}, nil)
+		return
+	}
+
 	msg.Responder <- jsonrpc.Response{}
 }
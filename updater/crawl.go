@@ -0,0 +1,135 @@
+package updater
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"sync"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/lightnode/store"
+	"github.com/renproject/phi"
+)
+
+// networkSize and networkChurn expose the number of darknodes seen during the
+// last round of discovery, and how many joined or left since the round
+// before, as metrics.
+var (
+	networkSize  = expvar.NewInt("updater_network_size")
+	networkChurn = expvar.NewMap("updater_network_churn")
+)
+
+// crawl queries the given darknodes for their peers and inserts the peers into
+// the store. If crawling is enabled, a random sample of the discovered peers
+// is queried in turn, until the crawl depth is reached or the budget of
+// queries for the round runs out. Darknodes are de-duplicated by signatory,
+// preferring the multi-address with the newest nonce, and multi-addresses that
+// fail verification are quarantined. It returns the signatories of every
+// darknode seen during the round, along with the newest nonce seen for each.
+func (updater *Updater) crawl(ctx context.Context, addrs []wire.Address) map[string]uint64 {
+	mu := new(sync.Mutex)
+	seen := map[string]uint64{}
+	for _, addr := range addrs {
+		if signatory, err := addr.Signatory(); err == nil {
+			seen[signatory.String()] = addr.Nonce
+		}
+	}
+
+	budget := updater.crawlBudget
+	frontier := addrs
+	for depth := 0; len(frontier) > 0; depth++ {
+		discovered := []wire.Address{}
+		phi.ParForAll(frontier, func(i int) {
+			source := frontier[i]
+			peers, err := updater.queryPeers(ctx, source)
+			if err != nil {
+				updater.logger.Warnf("[updater] cannot query peers of node %v: %v", source.String(), err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, peer := range peers {
+				if updater.quarantine.contains(peer) {
+					continue
+				}
+				signatory, err := peer.Signatory()
+				if err != nil {
+					updater.quarantinePeer(peer, source, reasonInvalid, err)
+					continue
+				}
+
+				// Only newer multi-addresses replace ones already seen
+				// during this round.
+				nonce, ok := seen[signatory.String()]
+				if ok && peer.Nonce <= nonce {
+					continue
+				}
+				seen[signatory.String()] = peer.Nonce
+				if err := updater.multiStore.Insert(peer); err != nil {
+					switch err {
+					case store.ErrStaleAddress:
+						updater.quarantinePeer(peer, source, reasonStale, err)
+					case store.ErrConflictingAddress:
+						updater.quarantinePeer(peer, source, reasonConflicting, err)
+					default:
+						updater.logger.Errorf("[updater] failed to add multi-address to store: %v", err)
+					}
+					continue
+				}
+				if !ok {
+					discovered = append(discovered, peer)
+				}
+			}
+		})
+
+		if depth >= updater.crawlDepth || budget <= 0 {
+			break
+		}
+		rand.Shuffle(len(discovered), func(i, j int) {
+			discovered[i], discovered[j] = discovered[j], discovered[i]
+		})
+		if len(discovered) > budget {
+			discovered = discovered[:budget]
+		}
+		budget -= len(discovered)
+		frontier = discovered
+	}
+	return seen
+}
+
+// reportChurn reports the size of the network seen during the last round of
+// discovery, and how many darknodes joined or left since the previous round.
+func (updater *Updater) reportChurn(seen map[string]uint64) {
+	networkSize.Set(int64(len(seen)))
+	defer func() {
+		updater.lastSeen = seen
+	}()
+	if updater.lastSeen == nil {
+		updater.logger.Infof("[updater] network size=%v", len(seen))
+		return
+	}
+
+	joined, left := 0, 0
+	for signatory := range seen {
+		if _, ok := updater.lastSeen[signatory]; !ok {
+			joined++
+		}
+	}
+	for signatory := range updater.lastSeen {
+		if _, ok := seen[signatory]; !ok {
+			left++
+		}
+	}
+	networkChurn.Add("joined", int64(joined))
+	networkChurn.Add("left", int64(left))
+	updater.logger.Infof("[updater] network size=%v joined=%v left=%v", len(seen), joined, left)
+}
+
+// quarantinePeer quarantines a multi-address returned by the source darknode
+// that failed verification.
+func (updater *Updater) quarantinePeer(peer, source wire.Address, reason string, err error) {
+	updater.quarantine.add(peer, reason)
+	updater.logger.Warnf("[updater] quarantined %v multi-address %v from node %v: %v", reason, peer.String(), source.String(), err)
+}
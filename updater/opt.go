@@ -0,0 +1,144 @@
+package updater
+
+import (
+	"time"
+
+	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/distkey"
+	"github.com/renproject/lightnode/http"
+	"github.com/sirupsen/logrus"
+)
+
+// Enumerate default options.
+var (
+	DefaultPollRate              = 5 * time.Minute
+	DefaultProbeRate             = time.Minute
+	DefaultProbeFailureThreshold = 3
+	DefaultCrawlDepth            = 0
+	DefaultCrawlBudget           = 20
+	DefaultQuarantineDuration    = time.Hour
+	DefaultRoutingRate           = time.Minute
+)
+
+// Options to configure the precise behaviour of the updater.
+type Options struct {
+	Logger                logrus.FieldLogger
+	PollRate              time.Duration
+	Timeout               time.Duration
+	Endpoints             http.Endpoints
+	Health                *dispatcher.HealthTracker
+	ProbeRate             time.Duration
+	ProbeFailureThreshold int
+	CrawlDepth            int
+	CrawlBudget           int
+	QuarantineDuration    time.Duration
+	Routing               *dispatcher.RoutingTable
+	RoutingRate           time.Duration
+	DistPubKey            *distkey.Tracker
+}
+
+// DefaultOptions returns new options with default configurations that should
+// work for the majority of use cases.
+func DefaultOptions() Options {
+	return Options{
+		Logger:                logrus.New(),
+		PollRate:              DefaultPollRate,
+		Timeout:               http.DefaultClientTimeout,
+		Endpoints:             http.Endpoints{},
+		ProbeRate:             DefaultProbeRate,
+		ProbeFailureThreshold: DefaultProbeFailureThreshold,
+		CrawlDepth:            DefaultCrawlDepth,
+		CrawlBudget:           DefaultCrawlBudget,
+		QuarantineDuration:    DefaultQuarantineDuration,
+		RoutingRate:           DefaultRoutingRate,
+	}
+}
+
+// WithLogger returns new options with the given logger.
+func (opts Options) WithLogger(logger logrus.FieldLogger) Options {
+	opts.Logger = logger
+	return opts
+}
+
+// WithPollRate returns new options with the given poll rate.
+func (opts Options) WithPollRate(pollRate time.Duration) Options {
+	opts.PollRate = pollRate
+	return opts
+}
+
+// WithTimeout returns new options with the given client timeout.
+func (opts Options) WithTimeout(timeout time.Duration) Options {
+	opts.Timeout = timeout
+	return opts
+}
+
+// WithEndpoints returns new options with the given Darknode endpoints.
+func (opts Options) WithEndpoints(endpoints http.Endpoints) Options {
+	opts.Endpoints = endpoints
+	return opts
+}
+
+// WithHealth returns new options with the health tracker of the dispatcher.
+// The health of the darknodes is persisted after every poll if it is set.
+func (opts Options) WithHealth(health *dispatcher.HealthTracker) Options {
+	opts.Health = health
+	return opts
+}
+
+// WithProbeRate returns new options with the given rate at which the liveness
+// of the darknodes is probed.
+func (opts Options) WithProbeRate(probeRate time.Duration) Options {
+	opts.ProbeRate = probeRate
+	return opts
+}
+
+// WithProbeFailureThreshold returns new options with the given number of
+// consecutive failed probes after which a darknode is evicted from the store.
+func (opts Options) WithProbeFailureThreshold(threshold int) Options {
+	opts.ProbeFailureThreshold = threshold
+	return opts
+}
+
+// WithCrawlDepth returns new options with the given crawl depth. The peers of
+// the bootstrap nodes are at depth zero, which disables crawling.
+func (opts Options) WithCrawlDepth(depth int) Options {
+	opts.CrawlDepth = depth
+	return opts
+}
+
+// WithCrawlBudget returns new options with the given maximum number of
+// discovered darknodes queried for their peers during each poll.
+func (opts Options) WithCrawlBudget(budget int) Options {
+	opts.CrawlBudget = budget
+	return opts
+}
+
+// WithQuarantineDuration returns new options with the given duration for which
+// multi-addresses that fail verification are ignored.
+func (opts Options) WithQuarantineDuration(duration time.Duration) Options {
+	opts.QuarantineDuration = duration
+	return opts
+}
+
+// WithRouting returns new options with the routing table of the dispatcher.
+// The routing table is refreshed from the System state of the darknodes if it
+// is set.
+func (opts Options) WithRouting(routing *dispatcher.RoutingTable) Options {
+	opts.Routing = routing
+	return opts
+}
+
+// WithRoutingRate returns new options with the given rate at which the System
+// state is queried to detect epoch changes.
+func (opts Options) WithRoutingRate(routingRate time.Duration) Options {
+	opts.RoutingRate = routingRate
+	return opts
+}
+
+// WithDistPubKey returns new options with the tracker of the distributed public
+// key, which is given the key of the primary shard whenever the System state
+// is queried.
+func (opts Options) WithDistPubKey(distPubKey *distkey.Tracker) Options {
+	opts.DistPubKey = distPubKey
+	return opts
+}
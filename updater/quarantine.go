@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/renproject/aw/wire"
+)
+
+// quarantined counts the multi-addresses returned by darknodes that were
+// quarantined, by the reason they were quarantined for.
+var quarantined = expvar.NewMap("updater_quarantined")
+
+// Enumerate the reasons for quarantining a multi-address.
+const (
+	reasonInvalid     = "invalid"
+	reasonStale       = "stale"
+	reasonConflicting = "conflicting"
+)
+
+// quarantine keeps the multi-addresses that failed verification, so that they
+// are ignored without being verified again until the quarantine expires. It is
+// safe for concurrent use.
+type quarantine struct {
+	mu       *sync.Mutex
+	duration time.Duration
+	addrs    map[string]time.Time
+}
+
+func newQuarantine(duration time.Duration) *quarantine {
+	return &quarantine{
+		mu:       new(sync.Mutex),
+		duration: duration,
+		addrs:    map[string]time.Time{},
+	}
+}
+
+// add quarantines the multi-address.
+func (q *quarantine) add(addr wire.Address, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quarantined.Add(reason, 1)
+	q.addrs[addr.String()] = time.Now().Add(q.duration)
+}
+
+// contains returns whether the multi-address is quarantined.
+func (q *quarantine) contains(addr wire.Address) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	until, ok := q.addrs[addr.String()]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(q.addrs, addr.String())
+		return false
+	}
+	return true
+}
+
+// prune removes the multi-addresses whose quarantine has expired.
+func (q *quarantine) prune() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for addr, until := range q.addrs {
+		if now.After(until) {
+			delete(q.addrs, addr)
+		}
+	}
+}
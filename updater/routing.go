@@ -0,0 +1,107 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+
+	"github.com/renproject/aw/wire"
+	"github.com/renproject/darknode/engine"
+	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/pack"
+)
+
+// refreshRouting queries the System state from the bootstrap nodes and updates
+// the routing table of the dispatcher if the epoch has changed, and the
+// distributed public key with the key of the primary shard. The bootstrap
+// nodes are tried in a random order. The routing table is updated with the
+// first one that responds, while the key reported by every bootstrap node is
+// observed, so that the key only changes once a quorum of them agree on it.
+func (updater *Updater) refreshRouting(ctx context.Context) {
+	queryCtx, cancel := context.WithTimeout(ctx, updater.routingRate)
+	defer cancel()
+
+	addrs, err := updater.multiStore.BootstrapAll()
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot get bootstrap addresses: %v", err)
+		return
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+
+	routed := updater.routing == nil
+	for _, addr := range addrs {
+		system, err := updater.querySystemState(queryCtx, addr)
+		if err != nil {
+			updater.logger.Warnf("[updater] cannot query system state from node %v: %v", addr.String(), err)
+			continue
+		}
+		if updater.distPubKey != nil && len(system.Shards.Primary) > 0 {
+			darknode := addr.Value
+			if signatory, err := addr.Signatory(); err == nil {
+				darknode = signatory.String()
+			}
+			if err := updater.distPubKey.Observe(darknode, system.Shards.Primary[0].PubKey); err != nil {
+				updater.logger.Errorf("[updater] invalid shard pubkey from node %v: %v", addr.String(), err)
+			}
+		}
+		if !routed {
+			routed = true
+			changed, err := updater.routing.Update(system)
+			if err != nil {
+				updater.logger.Errorf("[updater] cannot update routing table: %v", err)
+			} else if changed {
+				updater.logger.Infof("[updater] routing table updated for epoch=%v shards=%v members=%v", system.Epoch.Number, len(updater.routing.Shards()), len(updater.routing.Members()))
+			}
+		}
+		if routed && updater.distPubKey == nil {
+			return
+		}
+	}
+}
+
+// querySystemState returns the System state of the given darknode.
+func (updater *Updater) querySystemState(ctx context.Context, multi wire.Address) (engine.SystemState, error) {
+	params, err := json.Marshal(jsonrpc.ParamsQueryBlockState{})
+	if err != nil {
+		return engine.SystemState{}, fmt.Errorf("cannot marshal query block state params: %v", err)
+	}
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  jsonrpc.MethodQueryBlockState,
+		Params:  params,
+	}
+
+	addrString, err := updater.endpoints.URL(multi)
+	if err != nil {
+		return engine.SystemState{}, err
+	}
+	response, err := updater.client.SendRequest(ctx, addrString, request, nil)
+	if err != nil {
+		return engine.SystemState{}, fmt.Errorf("cannot connect: %v", err)
+	}
+	if response.Error != nil {
+		return engine.SystemState{}, fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return engine.SystemState{}, fmt.Errorf("error marshaling queryBlockState result: %v", err)
+	}
+	var resp jsonrpc.ResponseQueryBlockState
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return engine.SystemState{}, fmt.Errorf("cannot unmarshal queryBlockState result: %v", err)
+	}
+	val := resp.State.Get("System")
+	if val == nil {
+		return engine.SystemState{}, fmt.Errorf("missing system state")
+	}
+	var system engine.SystemState
+	if err := pack.Decode(&system, val); err != nil {
+		return engine.SystemState{}, fmt.Errorf("cannot decode system state: %v", err)
+	}
+	return system, nil
+}
@@ -5,12 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/renproject/aw/wire"
 	"github.com/renproject/darknode/jsonrpc"
+	"github.com/renproject/lightnode/dispatcher"
+	"github.com/renproject/lightnode/distkey"
 	"github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/phi"
@@ -19,119 +20,285 @@ import (
 
 // An Updater is a task responsible for querying the darknodes periodically to
 // know which darknodes are in the network. It does this by requesting the
-// peers of a random subset of the already known darknodes and adding any new
-// darknodes to a store. This store is shared by the `Dispatcher`, which needs
-// to know about the darknodes in the network.
+// peers of the bootstrap nodes, and optionally of a sample of the discovered
+// darknodes, and adding any new darknodes to a store. This store is shared by
+// the `Dispatcher`, which needs to know about the darknodes in the network.
 type Updater struct {
 	logger     logrus.FieldLogger
 	multiStore store.MultiAddrStore
+	breakers   *http.Breakers
+	endpoints  http.Endpoints
 	client     http.Client
+	health     *dispatcher.HealthTracker
 	pollRate   time.Duration
+
+	probeRate      time.Duration
+	probeThreshold int
+	probeMu        *sync.Mutex
+	probeFailures  map[string]int
+
+	crawlDepth  int
+	crawlBudget int
+	lastSeen    map[string]uint64
+	quarantine  *quarantine
+
+	routing     *dispatcher.RoutingTable
+	routingRate time.Duration
+	distPubKey  *distkey.Tracker
 }
 
 // New constructs a new `Updater`. If the given store of multi addresses is
 // empty, then the constructed `Updater` will be useless since it will not know
 // any darknodes to query. Therefore the given store must contain some number
-// of bootstrap addresses.
-func New(logger logrus.FieldLogger, multiStore store.MultiAddrStore, pollRate, timeout time.Duration) Updater {
+// of bootstrap addresses. The circuit breakers are shared with the
+// `Dispatcher` so that both skip unresponsive darknodes.
+func New(options Options, multiStore store.MultiAddrStore, breakers *http.Breakers) Updater {
 	return Updater{
-		logger:     logger,
+		logger:     options.Logger,
 		multiStore: multiStore,
-		pollRate:   pollRate,
-		client:     http.NewClient(timeout),
+		breakers:   breakers,
+		endpoints:  options.Endpoints,
+		pollRate:   options.PollRate,
+		client:     options.Endpoints.NewClient(options.Timeout),
+		health:     options.Health,
+
+		probeRate:      options.ProbeRate,
+		probeThreshold: options.ProbeFailureThreshold,
+		probeMu:        new(sync.Mutex),
+		probeFailures:  map[string]int{},
+
+		crawlDepth:  options.CrawlDepth,
+		crawlBudget: options.CrawlBudget,
+		quarantine:  newQuarantine(options.QuarantineDuration),
+
+		routing:     options.Routing,
+		routingRate: options.RoutingRate,
+		distPubKey:  options.DistPubKey,
 	}
 }
 
 // Run starts the `Updater` making requests to the darknodes and updating its
-// store. This function is blocking.
+// store. It also probes the liveness of the darknodes in the store and evicts
+// those that stop responding, and keeps the routing table of the dispatcher up
+// to date with the current epoch. This function is blocking.
 func (updater *Updater) Run(ctx context.Context) {
-	ticker := time.NewTicker(updater.pollRate)
-	defer ticker.Stop()
+	phi.ParBegin(func() {
+		ticker := time.NewTicker(updater.pollRate)
+		defer ticker.Stop()
 
-	updater.updateMultiAddress(ctx)
-	for {
-		select {
-		case <-ctx.Done():
+		updater.updateMultiAddress(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				updater.updateMultiAddress(ctx)
+			}
+		}
+	}, func() {
+		if updater.probeRate <= 0 {
 			return
-		case <-ticker.C:
-			updater.updateMultiAddress(ctx)
 		}
-	}
+		ticker := time.NewTicker(updater.probeRate)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				updater.probe(ctx)
+			}
+		}
+	}, func() {
+		if (updater.routing == nil && updater.distPubKey == nil) || updater.routingRate <= 0 {
+			return
+		}
+		ticker := time.NewTicker(updater.routingRate)
+		defer ticker.Stop()
+
+		updater.refreshRouting(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				updater.refreshRouting(ctx)
+			}
+		}
+	})
 }
 
 func (updater *Updater) updateMultiAddress(ctx context.Context) {
 	queryCtx, cancel := context.WithTimeout(ctx, updater.pollRate)
 	defer cancel()
 
+	addrs, err := updater.multiStore.BootstrapAll()
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot get query addresses: %v", err)
+		return
+	}
+
+	// Collect all peers connected to Bootstrap nodes, and crawl the network
+	// from there if enabled.
+	updater.quarantine.prune()
+	seen := updater.crawl(queryCtx, addrs)
+	updater.reportChurn(seen)
+
+	updater.persist()
+
+	// Print how many nodes we have connected to.
+	size, err := updater.multiStore.Size()
+	if err != nil {
+		updater.logger.Errorf("cannot get query addresses: %v", err)
+		return
+	}
+	updater.logger.Infof("connected to %v nodes", size)
+}
+
+// queryPeers returns the peers of the given darknode.
+func (updater *Updater) queryPeers(ctx context.Context, multi wire.Address) ([]wire.Address, error) {
 	params, err := json.Marshal(jsonrpc.ParamsQueryPeers{})
 	if err != nil {
-		updater.logger.Errorf("[updater] cannot marshal query peers params: %v", err)
+		return nil, fmt.Errorf("cannot marshal query peers params: %v", err)
+	}
+
+	// Send request to the node to retrieve its peers.
+	request := jsonrpc.Request{
+		Version: "2.0",
+		ID:      rand.Int31(),
+		Method:  jsonrpc.MethodQueryPeers,
+		Params:  params,
+	}
+
+	addrString, err := updater.endpoints.URL(multi)
+	if err != nil {
+		return nil, err
+	}
+	if !updater.breakers.Allow(multi.Value) {
+		return nil, fmt.Errorf("circuit breaker open")
+	}
+	response, err := updater.client.SendRequest(ctx, addrString, request, nil)
+	if ctx.Err() == nil {
+		updater.breakers.Record(multi.Value, err)
+	} else {
+		updater.breakers.Release(multi.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect: %v", err)
+	}
+
+	// Parse the response
+	raw, err := json.Marshal(response.Result)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling queryPeers result: %v", err)
+	}
+	var resp jsonrpc.ResponseQueryPeers
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal queryPeers result: %v", err)
+	}
+	peers := make([]wire.Address, 0, len(resp.Peers))
+	for _, peer := range resp.Peers {
+		addr, err := wire.DecodeString(peer)
+		if err != nil {
+			updater.logger.Errorf("[updater] failed to decode multi-address: %v", err)
+			continue
+		}
+		peers = append(peers, addr)
+	}
+	return peers, nil
+}
+
+// persist writes the health of the darknodes to the store and removes the
+// darknodes that have not been seen for too long.
+func (updater *Updater) persist() {
+	if updater.health != nil {
+		for signatory, health := range updater.health.Snapshot() {
+			if err := updater.multiStore.UpdateHealth(signatory, health.Latency, health.Errors); err != nil {
+				updater.logger.Errorf("[updater] cannot persist health of %v: %v", signatory, err)
+			}
+		}
+	}
+	if err := updater.multiStore.Prune(); err != nil {
+		updater.logger.Errorf("[updater] cannot prune stale darknodes: %v", err)
+	}
+}
+
+// probe sends a `ren_queryNumPeers` request to every darknode in the store and
+// evicts those that have failed too many consecutive probes. Bootstrap nodes
+// are never evicted.
+func (updater *Updater) probe(ctx context.Context) {
+	probeCtx, cancel := context.WithTimeout(ctx, updater.probeRate)
+	defer cancel()
+
+	params, err := json.Marshal(jsonrpc.ParamsQueryNumPeers{})
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot marshal query num peers params: %v", err)
 		return
 	}
-	addrs, err := updater.multiStore.BootstrapAll()
+	addrs, err := updater.multiStore.AddrsAll()
 	if err != nil {
-		updater.logger.Errorf("[updater] cannot get query addresses: %v", err)
+		updater.logger.Errorf("[updater] cannot get addresses to probe: %v", err)
+		return
+	}
+	bootstrapAddrs, err := updater.multiStore.BootstrapAll()
+	if err != nil {
+		updater.logger.Errorf("[updater] cannot get bootstrap addresses: %v", err)
 		return
 	}
+	bootstrap := map[string]bool{}
+	for _, addr := range bootstrapAddrs {
+		if signatory, err := addr.Signatory(); err == nil {
+			bootstrap[signatory.String()] = true
+		}
+	}
 
-	// Collect all peers connected to Bootstrap nodes.
 	phi.ParForAll(addrs, func(i int) {
 		multi := addrs[i]
+		signatory, err := multi.Signatory()
+		if err != nil || bootstrap[signatory.String()] {
+			return
+		}
+		key := signatory.String()
 
-		// Send request to the node to retrieve its peers.
 		request := jsonrpc.Request{
 			Version: "2.0",
 			ID:      rand.Int31(),
-			Method:  jsonrpc.MethodQueryPeers,
+			Method:  jsonrpc.MethodQueryNumPeers,
 			Params:  params,
 		}
-
-		addrParts := strings.Split(addrs[i].Value, ":")
-		if len(addrParts) != 2 {
-			updater.logger.Errorf("[updater] invalid address value=%v", addrs[i].Value)
-			return
-		}
-		port, err := strconv.Atoi(addrParts[1])
-		if err != nil {
-			updater.logger.Errorf("[updater] invalid port=%v", addrParts[1])
-			return
+		addrString, err := updater.endpoints.URL(multi)
+		if err == nil {
+			var response jsonrpc.Response
+			response, err = updater.client.SendRequest(probeCtx, addrString, request, nil)
+			if err == nil && response.Error != nil {
+				err = fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+			}
 		}
-		addrString := fmt.Sprintf("http://%s:%v", addrParts[0], port+1)
-		response, err := updater.client.SendRequest(queryCtx, addrString, request, nil)
-		if err != nil {
-			updater.logger.Warnf("[updater] cannot connect to node %v: %v", multi.String(), err)
+		if probeCtx.Err() != nil && ctx.Err() != nil {
+			// The Lightnode is shutting down, so the failure says nothing
+			// about the darknode.
 			return
 		}
 
-		// Parse the response
-		raw, err := json.Marshal(response.Result)
-		if err != nil {
-			updater.logger.Errorf("[updater] error marshaling queryPeers result: %v", err)
+		updater.probeMu.Lock()
+		defer updater.probeMu.Unlock()
+
+		if err == nil {
+			delete(updater.probeFailures, key)
 			return
 		}
-		var resp jsonrpc.ResponseQueryPeers
-		if err := json.Unmarshal(raw, &resp); err != nil {
-			updater.logger.Warnf("[updater] cannot unmarshal queryPeers result from %v: %v", multi.String(), err)
+		updater.probeFailures[key]++
+		failures := updater.probeFailures[key]
+		updater.logger.Debugf("[updater] probe %v of node %v failed: %v", failures, multi.String(), err)
+		if failures < updater.probeThreshold {
 			return
 		}
-		for _, peer := range resp.Peers {
-			addr, err := wire.DecodeString(peer)
-			if err != nil {
-				updater.logger.Errorf("[updater] failed to decode multi-address: %v", err)
-				continue
-			}
-			if err := updater.multiStore.Insert(addr); err != nil {
-				updater.logger.Errorf("[updater] failed to add multi-address to store: %v", err)
-				return
-			}
+		delete(updater.probeFailures, key)
+		if err := updater.multiStore.Delete(multi); err != nil {
+			updater.logger.Errorf("[updater] cannot evict node %v: %v", multi.String(), err)
+			return
 		}
+		updater.logger.Warnf("[updater] evicted node %v after %v failed probes", multi.String(), failures)
 	})
-
-	// Print how many nodes we have connected to.
-	size, err := updater.multiStore.Size()
-	if err != nil {
-		updater.logger.Errorf("cannot get query addresses: %v", err)
-		return
-	}
-	updater.logger.Infof("connected to %v nodes", size)
 }
@@ -13,7 +13,9 @@ import (
 	. "github.com/renproject/lightnode/testutils"
 
 	"github.com/renproject/aw/wire"
+	"github.com/renproject/id"
 	"github.com/renproject/kv"
+	lhttp "github.com/renproject/lightnode/http"
 	"github.com/renproject/lightnode/store"
 	"github.com/renproject/lightnode/updater"
 	"github.com/sirupsen/logrus"
@@ -25,7 +27,14 @@ func initUpdater(ctx context.Context, bootstrapAddrs []wire.Address, pollRate, t
 	for _, addr := range bootstrapAddrs {
 		multiStore.Insert(addr)
 	}
-	updater := updater.New(logger, multiStore, pollRate, timeout)
+	updater := updater.New(
+		updater.DefaultOptions().
+			WithLogger(logger).
+			WithPollRate(pollRate).
+			WithTimeout(timeout),
+		multiStore,
+		lhttp.NewBreakers(logger, lhttp.DefaultBreakerOptions),
+	)
 
 	go updater.Run(ctx)
 
@@ -64,6 +73,38 @@ func initDarknodes(ctx context.Context, n int) []*MockDarknode {
 	return dns
 }
 
+// initChain starts n darknodes that each only know the next darknode, along
+// with the endpoints needed to reach them.
+func initChain(ctx context.Context, port, n int) ([]*MockDarknode, lhttp.Endpoints) {
+	dns := make([]*MockDarknode, n)
+	urls := map[string]string{}
+	store := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), nil)
+	for i := 0; i < n; i++ {
+		i := i
+		server := jsonrpc.NewServer(jsonrpc.DefaultOptions(), &jsonrpcresolver.Callbacks{
+			QueryPeersHandler: func(ctx context.Context, id interface{}, params *jsonrpc.ParamsQueryPeers, r *http.Request) jsonrpc.Response {
+				peers := []string{}
+				if i+1 < n {
+					peers = append(peers, dns[i+1].Me.String())
+				}
+				return jsonrpc.Response{
+					Version: "2.0",
+					ID:      id,
+					Result:  jsonrpc.ResponseQueryPeers{Peers: peers},
+				}
+			},
+		}, jsonrpc.NewValidator())
+		url := fmt.Sprintf("0.0.0.0:%v", port+i)
+		go server.Listen(ctx, url)
+
+		dns[i] = NewMockDarknode(url, store)
+		urls[dns[i].Me.Value] = "http://" + url
+	}
+	endpoints, err := lhttp.NewEndpoints(lhttp.EndpointOptions{URLs: urls})
+	Expect(err).ShouldNot(HaveOccurred())
+	return dns, endpoints
+}
+
 var _ = Describe("Updater", func() {
 	Context("When running", func() {
 		It("Should periodically query the darknodes", func() {
@@ -82,5 +123,82 @@ var _ = Describe("Updater", func() {
 				return size
 			}, 5*time.Second).Should(Equal(13))
 		})
+
+		It("Should crawl the network up to the crawl depth", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			darknodes, endpoints := initChain(ctx, 6666, 6)
+			logger := logrus.New()
+			multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), []wire.Address{darknodes[0].Me})
+			updater := updater.New(
+				updater.DefaultOptions().
+					WithLogger(logger).
+					WithPollRate(time.Minute).
+					WithTimeout(time.Second).
+					WithEndpoints(endpoints).
+					WithCrawlDepth(3),
+				multiStore,
+				lhttp.NewBreakers(logger, lhttp.DefaultBreakerOptions),
+			)
+			time.Sleep(100 * time.Millisecond)
+			go updater.Run(ctx)
+
+			// The bootstrap node and its peer, followed by three more hops.
+			Eventually(func() int {
+				size, err := multiStore.Size()
+				Expect(err).ShouldNot(HaveOccurred())
+				return size
+			}, 5*time.Second).Should(Equal(5))
+			Consistently(func() int {
+				size, err := multiStore.Size()
+				Expect(err).ShouldNot(HaveOccurred())
+				return size
+			}, time.Second).Should(Equal(5))
+		})
+
+		It("Should evict darknodes that stop responding, except bootstrap nodes", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Neither address has a server listening on it.
+			unreachable := func(port int) wire.Address {
+				addr := wire.NewUnsignedAddress(wire.TCP, fmt.Sprintf("127.0.0.1:%v", port), uint64(time.Now().Unix()))
+				Expect(addr.Sign(id.NewPrivKey())).To(Succeed())
+				return addr
+			}
+			bootstrap, peer := unreachable(5554), unreachable(5556)
+
+			logger := logrus.New()
+			multiStore := store.New(kv.NewTable(kv.NewMemDB(kv.JSONCodec), "addresses"), []wire.Address{bootstrap})
+			Expect(multiStore.Insert(peer)).To(Succeed())
+			updater := updater.New(
+				updater.DefaultOptions().
+					WithLogger(logger).
+					WithPollRate(time.Minute).
+					WithTimeout(100*time.Millisecond).
+					WithProbeRate(100*time.Millisecond).
+					WithProbeFailureThreshold(2),
+				multiStore,
+				lhttp.NewBreakers(logger, lhttp.DefaultBreakerOptions),
+			)
+			go updater.Run(ctx)
+
+			Eventually(func() int {
+				size, err := multiStore.Size()
+				Expect(err).ShouldNot(HaveOccurred())
+				return size
+			}, 5*time.Second).Should(Equal(1))
+			Consistently(func() int {
+				size, err := multiStore.Size()
+				Expect(err).ShouldNot(HaveOccurred())
+				return size
+			}, time.Second).Should(Equal(1))
+
+			signatory, err := bootstrap.Signatory()
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = multiStore.Get(signatory.String())
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 	})
 })
@@ -0,0 +1,214 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/renproject/darknode/tx"
+	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// BackfillStatus is the status of a burn found while backfilling.
+type BackfillStatus string
+
+const (
+	// BackfillStatusNew is the status of a burn that the Lightnode had not
+	// seen before, and which has been submitted.
+	BackfillStatusNew = BackfillStatus("new")
+	// BackfillStatusKnown is the status of a burn that has already been
+	// submitted, but has not been submitted to the Darknodes yet.
+	BackfillStatusKnown = BackfillStatus("known")
+	// BackfillStatusDone is the status of a burn that has already been
+	// submitted to the Darknodes.
+	BackfillStatusDone = BackfillStatus("done")
+)
+
+// BackfillBurn is a burn found while backfilling.
+type BackfillBurn struct {
+	Nonce  string         `json:"nonce"`
+	Block  pack.U64       `json:"block"`
+	Hash   string         `json:"hash"`
+	Status BackfillStatus `json:"status"`
+}
+
+// BackfillResult lists the burns found while backfilling a range of blocks.
+type BackfillResult struct {
+	Selector tx.Selector    `json:"selector"`
+	From     pack.U64       `json:"from"`
+	To       pack.U64       `json:"to"`
+	Burns    []BackfillBurn `json:"burns"`
+}
+
+// Count returns the number of burns with the given status.
+func (result BackfillResult) Count(status BackfillStatus) int {
+	n := 0
+	for _, burn := range result.Burns {
+		if burn.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Backfill scans the blocks between from and to (inclusive) for burns, and
+// submits the burns that the Lightnode has not seen before. Unlike `Run`, it
+// does not move the checkpoint of the watcher, so it can be used to re-scan
+// blocks that were missed, for example during an RPC outage.
+func (watcher Watcher) Backfill(ctx context.Context, from, to uint64) (BackfillResult, error) {
+	if from > to {
+		return BackfillResult{}, fmt.Errorf("invalid range from=%v to=%v", from, to)
+	}
+	currentHeight, err := watcher.blockHeightFetcher.FetchBlockHeight(ctx)
+	if err != nil {
+		return BackfillResult{}, fmt.Errorf("fetching block height: %v", err)
+	}
+	// The height of a Solana gateway is one past the nonce of its last burn.
+	if watcher.selector.Source() == multichain.Solana && currentHeight > 0 {
+		currentHeight--
+	}
+	if to > currentHeight {
+		return BackfillResult{}, fmt.Errorf("cannot backfill to=%v beyond current block=%v", to, currentHeight)
+	}
+
+	result := BackfillResult{
+		Selector: watcher.selector,
+		From:     pack.NewU64(from),
+		To:       pack.NewU64(to),
+		Burns:    []BackfillBurn{},
+	}
+
+	// Scan the range in the same steps as the watcher, so that providers
+	// accept the log queries.
+	step := watcher.maxBlockAdvance
+	if step == 0 {
+		step = 1
+	}
+	for start := from; start <= to; start += step {
+		end := start + step - 1
+		if end > to || end < start {
+			end = to
+		}
+		if err := watcher.backfillRange(ctx, start, end, &result); err != nil {
+			return result, err
+		}
+		if end == to {
+			break
+		}
+	}
+
+	watcher.logger.Infof("[watcher] backfilled %v from=%v to=%v: new=%v known=%v done=%v", watcher.selector, from, to,
+		result.Count(BackfillStatusNew), result.Count(BackfillStatusKnown), result.Count(BackfillStatusDone))
+	return result, nil
+}
+
+// backfillRange scans the blocks between from and to for burns, and appends
+// them to the result.
+func (watcher Watcher) backfillRange(ctx context.Context, from, to uint64, result *BackfillResult) error {
+	// The Solana fetcher does not include the end of the range, because the
+	// watcher moves its checkpoint to the end of the range after a fetch.
+	end := to
+	if watcher.selector.Source() == multichain.Solana {
+		end = to + 1
+	}
+	c, err := watcher.burnLogFetcher.FetchBurnLogs(ctx, from, end)
+	if err != nil {
+		return fmt.Errorf("fetching LogBurn events from=%v to=%v: %v", from, to, err)
+	}
+
+	// Drain the channel so that the fetcher is not blocked if we stop early.
+	defer func() {
+		for range c {
+		}
+	}()
+
+	burns := []db.WatcherBurn{}
+	scanErr := error(nil)
+	for res := range c {
+		if res.Error != nil {
+			scanErr = fmt.Errorf("iterating LogBurn events from=%v to=%v: %v", from, to, res.Error)
+			break
+		}
+		burn := res.Result
+		nonce := pack.NewU256(burn.Nonce)
+
+		params, err := watcher.burnToParams(burn.Txid, burn.Amount, burn.ToBytes, burn.Nonce, watcher.gpubkey())
+		if err != nil {
+			watcher.logger.Errorf("[watcher] cannot get params from burn transaction (to=%v, amount=%v, nonce=%v): %v", burn.ToBytes, burn.Amount, nonce, err)
+			watcher.deadLetter(burn, err)
+			continue
+		}
+
+		v0Hash := v0.BurnTxHash(watcher.selector, nonce).String()
+		status, err := watcher.backfillStatus(nonce.String(), params.Tx, v0Hash)
+		if err != nil {
+			scanErr = fmt.Errorf("loading status of burn with nonce=%v: %v", nonce, err)
+			break
+		}
+		if status == BackfillStatusNew {
+			response := watcher.resolver.SubmitTx(ctx, 0, &params, nil)
+			if response.Error != nil {
+				watcher.updateSubmissionStatus(nonce.String(), params.Tx.Hash, db.WatcherNonceStatusRejected)
+				scanErr = fmt.Errorf("submitting burn with nonce=%v: %v", nonce, response.Error.Message)
+				break
+			}
+			watcher.updateSubmissionStatus(nonce.String(), params.Tx.Hash, db.WatcherNonceStatusAccepted)
+			burns = append(burns, db.WatcherBurn{
+				Selector: watcher.selector,
+				Nonce:    nonce.String(),
+				V0Hash:   v0Hash,
+				V1Hash:   params.Tx.Hash.String(),
+			})
+		}
+		result.Burns = append(result.Burns, BackfillBurn{
+			Nonce:  nonce.String(),
+			Block:  burn.BlockNumber,
+			Hash:   params.Tx.Hash.String(),
+			Status: status,
+		})
+	}
+
+	// Store the burns that were submitted even if the scan stopped early, so
+	// that they are known when the range is backfilled again.
+	if err := watcher.database.InsertWatcherBurns(burns); err != nil {
+		return fmt.Errorf("storing burns: %v", err)
+	}
+	return scanErr
+}
+
+// backfillStatus returns whether the burn transaction is new, has already been
+// submitted to the Lightnode, or has already been submitted to the Darknodes.
+func (watcher Watcher) backfillStatus(nonce string, transaction tx.Tx, v0Hash string) (BackfillStatus, error) {
+	submission, err := watcher.submissionStatus(nonce, transaction.Hash)
+	if err != nil {
+		return "", err
+	}
+	switch submission {
+	case db.WatcherNonceStatusDone:
+		return BackfillStatusDone, nil
+	case db.WatcherNonceStatusAccepted:
+		return BackfillStatusKnown, nil
+	}
+
+	status, err := watcher.database.TxStatus(transaction.Hash)
+	if err == sql.ErrNoRows {
+		// The transaction may have been pruned, in which case the burn is
+		// still known to the watcher.
+		if _, err := watcher.database.WatcherBurnByV0Hash(v0Hash); err == nil {
+			return BackfillStatusKnown, nil
+		} else if err != sql.ErrNoRows {
+			return "", err
+		}
+		return BackfillStatusNew, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if status == db.TxStatusSubmitted {
+		return BackfillStatusDone, nil
+	}
+	return BackfillStatusKnown, nil
+}
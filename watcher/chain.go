@@ -0,0 +1,385 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/renproject/darknode/binding/gatewaybinding"
+	"github.com/renproject/pack"
+)
+
+// logBurnTopic is the topic of the burn logs emitted by the gateways.
+var logBurnTopic = func() common.Hash {
+	parsed, err := abi.JSON(strings.NewReader(gatewaybinding.MintGatewayLogicV1ABI))
+	if err != nil {
+		panic(fmt.Sprintf("invalid gateway abi: %v", err))
+	}
+	return parsed.Events["LogBurn"].ID
+}()
+
+// EthChainFetcher fetches the head and the burn logs of an EVM chain once for
+// all of its gateways, instead of once per gateway. The chain is scanned by
+// the first watcher that fetches the head once the last scan is older than
+// half the poll interval, so that the scans follow the watchers: a scan
+// fetches the head, and then the burn logs of all active gateways from the
+// lowest checkpoint of their watchers up to the head less the confidence
+// interval, using a single `eth_getLogs` request. The watchers of the gateways
+// are served the head, the block hashes and the logs of the last scan, and
+// each of them processes the logs after its own checkpoint, so the watchers
+// keep their own checkpoints.
+//
+// A gateway is active for as long as its watcher keeps fetching burns from
+// it, and the block its watcher last fetched burns from is used as its
+// checkpoint. Ranges that are not covered by the last scan, for example when a
+// gateway has just become active, are fetched for the gateway on its own.
+type EthChainFetcher struct {
+	client       *ethclient.Client
+	pollInterval time.Duration
+	confidence   uint64
+	maxRange     uint64
+	state        *chainState
+}
+
+// chainState is the result of the last scan of a chain, along with the
+// gateways that are active.
+type chainState struct {
+	// scanning is held while the chain is scanned, so that the watchers that
+	// fetch the head at the same time wait for a single scan.
+	scanning *sync.Mutex
+
+	mu        *sync.Mutex
+	scannedAt time.Time
+	head      uint64
+	headErr   error
+	headers   map[uint64]*types.Header
+	gateways  map[common.Address]chainGateway
+	scan      *chainScan
+}
+
+// chainGateway is the progress of the watcher of an active gateway.
+type chainGateway struct {
+	checkpoint uint64
+	end        uint64
+	lastSeen   time.Time
+}
+
+// chainScan are the burn logs of the given gateways between two blocks.
+type chainScan struct {
+	from     uint64
+	to       uint64
+	gateways map[common.Address]bool
+	logs     []types.Log
+}
+
+// NewEthChainFetcher returns a fetcher for the head and burn logs of the chain
+// of the given client, for watchers that poll at the given interval and only
+// scan the blocks behind the head by the given confidence interval. A scan
+// covers at most the given number of blocks after the lowest checkpoint, so
+// that a watcher that is far behind does not make every scan expensive.
+func NewEthChainFetcher(client *ethclient.Client, pollInterval time.Duration, confidence, maxRange uint64) EthChainFetcher {
+	return EthChainFetcher{
+		client:       client,
+		pollInterval: pollInterval,
+		confidence:   confidence,
+		maxRange:     maxRange,
+		state: &chainState{
+			scanning: new(sync.Mutex),
+			mu:       new(sync.Mutex),
+			headers:  map[uint64]*types.Header{},
+			gateways: map[common.Address]chainGateway{},
+		},
+	}
+}
+
+// Gateway returns a fetcher for the burns of the gateway with the given
+// address, whose bindings are used to decode its burn logs. The ranges it
+// fetches are recorded as the progress of the watcher of the gateway.
+func (fetcher EthChainFetcher) Gateway(address common.Address, bindings *gatewaybinding.MintGatewayLogicV1) EthGatewayFetcher {
+	return EthGatewayFetcher{
+		chain:    fetcher,
+		address:  address,
+		bindings: bindings,
+		record:   true,
+	}
+}
+
+// BackfillGateway returns a fetcher for the burns of the gateway with the
+// given address, like `Gateway`, for backfills. The ranges it fetches are not
+// recorded, so that backfilling old blocks does not move the scans of the
+// chain away from the blocks that the watchers are processing.
+func (fetcher EthChainFetcher) BackfillGateway(address common.Address, bindings *gatewaybinding.MintGatewayLogicV1) EthGatewayFetcher {
+	return EthGatewayFetcher{
+		chain:    fetcher,
+		address:  address,
+		bindings: bindings,
+	}
+}
+
+// refresh scans the chain if the last scan is older than half the poll
+// interval.
+func (fetcher EthChainFetcher) refresh() {
+	fetcher.state.scanning.Lock()
+	defer fetcher.state.scanning.Unlock()
+
+	fetcher.state.mu.Lock()
+	fresh := time.Since(fetcher.state.scannedAt) < fetcher.pollInterval/2
+	fetcher.state.mu.Unlock()
+	if fresh {
+		return
+	}
+	fetcher.scan()
+}
+
+// scan fetches the head, and the burn logs of the active gateways from the
+// lowest checkpoint of their watchers. It also fetches the headers that the
+// watchers need to check for reorgs: the header after the end of the range
+// each of them last fetched, and the header at the end of the scan. The head,
+// the headers and the logs are replaced together, so that the watchers never
+// see a head beyond the logs of the scan. The scan is shared by the watchers,
+// so it does not depend on the context of the watcher that started it.
+func (fetcher EthChainFetcher) scan() {
+	ctx, cancel := context.WithTimeout(context.Background(), fetcher.pollInterval)
+	defer cancel()
+
+	head := uint64(0)
+	headers := map[uint64]*types.Header{}
+	header, err := fetcher.client.HeaderByNumber(ctx, nil)
+	if err == nil {
+		head = header.Number.Uint64()
+		headers[head] = header
+	}
+	headerAt := func(height uint64) (*types.Header, error) {
+		if header, ok := headers[height]; ok {
+			return header, nil
+		}
+		header, err := fetcher.client.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+		if err != nil {
+			return nil, err
+		}
+		headers[height] = header
+		return header, nil
+	}
+
+	// Forget the gateways whose watchers have stopped, and find the lowest
+	// checkpoint of the others.
+	fetcher.state.mu.Lock()
+	now := time.Now()
+	from := uint64(0)
+	gateways := map[common.Address]bool{}
+	addresses := []common.Address{}
+	ends := map[uint64]bool{}
+	for address, gateway := range fetcher.state.gateways {
+		if now.Sub(gateway.lastSeen) > 4*fetcher.pollInterval {
+			delete(fetcher.state.gateways, address)
+			continue
+		}
+		if len(addresses) == 0 || gateway.checkpoint < from {
+			from = gateway.checkpoint
+		}
+		gateways[address] = true
+		addresses = append(addresses, address)
+		ends[gateway.end] = true
+	}
+	fetcher.state.mu.Unlock()
+
+	// The watchers check the block after their checkpoint for reorgs, which
+	// is the block after the end of the range they last fetched. Watchers
+	// fetch the headers that are missing themselves.
+	if err == nil {
+		for end := range ends {
+			if end < head {
+				headerAt(end + 1)
+			}
+		}
+	}
+
+	var scan *chainScan
+	if err == nil && len(addresses) > 0 && head >= from+fetcher.confidence {
+		to := head - fetcher.confidence
+		if fetcher.maxRange > 0 && to > from+fetcher.maxRange {
+			to = from + fetcher.maxRange
+		}
+		scan = fetcher.scanLogs(ctx, addresses, gateways, from, to, headerAt)
+		if scan == nil {
+			delete(headers, to)
+		}
+	}
+
+	fetcher.state.mu.Lock()
+	defer fetcher.state.mu.Unlock()
+
+	fetcher.state.scannedAt = time.Now()
+	fetcher.state.head = head
+	fetcher.state.headErr = err
+	fetcher.state.headers = headers
+	fetcher.state.scan = scan
+}
+
+// scanLogs fetches the burn logs of the given gateways between the given
+// blocks. It returns nil if the logs cannot be fetched, or if the block at the
+// end of the range changes while they are fetched, as the logs may otherwise
+// be from a mix of both sides of a reorg. Watchers fall back to fetching the
+// logs themselves if the scan fails, so that they report the error.
+func (fetcher EthChainFetcher) scanLogs(ctx context.Context, addresses []common.Address, gateways map[common.Address]bool, from, to uint64, headerAt func(uint64) (*types.Header, error)) *chainScan {
+	before, err := headerAt(to)
+	if err != nil {
+		return nil
+	}
+	logs, err := fetcher.filterLogs(ctx, addresses, from, to)
+	if err != nil {
+		return nil
+	}
+	after, err := fetcher.client.HeaderByNumber(ctx, new(big.Int).SetUint64(to))
+	if err != nil || after.Hash() != before.Hash() {
+		return nil
+	}
+	return &chainScan{
+		from:     from,
+		to:       to,
+		gateways: gateways,
+		logs:     logs,
+	}
+}
+
+// FetchBlockHeight returns the head of the last scan, and scans the chain
+// first if the last scan is too old.
+func (fetcher EthChainFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	fetcher.refresh()
+
+	fetcher.state.mu.Lock()
+	defer fetcher.state.mu.Unlock()
+
+	return fetcher.state.head, fetcher.state.headErr
+}
+
+// FetchBlockHash returns the hash and the parent hash of the block at the given
+// height. The headers fetched by the last scan are served without a request.
+func (fetcher EthChainFetcher) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	fetcher.state.mu.Lock()
+	header, ok := fetcher.state.headers[height]
+	fetcher.state.mu.Unlock()
+
+	if !ok {
+		var err error
+		header, err = fetcher.client.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+		if err != nil {
+			return pack.Bytes32{}, pack.Bytes32{}, err
+		}
+	}
+	return pack.Bytes32(header.Hash()), pack.Bytes32(header.ParentHash), nil
+}
+
+// burnLogs returns the burn logs of the gateway between the given blocks. If
+// record is set, the range is recorded as the progress of the watcher of the
+// gateway, and its start is used as the checkpoint of the watcher. The logs
+// are served from the last scan if it covers the range, and fetched for the
+// gateway on its own otherwise.
+func (fetcher EthChainFetcher) burnLogs(ctx context.Context, gateway common.Address, from, to uint64, record bool) ([]types.Log, error) {
+	fetcher.state.mu.Lock()
+	if record {
+		fetcher.state.gateways[gateway] = chainGateway{checkpoint: from, end: to, lastSeen: time.Now()}
+	}
+	scan := fetcher.state.scan
+	fetcher.state.mu.Unlock()
+
+	if scan != nil && scan.gateways[gateway] && scan.from <= from && to <= scan.to {
+		return filterBurnLogs(scan.logs, gateway, from, to), nil
+	}
+	logs, err := fetcher.filterLogs(ctx, []common.Address{gateway}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return filterBurnLogs(logs, gateway, from, to), nil
+}
+
+// filterLogs returns the burn logs of the given gateways between the given
+// blocks. If the provider rejects the range, it is bisected until every part
+// is accepted or a single block is rejected.
+func (fetcher EthChainFetcher) filterLogs(ctx context.Context, addresses []common.Address, from, to uint64) ([]types.Log, error) {
+	logs, err := fetcher.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: addresses,
+		Topics:    [][]common.Hash{{logBurnTopic}},
+	})
+	if err == nil {
+		return logs, nil
+	}
+	if from >= to || !isRangeError(err) {
+		return nil, err
+	}
+
+	mid := from + (to-from)/2
+	lower, err := fetcher.filterLogs(ctx, addresses, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := fetcher.filterLogs(ctx, addresses, mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(lower, upper...), nil
+}
+
+// filterBurnLogs returns the logs of the gateway between the given blocks.
+func filterBurnLogs(logs []types.Log, gateway common.Address, from, to uint64) []types.Log {
+	filtered := []types.Log{}
+	for _, log := range logs {
+		if log.Address == gateway && log.BlockNumber >= from && log.BlockNumber <= to && !log.Removed {
+			filtered = append(filtered, log)
+		}
+	}
+	return filtered
+}
+
+// EthGatewayFetcher fetches the burns of a single gateway from the head and
+// the logs fetched for all gateways of its chain.
+type EthGatewayFetcher struct {
+	chain    EthChainFetcher
+	address  common.Address
+	bindings *gatewaybinding.MintGatewayLogicV1
+	record   bool
+}
+
+// FetchBurnLogs returns the burns of the gateway between the given blocks.
+func (fetcher EthGatewayFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	logs, err := fetcher.chain.burnLogs(ctx, fetcher.address, from, to, fetcher.record)
+	if err != nil {
+		return nil, err
+	}
+
+	burns := make([]BurnInfo, 0, len(logs))
+	for _, log := range logs {
+		event, err := fetcher.bindings.ParseLogBurn(log)
+		if err != nil {
+			return nil, fmt.Errorf("decoding LogBurn event in tx=%v: %v", log.TxHash.Hex(), err)
+		}
+		burns = append(burns, burnInfo(event))
+	}
+	resultChan := make(chan BurnLogResult, len(burns))
+	for _, burn := range burns {
+		resultChan <- BurnLogResult{Result: burn}
+	}
+	close(resultChan)
+	return resultChan, nil
+}
+
+// FetchBlockHeight returns the head of the chain.
+func (fetcher EthGatewayFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return fetcher.chain.FetchBlockHeight(ctx)
+}
+
+// FetchBlockHash returns the hash and the parent hash of the block at the given
+// height.
+func (fetcher EthGatewayFetcher) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	return fetcher.chain.FetchBlockHash(ctx, height)
+}
@@ -0,0 +1,52 @@
+package watcher
+
+import "time"
+
+// The methods below drive the state of a subscription, so that the tests can
+// push heads and burns without a WebSocket connection.
+
+// StartSubscription records that the subscription was established at the given
+// head.
+func (fetcher EthSubscriptionFetcher) StartSubscription(head uint64) {
+	fetcher.state.start(head)
+}
+
+// StopSubscription records that the subscription was dropped.
+func (fetcher EthSubscriptionFetcher) StopSubscription() {
+	fetcher.state.stop()
+}
+
+// PushHead pushes a new head.
+func (fetcher EthSubscriptionFetcher) PushHead(head uint64) {
+	fetcher.state.observeHead(head)
+}
+
+// StartSubscription records that the subscription of the chain was
+// established at the given head.
+func (subscription EthChainSubscription) StartSubscription(head uint64) {
+	subscription.start(head)
+}
+
+// PushHead pushes a new head to the gateways of the chain.
+func (subscription EthChainSubscription) PushHead(head uint64) {
+	subscription.observeHead(head)
+}
+
+// PushBurn pushes a burn with the given log index.
+func (fetcher EthSubscriptionFetcher) PushBurn(burn BurnInfo, index uint) {
+	fetcher.state.add(burn, index)
+}
+
+// RemoveBurn pushes the removal of a burn by a reorg.
+func (fetcher EthSubscriptionFetcher) RemoveBurn(burn BurnInfo, index uint) {
+	fetcher.state.remove(burn.BlockNumber.Uint64(), burn.Txid, index)
+}
+
+// Expire marks the last scan of the chain as stale, so that the next fetch of
+// the head scans the chain again.
+func (fetcher EthChainFetcher) Expire() {
+	fetcher.state.mu.Lock()
+	defer fetcher.state.mu.Unlock()
+
+	fetcher.state.scannedAt = time.Time{}
+}
@@ -0,0 +1,256 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxHeadLag is the default number of blocks that the head of an RPC
+// endpoint can differ from the median head of all endpoints before it is
+// ignored.
+const DefaultMaxHeadLag = uint64(20)
+
+// Endpoint is an RPC endpoint that burns can be fetched from.
+type Endpoint struct {
+	// Name identifies the endpoint in logs. It should not contain any API keys
+	// that are part of the URL of the endpoint.
+	Name               string
+	BurnLogFetcher     BurnLogFetcher
+	BlockHeightFetcher BlockHeightFetcher
+}
+
+// FailoverFetcher fetches burns from one of several RPC endpoints for the same
+// chain. Every time the block height is fetched, the heads of all endpoints
+// are fetched and cross-checked against their median: endpoints that fail, or
+// whose head is more than the maximum number of blocks behind or ahead of the
+// median, are ignored until they recover. Using the median means that a single
+// endpoint reporting a head far in the future cannot make all of the others
+// look like they are lagging. Burns are fetched from the first healthy
+// endpoint, in the order the endpoints were given, and the fetcher fails over
+// to the next one when fetching burns fails.
+type FailoverFetcher struct {
+	logger    logrus.FieldLogger
+	chain     string
+	endpoints []Endpoint
+	maxLag    uint64
+	state     *failoverState
+}
+
+// failoverState is the health of the endpoints as of the last time their heads
+// were fetched.
+type failoverState struct {
+	mu      *sync.Mutex
+	healthy []bool
+	heads   []uint64
+	active  int
+}
+
+// NewFailoverFetcher returns a fetcher that fails over between the given
+// endpoints, which must all be for the given chain. At least one endpoint must
+// be given.
+func NewFailoverFetcher(logger logrus.FieldLogger, chain string, endpoints []Endpoint, maxLag uint64) FailoverFetcher {
+	if len(endpoints) == 0 {
+		panic("no endpoints specified")
+	}
+	healthy := make([]bool, len(endpoints))
+	for i := range healthy {
+		healthy[i] = true
+	}
+	return FailoverFetcher{
+		logger:    logger,
+		chain:     chain,
+		endpoints: endpoints,
+		maxLag:    maxLag,
+		state: &failoverState{
+			mu:      new(sync.Mutex),
+			healthy: healthy,
+			heads:   make([]uint64, len(endpoints)),
+		},
+	}
+}
+
+// FetchBlockHeight fetches the heads of all endpoints, updates which of them
+// are healthy, and returns the head of the endpoint that burns will be fetched
+// from.
+func (fetcher FailoverFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	heads := make([]uint64, len(fetcher.endpoints))
+	errs := make([]error, len(fetcher.endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range fetcher.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint Endpoint) {
+			defer wg.Done()
+			heads[i], errs[i] = endpoint.BlockHeightFetcher.FetchBlockHeight(ctx)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	reference := medianHead(heads, errs)
+
+	fetcher.state.mu.Lock()
+	defer fetcher.state.mu.Unlock()
+
+	failures := []string{}
+	for i, endpoint := range fetcher.endpoints {
+		healthy := true
+		switch {
+		case errs[i] != nil:
+			healthy = false
+			failures = append(failures, fmt.Sprintf("%v: %v", endpoint.Name, errs[i]))
+		case heads[i]+fetcher.maxLag < reference:
+			healthy = false
+			failures = append(failures, fmt.Sprintf("%v: head=%v is behind head=%v", endpoint.Name, heads[i], reference))
+		case heads[i] > reference+fetcher.maxLag:
+			healthy = false
+			failures = append(failures, fmt.Sprintf("%v: head=%v is ahead of head=%v", endpoint.Name, heads[i], reference))
+		}
+		if healthy != fetcher.state.healthy[i] {
+			if healthy {
+				fetcher.logger.Infof("[watcher] %v rpc %v recovered at head=%v", fetcher.chain, endpoint.Name, heads[i])
+			} else {
+				fetcher.logger.Warnf("[watcher] ignoring %v rpc %v", fetcher.chain, failures[len(failures)-1])
+			}
+		}
+		fetcher.state.healthy[i] = healthy
+		fetcher.state.heads[i] = heads[i]
+	}
+
+	active, ok := fetcher.nextHealthy(len(fetcher.endpoints)-1, 0)
+	if !ok {
+		return 0, fmt.Errorf("no healthy %v rpc: %v", fetcher.chain, strings.Join(failures, "; "))
+	}
+	fetcher.activate(active)
+	return heads[active], nil
+}
+
+// medianHead returns the median of the heads that were fetched without an
+// error. With an even number of heads the higher of the two middle heads is
+// used, so that with two endpoints the one that is behind is ignored.
+func medianHead(heads []uint64, errs []error) uint64 {
+	fetched := make([]uint64, 0, len(heads))
+	for i := range heads {
+		if errs[i] == nil {
+			fetched = append(fetched, heads[i])
+		}
+	}
+	if len(fetched) == 0 {
+		return 0
+	}
+	sort.Slice(fetched, func(i, j int) bool {
+		return fetched[i] < fetched[j]
+	})
+	return fetched[len(fetched)/2]
+}
+
+// FetchBurnLogs fetches the burns between the given blocks from the active
+// endpoint. If the endpoint fails to start fetching, it is marked as
+// unhealthy and the next healthy endpoint is tried. If it fails part-way
+// through, it is marked as unhealthy so that the next scan uses another
+// endpoint.
+func (fetcher FailoverFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	fetcher.state.mu.Lock()
+	active := fetcher.state.active
+	fetcher.state.mu.Unlock()
+
+	failures := []string{}
+	for {
+		endpoint := fetcher.endpoints[active]
+		c, err := endpoint.BurnLogFetcher.FetchBurnLogs(ctx, from, to)
+		if err == nil {
+			return fetcher.watch(ctx, active, c), nil
+		}
+		failures = append(failures, fmt.Sprintf("%v: %v", endpoint.Name, err))
+
+		fetcher.state.mu.Lock()
+		fetcher.fail(active, err)
+		// Only fail over to endpoints that have seen the whole range, as
+		// providers return no logs for blocks that they have not seen yet.
+		next, ok := fetcher.nextHealthy(active, to)
+		if ok {
+			fetcher.activate(next)
+		}
+		fetcher.state.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("no healthy %v rpc: %v", fetcher.chain, strings.Join(failures, "; "))
+		}
+		active = next
+	}
+}
+
+// FetchBlockHash fetches the hash of the block at the given height from the
+// active endpoint, so that it is consistent with the burns fetched from it.
+func (fetcher FailoverFetcher) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	fetcher.state.mu.Lock()
+	endpoint := fetcher.endpoints[fetcher.state.active]
+	fetcher.state.mu.Unlock()
+
+	hashFetcher, ok := endpoint.BlockHeightFetcher.(BlockHashFetcher)
+	if !ok {
+		return pack.Bytes32{}, pack.Bytes32{}, fmt.Errorf("%v rpc %v cannot fetch block hashes", fetcher.chain, endpoint.Name)
+	}
+	return hashFetcher.FetchBlockHash(ctx, height)
+}
+
+// watch forwards the results of the given endpoint, and marks the endpoint as
+// unhealthy if it returns an error.
+func (fetcher FailoverFetcher) watch(ctx context.Context, i int, c chan BurnLogResult) chan BurnLogResult {
+	resultChan := make(chan BurnLogResult)
+	go func() {
+		defer close(resultChan)
+		for res := range c {
+			if res.Error != nil && res.Error != context.Canceled && res.Error != context.DeadlineExceeded {
+				fetcher.state.mu.Lock()
+				fetcher.fail(i, res.Error)
+				fetcher.state.mu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+				// Drain the channel so that the endpoint is not blocked.
+				for range c {
+				}
+				return
+			case resultChan <- res:
+			}
+		}
+	}()
+	return resultChan
+}
+
+// fail marks the endpoint as unhealthy until its head is fetched again. It
+// must be called with the lock held.
+func (fetcher FailoverFetcher) fail(i int, err error) {
+	if fetcher.state.healthy[i] {
+		fetcher.logger.Warnf("[watcher] ignoring %v rpc %v: %v", fetcher.chain, fetcher.endpoints[i].Name, err)
+	}
+	fetcher.state.healthy[i] = false
+}
+
+// nextHealthy returns the first healthy endpoint after the given one whose
+// head has reached the given height, in the order the endpoints were given,
+// wrapping around to the first endpoint. It must be called with the lock held.
+func (fetcher FailoverFetcher) nextHealthy(after int, minHead uint64) (int, bool) {
+	n := len(fetcher.endpoints)
+	for j := 1; j <= n; j++ {
+		i := (after + j) % n
+		if fetcher.state.healthy[i] && fetcher.state.heads[i] >= minHead {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// activate switches the endpoint that burns are fetched from. It must be
+// called with the lock held.
+func (fetcher FailoverFetcher) activate(i int) {
+	if i == fetcher.state.active {
+		return
+	}
+	fetcher.logger.Warnf("[watcher] switching %v rpc from %v to %v", fetcher.chain, fetcher.endpoints[fetcher.state.active].Name, fetcher.endpoints[i].Name)
+	fetcher.state.active = i
+}
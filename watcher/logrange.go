@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/renproject/darknode/binding/gatewaybinding"
+)
+
+// targetLogsPerScan is the number of burn logs that the watcher aims to process
+// in each scan. The number of blocks scanned at a time shrinks when scans
+// return more logs than this, and grows when they return far fewer.
+const targetLogsPerScan = 100
+
+// rangeErrors are fragments of the errors returned by RPC providers when a log
+// query spans too many blocks or returns too many results.
+var rangeErrors = []string{
+	"more than 10000 results",
+	"query returned more than",
+	"block range",
+	"range is too large",
+	"range too large",
+	"limit exceeded",
+	"response size exceeded",
+	"too many blocks",
+	"too many results",
+	"query timeout exceeded",
+}
+
+// isRangeError returns whether the error was returned because the queried
+// range of blocks was too large.
+func isRangeError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, fragment := range rangeErrors {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLogBurn returns iterators over the burn logs between the given
+// blocks. If the provider rejects the range, it is bisected until every part
+// is accepted or a single block is rejected.
+func (fetcher EthBurnLogFetcher) filterLogBurn(ctx context.Context, from, to uint64) ([]*gatewaybinding.MintGatewayLogicV1LogBurnIterator, error) {
+	iter, err := fetcher.bindings.FilterLogBurn(
+		&bind.FilterOpts{
+			Context: ctx,
+			Start:   from,
+			End:     &to,
+		},
+		nil,
+		nil,
+	)
+	if err == nil {
+		return []*gatewaybinding.MintGatewayLogicV1LogBurnIterator{iter}, nil
+	}
+	if from >= to || !isRangeError(err) {
+		return nil, err
+	}
+
+	mid := from + (to-from)/2
+	lower, err := fetcher.filterLogBurn(ctx, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := fetcher.filterLogBurn(ctx, mid+1, to)
+	if err != nil {
+		for _, iter := range lower {
+			iter.Close()
+		}
+		return nil, err
+	}
+	return append(lower, upper...), nil
+}
+
+// blockAdvance is the number of blocks that the watcher scans at a time. It
+// adapts to the density of burn logs, and never exceeds the configured
+// maximum. It is safe for concurrent use.
+type blockAdvance struct {
+	mu      *sync.Mutex
+	current uint64
+	max     uint64
+}
+
+func newBlockAdvance(max uint64) *blockAdvance {
+	return &blockAdvance{
+		mu:      new(sync.Mutex),
+		current: max,
+		max:     max,
+	}
+}
+
+// get returns the number of blocks to scan.
+func (advance *blockAdvance) get() uint64 {
+	advance.mu.Lock()
+	defer advance.mu.Unlock()
+
+	return advance.current
+}
+
+// observe adapts the number of blocks to scan to the number of logs returned
+// by the last scan.
+func (advance *blockAdvance) observe(logs int) {
+	switch {
+	case logs > targetLogsPerScan:
+		advance.shrink()
+	case logs < targetLogsPerScan/4:
+		advance.grow()
+	}
+}
+
+// shrink halves the number of blocks to scan, for example after a scan failed.
+func (advance *blockAdvance) shrink() {
+	advance.mu.Lock()
+	defer advance.mu.Unlock()
+
+	if advance.current > 1 {
+		advance.current /= 2
+	}
+}
+
+// grow doubles the number of blocks to scan, up to the maximum.
+func (advance *blockAdvance) grow() {
+	advance.mu.Lock()
+	defer advance.mu.Unlock()
+
+	advance.current *= 2
+	if advance.current > advance.max || advance.current == 0 {
+		advance.current = advance.max
+	}
+}
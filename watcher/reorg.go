@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/renproject/pack"
+)
+
+// BlockHashFetcher is implemented by a `BlockHeightFetcher` for chains that
+// can reorg. It returns the hash and the parent hash of the block at the given
+// height, which the `Watcher` uses to detect reorgs.
+type BlockHashFetcher interface {
+	FetchBlockHash(ctx context.Context, height uint64) (hash pack.Bytes32, parentHash pack.Bytes32, err error)
+}
+
+// FetchBlockHash returns the hash and the parent hash of the block at the given
+// height.
+func (fetcher EthBlockHeightFetcher) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	header, err := fetcher.client.HeaderByNumber(ctx, new(big.Int).SetUint64(height))
+	if err != nil {
+		return pack.Bytes32{}, pack.Bytes32{}, err
+	}
+	return pack.Bytes32(header.Hash()), pack.Bytes32(header.ParentHash), nil
+}
+
+// blockHash returns the hash of the block at the given height, which is
+// stored along with the checkpoint at that height.
+func blockHash(ctx context.Context, fetcher BlockHashFetcher, height uint64) (string, error) {
+	hash, _, err := fetcher.FetchBlockHash(ctx, height)
+	if err != nil {
+		return "", fmt.Errorf("fetching block hash at %v: %v", height, err)
+	}
+	return hash.String(), nil
+}
+
+// checkReorg checks that the block after the last checkpoint builds on the
+// block that was recorded at the checkpoint. If it does not, the chain has
+// reorged, and the checkpoint is rewound to the most recent checkpoint whose
+// block is still part of the chain, so that the affected range is scanned
+// again. It returns whether the checkpoint was rewound.
+func (watcher Watcher) checkReorg(ctx context.Context, fetcher BlockHashFetcher, lastHeight uint64) (bool, error) {
+	hashes, err := watcher.database.WatcherBlockHashes(watcher.selector)
+	if err != nil {
+		return false, fmt.Errorf("loading block hashes: %v", err)
+	}
+	expected, ok := hashes[lastHeight]
+	if !ok {
+		// The checkpoint was set before block hashes were recorded, so there
+		// is nothing to check against.
+		return false, nil
+	}
+	_, parentHash, err := fetcher.FetchBlockHash(ctx, lastHeight+1)
+	if err != nil {
+		return false, fmt.Errorf("fetching block hash at %v: %v", lastHeight+1, err)
+	}
+	if parentHash.String() == expected {
+		return false, nil
+	}
+
+	// Find the most recent checkpoint that is still part of the chain. If
+	// there is none, rewind as far as a single scan can advance.
+	rewind := uint64(0)
+	if lastHeight > watcher.maxBlockAdvance {
+		rewind = lastHeight - watcher.maxBlockAdvance
+	}
+	for _, height := range sortedHeights(hashes) {
+		if height >= lastHeight {
+			continue
+		}
+		hash, _, err := fetcher.FetchBlockHash(ctx, height)
+		if err != nil {
+			return false, fmt.Errorf("fetching block hash at %v: %v", height, err)
+		}
+		if hash.String() == hashes[height] {
+			rewind = height
+			break
+		}
+	}
+
+	watcher.logger.Warnf("[watcher] detected reorg for %v at block=%v, rewinding to block=%v", watcher.selector.String(), lastHeight, rewind)
+	// Rewinding the checkpoint also removes the hashes of the orphaned
+	// blocks.
+	if err := watcher.database.UpdateWatcherCheckpoint(watcher.selector, rewind, "", nil); err != nil {
+		return false, fmt.Errorf("rewinding last checked block: %v", err)
+	}
+	return true, nil
+}
+
+// sortedHeights returns the heights of the given block hashes, from the most
+// recent to the oldest.
+func sortedHeights(hashes map[uint64]string) []uint64 {
+	heights := make([]uint64, 0, len(hashes))
+	for height := range hashes {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] > heights[j]
+	})
+	return heights
+}
@@ -0,0 +1,434 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	solanaSDK "github.com/dfuse-io/solana-go"
+	solanaRPC "github.com/dfuse-io/solana-go/rpc"
+	"github.com/jbenet/go-base58"
+	"github.com/near/borsh-go"
+	"github.com/renproject/darknode/binding/solanastate"
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/chain/solana"
+	"github.com/renproject/pack"
+)
+
+// DefaultSolanaGatewayStateSeed is the seed of the account that stores the
+// state of a Solana gateway, for the current version of the gateways.
+const DefaultSolanaGatewayStateSeed = "GatewayStateV0.1.4"
+
+// solanaBatchSize is the maximum number of burn accounts fetched with a single
+// `getMultipleAccounts` call.
+const solanaBatchSize = 100
+
+// solanaBurnDataLen is the length of the data of a burn account.
+const solanaBurnDataLen = 65
+
+// DefaultSolanaPendingTimeout is how long a burn can stay pending before it is
+// given up on and stored as a dead letter.
+const DefaultSolanaPendingTimeout = 24 * time.Hour
+
+// SolFetcher fetches the burns of a Solana gateway. Burns are indexed by
+// their nonce instead of the block they were made in, so the "block height"
+// of the gateway is the number of burns it has processed.
+//
+// Burns whose account cannot be fetched, or whose transaction is not
+// confirmed yet, are recorded as pending and retried by later fetches, so
+// that they do not hold back the burns after them. Burns that are still
+// pending after the pending timeout are stored as dead letters, so that they
+// can be handled manually instead of being retried forever.
+type SolFetcher struct {
+	client           *solanaRPC.Client
+	rpcURL           string
+	httpClient       *http.Client
+	database         db.DB
+	selector         tx.Selector
+	gatewayStatePubk solanaSDK.PublicKey
+	gatewayAddress   string
+	pendingTimeout   time.Duration
+	emitted          *solanaEmitted
+}
+
+// solanaEmitted are the pending nonces emitted by the last fetch. They are
+// only removed from the pending nonces once the next fetch starts after the
+// last fetch, which means that the watcher has processed them.
+type solanaEmitted struct {
+	mu     *sync.Mutex
+	to     uint64
+	nonces []uint64
+}
+
+// NewSolFetcher returns a fetcher for the burns of the Solana gateway with the
+// given address. The RPC URL must point to the same node as the client. Pending
+// burns are stored in the database under the given selector, and burns that
+// are given up on are stored as its dead letters. The seed of the gateway
+// state account depends on the version of the gateway; if it is empty,
+// `DefaultSolanaGatewayStateSeed` is used.
+func NewSolFetcher(client *solanaRPC.Client, rpcURL string, database db.DB, selector tx.Selector, gatewayAddress, stateSeed string) SolFetcher {
+	if stateSeed == "" {
+		stateSeed = DefaultSolanaGatewayStateSeed
+	}
+	programDerivedAddress := solana.ProgramDerivedAddress(pack.Bytes(stateSeed), multichain.Address(gatewayAddress))
+	programPubk, err := solanaSDK.PublicKeyFromBase58(string(programDerivedAddress))
+	if err != nil {
+		panic("invalid pubk")
+	}
+
+	return SolFetcher{
+		client:           client,
+		rpcURL:           rpcURL,
+		httpClient:       &http.Client{Timeout: time.Minute},
+		database:         database,
+		selector:         selector,
+		gatewayStatePubk: programPubk,
+		gatewayAddress:   gatewayAddress,
+		pendingTimeout:   DefaultSolanaPendingTimeout,
+		emitted: &solanaEmitted{
+			mu: new(sync.Mutex),
+		},
+	}
+}
+
+// FetchBurnLogs fetches the burns with nonces between from (inclusive) and to
+// (exclusive), along with the pending burns of previous fetches. The burn
+// accounts are fetched in batches.
+func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	nonces, err := fetcher.noncesToFetch(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading pending burns: %v", err)
+	}
+
+	resultChan := make(chan BurnLogResult)
+	go func() {
+		defer close(resultChan)
+
+		emitted := []uint64{}
+		defer func() {
+			fetcher.emitted.mu.Lock()
+			defer fetcher.emitted.mu.Unlock()
+
+			fetcher.emitted.to = to
+			fetcher.emitted.nonces = emitted
+		}()
+
+		for start := 0; start < len(nonces); start += solanaBatchSize {
+			end := start + solanaBatchSize
+			if end > len(nonces) {
+				end = len(nonces)
+			}
+			burns, err := fetcher.fetchBurns(ctx, nonces[start:end])
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case resultChan <- BurnLogResult{Error: err}:
+				}
+				return
+			}
+			for _, burn := range burns {
+				// Send the burn transaction to the resolver.
+				select {
+				case <-ctx.Done():
+					return
+				case resultChan <- BurnLogResult{Result: burn}:
+				}
+				if nonce := uint64(burn.BlockNumber); nonce < from {
+					emitted = append(emitted, nonce)
+				}
+			}
+		}
+	}()
+
+	return resultChan, nil
+}
+
+// fetchBurns returns the burns with the given nonces whose account and
+// transaction could be fetched. The other nonces are recorded as pending.
+func (fetcher SolFetcher) fetchBurns(ctx context.Context, nonces []uint64) ([]BurnInfo, error) {
+	pubks := make([]solanaSDK.PublicKey, len(nonces))
+	for i, nonce := range nonces {
+		pubk, err := fetcher.burnAccount(nonce)
+		if err != nil {
+			return nil, fmt.Errorf("getting burn log account: %v", err)
+		}
+		pubks[i] = pubk
+	}
+
+	accounts, err := fetcher.getMultipleAccounts(ctx, pubks)
+	if err != nil {
+		return nil, fmt.Errorf("getting burn log data for burns %v-%v: %v", nonces[0], nonces[len(nonces)-1], err)
+	}
+
+	// Only look up the transactions of the burns whose account exists.
+	burned := []int{}
+	burnedPubks := []solanaSDK.PublicKey{}
+	for i := range nonces {
+		if len(accounts[i]) == solanaBurnDataLen {
+			burned = append(burned, i)
+			burnedPubks = append(burnedPubks, pubks[i])
+		}
+	}
+	signatures := make([]string, len(nonces))
+	if len(burnedPubks) > 0 {
+		burnedSignatures, err := fetcher.getSignatures(ctx, burnedPubks)
+		if err != nil {
+			return nil, fmt.Errorf("getting burn transactions for burns %v-%v: %v", nonces[0], nonces[len(nonces)-1], err)
+		}
+		for j, i := range burned {
+			signatures[i] = burnedSignatures[j]
+		}
+	}
+
+	burns := []BurnInfo{}
+	pending := []uint64{}
+	for i, nonce := range nonces {
+		data := accounts[i]
+		if len(data) != solanaBurnDataLen || signatures[i] == "" {
+			pending = append(pending, nonce)
+			continue
+		}
+
+		amount := [32]byte{}
+		copy(amount[:], data[0:32])
+		recipientLen := int(data[32])
+		if 33+recipientLen > len(data) {
+			pending = append(pending, nonce)
+			continue
+		}
+		recipient := multichain.RawAddress(data[33 : 33+recipientLen])
+
+		var nonceBytes pack.Bytes32
+		copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
+
+		burns = append(burns, BurnInfo{
+			Txid:        base58.Decode(signatures[i]),
+			Amount:      pack.NewU256(amount),
+			ToBytes:     recipient[:],
+			Nonce:       nonceBytes,
+			BlockNumber: pack.NewU64(nonce),
+		})
+	}
+
+	if err := fetcher.database.InsertWatcherPendingNonces(fetcher.selector, pending, time.Now()); err != nil {
+		return nil, fmt.Errorf("storing pending burns: %v", err)
+	}
+	return burns, nil
+}
+
+// burnAccount returns the address of the account that stores the burn with the
+// given nonce.
+func (fetcher SolFetcher) burnAccount(nonce uint64) (solanaSDK.PublicKey, error) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, nonce)
+	programDerivedAddress := solana.ProgramDerivedAddress(b, multichain.Address(fetcher.gatewayAddress))
+	return solanaSDK.PublicKeyFromBase58(string(programDerivedAddress))
+}
+
+// noncesToFetch returns the pending nonces below the range, followed by the
+// nonces in the range. Pending nonces that were emitted by the last fetch are
+// no longer pending if the range starts after the last fetch. Pending nonces
+// that have been pending for longer than the pending timeout are stored as
+// dead letters and are no longer fetched.
+func (fetcher SolFetcher) noncesToFetch(from, to uint64) ([]uint64, error) {
+	fetcher.emitted.mu.Lock()
+	if from >= fetcher.emitted.to && len(fetcher.emitted.nonces) > 0 {
+		if err := fetcher.database.DeleteWatcherPendingNonces(fetcher.selector, fetcher.emitted.nonces); err != nil {
+			fetcher.emitted.mu.Unlock()
+			return nil, err
+		}
+		fetcher.emitted.nonces = nil
+	}
+	fetcher.emitted.mu.Unlock()
+
+	pending, err := fetcher.database.WatcherPendingNonces(fetcher.selector)
+	if err != nil {
+		return nil, err
+	}
+	nonces := []uint64{}
+	expired := []uint64{}
+	for nonce, since := range pending {
+		if nonce >= from {
+			continue
+		}
+		if time.Since(since) > fetcher.pendingTimeout {
+			letter := db.WatcherDeadLetter{
+				Selector: fetcher.selector,
+				Nonce:    strconv.FormatUint(nonce, 10),
+				Amount:   pack.NewU256FromU64(0),
+				Error:    fmt.Sprintf("burn still pending after %v", fetcher.pendingTimeout),
+			}
+			if err := fetcher.database.InsertWatcherDeadLetter(letter); err != nil {
+				return nil, fmt.Errorf("storing dead letter for burn with nonce=%v: %v", nonce, err)
+			}
+			expired = append(expired, nonce)
+			continue
+		}
+		nonces = append(nonces, nonce)
+	}
+	if err := fetcher.database.DeleteWatcherPendingNonces(fetcher.selector, expired); err != nil {
+		return nil, err
+	}
+	sort.Slice(nonces, func(i, j int) bool {
+		return nonces[i] < nonces[j]
+	})
+	for nonce := from; nonce < to; nonce++ {
+		nonces = append(nonces, nonce)
+	}
+	return nonces, nil
+}
+
+// getSignatures returns the signature of the most recent confirmed transaction
+// of each of the given accounts, which for a burn account is the burn
+// transaction. The signature of an account without a confirmed transaction is
+// empty. The RPC has no method that takes several addresses, so the lookups
+// are sent as a single JSON-RPC batch to avoid a round trip per burn.
+func (fetcher SolFetcher) getSignatures(ctx context.Context, pubks []solanaSDK.PublicKey) ([]string, error) {
+	reqs := make([]interface{}, len(pubks))
+	for i, pubk := range pubks {
+		reqs[i] = map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      i,
+			"method":  "getConfirmedSignaturesForAddress2",
+			"params": []interface{}{
+				pubk.String(),
+				map[string]interface{}{"limit": 1},
+			},
+		}
+	}
+	body, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, fetcher.rpcURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := fetcher.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var responses []struct {
+		ID     int `json:"id"`
+		Result []struct {
+			Signature string `json:"signature"`
+		} `json:"result"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responses); err != nil {
+		return nil, fmt.Errorf("decoding response: %v", err)
+	}
+
+	// Responses to a batch can arrive in any order. Accounts whose lookup
+	// failed are treated as not confirmed, so that they are retried.
+	signatures := make([]string, len(pubks))
+	for _, response := range responses {
+		if response.ID < 0 || response.ID >= len(pubks) || response.Error != nil || len(response.Result) == 0 {
+			continue
+		}
+		signatures[response.ID] = response.Result[0].Signature
+	}
+	return signatures, nil
+}
+
+// getMultipleAccounts returns the data of the given accounts. The data of
+// accounts that do not exist is nil.
+func (fetcher SolFetcher) getMultipleAccounts(ctx context.Context, pubks []solanaSDK.PublicKey) ([][]byte, error) {
+	keys := make([]string, len(pubks))
+	for i, pubk := range pubks {
+		keys[i] = pubk.String()
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "getMultipleAccounts",
+		"params": []interface{}{
+			keys,
+			map[string]string{"encoding": "base64"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequest(http.MethodPost, fetcher.rpcURL, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := fetcher.httpClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result *struct {
+			Value []*struct {
+				Data []string `json:"data"`
+			} `json:"value"`
+		} `json:"result"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decoding response: %v", err)
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("[%v] %v", response.Error.Code, response.Error.Message)
+	}
+	if response.Result == nil || len(response.Result.Value) != len(keys) {
+		return nil, fmt.Errorf("expected %v accounts", len(keys))
+	}
+
+	accounts := make([][]byte, len(keys))
+	for i, account := range response.Result.Value {
+		if account == nil || len(account.Data) == 0 {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(account.Data[0])
+		if err != nil {
+			return nil, fmt.Errorf("decoding account %v: %v", keys[i], err)
+		}
+		accounts[i] = data
+	}
+	return accounts, nil
+}
+
+// FetchBlockHeight returns the number of burns processed by the gateway, which
+// is the maximum burn index that should be fetched.
+func (fetcher SolFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	accountData, err := fetcher.client.GetAccountInfo(ctx, fetcher.gatewayStatePubk)
+	if err != nil {
+		return 0, fmt.Errorf("getting gateway data: %v", err)
+	}
+
+	// Deserialize the account data into registry state's structure.
+	gateway := solanastate.Gateway{}
+	if err = borsh.Deserialize(&gateway, accountData.Value.Data); err != nil {
+		return 0, fmt.Errorf("deserializing account data: %v", err)
+	}
+	// We increment the burnCount by 1, as internally its indexes start at 1
+	return uint64(gateway.BurnCount) + 1, nil
+}
@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/multichain"
+	"github.com/renproject/pack"
+)
+
+// StatusWindow is the window over which the burns found by a watcher are
+// counted.
+const StatusWindow = time.Hour
+
+// Status describes the progress of a watcher, so that stuck watchers can be
+// detected from outside the Lightnode.
+type Status struct {
+	Selector          tx.Selector      `json:"selector"`
+	Chain             multichain.Chain `json:"chain"`
+	Asset             multichain.Asset `json:"asset"`
+	LastCheckedHeight pack.U64         `json:"lastCheckedHeight"`
+	Head              pack.U64         `json:"head"`
+	Lag               pack.U64         `json:"lag"`
+	LastError         string           `json:"lastError,omitempty"`
+	LastErrorTime     pack.U64         `json:"lastErrorTime,omitempty"`
+	LastSuccessTime   pack.U64         `json:"lastSuccessTime,omitempty"`
+	BurnsInWindow     pack.U64         `json:"burnsInWindow"`
+	Window            pack.U64         `json:"window"`
+	Paused            bool             `json:"paused"`
+}
+
+// statusTracker records the progress of a watcher. It is safe for concurrent
+// use.
+type statusTracker struct {
+	mu            *sync.Mutex
+	checkpoint    uint64
+	head          uint64
+	lastError     string
+	lastErrorTime time.Time
+	lastSuccess   time.Time
+	burns         []time.Time
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		mu:    new(sync.Mutex),
+		burns: []time.Time{},
+	}
+}
+
+// observeHead records the latest block of the chain.
+func (tracker *statusTracker) observeHead(head uint64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.head = head
+}
+
+// observeCheckpoint records the last block checked by the watcher.
+func (tracker *statusTracker) observeCheckpoint(checkpoint uint64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.checkpoint = checkpoint
+}
+
+// succeed records that a scan moved the checkpoint to the given block. The
+// error of the last failed scan is cleared, as the watcher has recovered.
+func (tracker *statusTracker) succeed(checkpoint uint64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.checkpoint = checkpoint
+	tracker.lastError = ""
+	tracker.lastErrorTime = time.Time{}
+	tracker.lastSuccess = time.Now()
+}
+
+// observeBurns records that burns were found.
+func (tracker *statusTracker) observeBurns(n int) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < n; i++ {
+		tracker.burns = append(tracker.burns, now)
+	}
+	tracker.prune(now)
+}
+
+// fail records the error that stopped the last scan.
+func (tracker *statusTracker) fail(format string, args ...interface{}) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.lastError = fmt.Sprintf(format, args...)
+	tracker.lastErrorTime = time.Now()
+}
+
+// prune removes the burns found before the window. It must be called with the
+// mutex held.
+func (tracker *statusTracker) prune(now time.Time) {
+	i := 0
+	for i < len(tracker.burns) && now.Sub(tracker.burns[i]) > StatusWindow {
+		i++
+	}
+	tracker.burns = tracker.burns[i:]
+}
+
+// Status returns the progress of the watcher. The watcher is reported as
+// running; callers that stop watchers are expected to set the paused state.
+func (watcher Watcher) Status() Status {
+	tracker := watcher.status
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.prune(time.Now())
+	status := Status{
+		Selector:          watcher.selector,
+		Chain:             watcher.selector.Source(),
+		Asset:             watcher.selector.Asset(),
+		LastCheckedHeight: pack.NewU64(tracker.checkpoint),
+		Head:              pack.NewU64(tracker.head),
+		LastError:         tracker.lastError,
+		BurnsInWindow:     pack.NewU64(uint64(len(tracker.burns))),
+		Window:            pack.NewU64(uint64(StatusWindow.Seconds())),
+	}
+	if tracker.head > tracker.checkpoint {
+		status.Lag = pack.NewU64(tracker.head - tracker.checkpoint)
+	}
+	if !tracker.lastErrorTime.IsZero() {
+		status.LastErrorTime = pack.NewU64(uint64(tracker.lastErrorTime.Unix()))
+	}
+	if !tracker.lastSuccess.IsZero() {
+		status.LastSuccessTime = pack.NewU64(uint64(tracker.lastSuccess.Unix()))
+	}
+	return status
+}
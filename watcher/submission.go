@@ -0,0 +1,65 @@
+package watcher
+
+import (
+	"database/sql"
+
+	"github.com/renproject/id"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/pack"
+)
+
+// submissionStatus returns the outcome of submitting the burn with the given
+// nonce, so that burns that have already been accepted are not submitted
+// again. The outcome only applies to the burn if the same transaction was
+// submitted for it, as a reorg can replace a burn with a different burn with
+// the same nonce, which is treated as a new burn. Accepted burns are marked as
+// done once their transaction has been submitted to the Darknodes.
+func (watcher Watcher) submissionStatus(nonce string, hash id.Hash) (db.WatcherNonceStatus, error) {
+	status, submitted, err := watcher.database.WatcherNonceStatus(watcher.selector, nonce)
+	if err == sql.ErrNoRows {
+		return db.WatcherNonceStatusNil, nil
+	}
+	if err == nil && submitted != hash.String() {
+		return db.WatcherNonceStatusNil, nil
+	}
+	if err != nil || status != db.WatcherNonceStatusAccepted {
+		return status, err
+	}
+
+	txStatus, err := watcher.database.TxStatus(hash)
+	if err == sql.ErrNoRows {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	if txStatus != db.TxStatusSubmitted {
+		return status, nil
+	}
+	return db.WatcherNonceStatusDone, watcher.database.UpdateWatcherNonceStatus(watcher.selector, nonce, hash.String(), db.WatcherNonceStatusDone)
+}
+
+// updateSubmissionStatus stores the outcome of submitting the transaction with
+// the given hash for the burn with the given nonce. Failures are only logged,
+// as the outcome is only used to avoid submitting burns again.
+func (watcher Watcher) updateSubmissionStatus(nonce string, hash id.Hash, status db.WatcherNonceStatus) {
+	if err := watcher.database.UpdateWatcherNonceStatus(watcher.selector, nonce, hash.String(), status); err != nil {
+		watcher.logger.Warnf("[watcher] cannot store submission status of burn with nonce=%v: %v", nonce, err)
+	}
+}
+
+// deadLetter stores a burn that cannot be submitted, so that it can be
+// handled manually.
+func (watcher Watcher) deadLetter(burn BurnInfo, reason error) {
+	letter := db.WatcherDeadLetter{
+		Selector: watcher.selector,
+		Nonce:    pack.NewU256(burn.Nonce).String(),
+		Txid:     burn.Txid,
+		Amount:   burn.Amount,
+		To:       pack.Bytes(burn.ToBytes),
+		Error:    reason.Error(),
+	}
+	if err := watcher.database.InsertWatcherDeadLetter(letter); err != nil {
+		watcher.logger.Errorf("[watcher] cannot store dead letter for burn with nonce=%v: %v", letter.Nonce, err)
+	}
+}
@@ -0,0 +1,400 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/renproject/darknode/binding/gatewaybinding"
+	"github.com/renproject/pack"
+	"github.com/sirupsen/logrus"
+)
+
+// subscriptionRetryDelay is how long the subscription waits before
+// reconnecting after it was dropped.
+const subscriptionRetryDelay = 5 * time.Second
+
+// Subscriber is implemented by a `BlockHeightFetcher` that is pushed new blocks
+// instead of polling for them. The watcher scans for burns whenever a new
+// block arrives.
+type Subscriber interface {
+	// Heads is notified when a new block arrives.
+	Heads() <-chan struct{}
+}
+
+// EthChainSubscription subscribes to the new blocks of an EVM chain and to the
+// burn logs of all of its gateways over WebSocket, once for all of the
+// gateways instead of once per gateway. The logs are routed to the gateway
+// that emitted them, and the watcher of every gateway is notified of new
+// blocks.
+type EthChainSubscription struct {
+	logger    logrus.FieldLogger
+	name      string
+	client    *ethclient.Client
+	addresses []common.Address
+	gateways  map[common.Address]subscribedGateway
+}
+
+// subscribedGateway is the head and the burns pushed for a gateway, along
+// with the bindings used to decode its burn logs.
+type subscribedGateway struct {
+	filterer *gatewaybinding.MintGatewayLogicV1Filterer
+	state    *subscriptionState
+	heads    chan struct{}
+}
+
+// NewEthChainSubscription returns a subscription to the blocks of the
+// WebSocket client and to the burn logs of the gateways with the given
+// addresses.
+func NewEthChainSubscription(logger logrus.FieldLogger, name string, client *ethclient.Client, addresses []common.Address) EthChainSubscription {
+	gateways := map[common.Address]subscribedGateway{}
+	for _, address := range addresses {
+		filterer, err := gatewaybinding.NewMintGatewayLogicV1Filterer(address, nil)
+		if err != nil {
+			panic(fmt.Sprintf("invalid gateway abi: %v", err))
+		}
+		gateways[address] = subscribedGateway{
+			filterer: filterer,
+			state:    newSubscriptionState(),
+			heads:    make(chan struct{}, 1),
+		}
+	}
+	return EthChainSubscription{
+		logger:    logger,
+		name:      name,
+		client:    client,
+		addresses: addresses,
+		gateways:  gateways,
+	}
+}
+
+// Gateway returns a fetcher for the burns of the gateway with the given
+// address, which are served from the subscription while it is alive. The given
+// fetchers are used whenever the blocks cannot be served from the
+// subscription. It returns false if the subscription does not include the
+// gateway.
+func (subscription EthChainSubscription) Gateway(address common.Address, burnLogFetcher BurnLogFetcher, blockHeightFetcher BlockHeightFetcher) (EthSubscriptionFetcher, bool) {
+	gateway, ok := subscription.gateways[address]
+	if !ok {
+		return EthSubscriptionFetcher{}, false
+	}
+	return EthSubscriptionFetcher{
+		name:               subscription.name,
+		burnLogFetcher:     burnLogFetcher,
+		blockHeightFetcher: blockHeightFetcher,
+		state:              gateway.state,
+		heads:              gateway.heads,
+	}, true
+}
+
+// Run keeps the subscription alive until the context is canceled,
+// reconnecting whenever it is dropped. This function is blocking.
+func (subscription EthChainSubscription) Run(ctx context.Context) {
+	for {
+		err := subscription.subscribe(ctx)
+		subscription.stop()
+		if ctx.Err() != nil {
+			return
+		}
+		subscription.logger.Warnf("[watcher] subscription for %v dropped, falling back to polling: %v", subscription.name, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(subscriptionRetryDelay):
+		}
+	}
+}
+
+// subscribe subscribes to new blocks and burn logs, and buffers them until the
+// subscription fails or the context is canceled.
+func (subscription EthChainSubscription) subscribe(ctx context.Context) error {
+	headCh := make(chan *types.Header)
+	headSub, err := subscription.client.SubscribeNewHead(ctx, headCh)
+	if err != nil {
+		return fmt.Errorf("subscribing to new heads: %v", err)
+	}
+	defer headSub.Unsubscribe()
+
+	logCh := make(chan types.Log)
+	logSub, err := subscription.client.SubscribeFilterLogs(ctx, ethereum.FilterQuery{
+		Addresses: subscription.addresses,
+		Topics:    [][]common.Hash{{logBurnTopic}},
+	}, logCh)
+	if err != nil {
+		return fmt.Errorf("subscribing to LogBurn events: %v", err)
+	}
+	defer logSub.Unsubscribe()
+
+	// The logs of the blocks up to the current head may have been emitted
+	// before subscribing, so they are fetched by polling.
+	header, err := subscription.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("fetching current head: %v", err)
+	}
+	subscription.start(header.Number.Uint64())
+	subscription.logger.Infof("[watcher] subscribed to %v from block=%v", subscription.name, header.Number.Uint64()+1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-headSub.Err():
+			return fmt.Errorf("new heads: %v", err)
+		case err := <-logSub.Err():
+			return fmt.Errorf("LogBurn events: %v", err)
+		case header := <-headCh:
+			subscription.observeHead(header.Number.Uint64())
+		case log := <-logCh:
+			subscription.observeLog(log)
+		}
+	}
+}
+
+// start records that the subscription was established at the given head.
+func (subscription EthChainSubscription) start(head uint64) {
+	for _, gateway := range subscription.gateways {
+		gateway.state.start(head)
+	}
+}
+
+// stop records that the subscription was dropped.
+func (subscription EthChainSubscription) stop() {
+	for _, gateway := range subscription.gateways {
+		gateway.state.stop()
+	}
+}
+
+// observeHead records a new head, and notifies the watchers of the gateways.
+// Notifications are coalesced, so a watcher does not fall behind when blocks
+// arrive faster than it scans.
+func (subscription EthChainSubscription) observeHead(head uint64) {
+	for _, gateway := range subscription.gateways {
+		gateway.state.observeHead(head)
+		select {
+		case gateway.heads <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// observeLog buffers a burn log for the gateway that emitted it, or drops the
+// burn if its log was removed by a reorg.
+func (subscription EthChainSubscription) observeLog(log types.Log) {
+	gateway, ok := subscription.gateways[log.Address]
+	if !ok {
+		return
+	}
+	if log.Removed {
+		gateway.state.remove(log.BlockNumber, log.TxHash.Bytes(), log.Index)
+		return
+	}
+	event, err := gateway.filterer.ParseLogBurn(log)
+	if err != nil {
+		subscription.logger.Warnf("[watcher] cannot decode LogBurn event in tx=%v on %v: %v", log.TxHash.Hex(), subscription.name, err)
+		return
+	}
+	gateway.state.add(burnInfo(event), log.Index)
+}
+
+// EthSubscriptionFetcher fetches the burns of a gateway from the logs and
+// blocks pushed by the `eth_subscribe` subscription of its chain. Blocks and
+// burns are only served from the subscription while it is alive, and only for
+// the blocks after it was established; the watcher falls back to polling for
+// everything else, so the blocks missed while the subscription was down are
+// filled in by polling after it reconnects.
+//
+// The heads that are pushed are the same heads that are polled, so the
+// watcher still only processes burns once they have the same number of
+// confirmations. Burns that are removed by a reorg are dropped.
+type EthSubscriptionFetcher struct {
+	name               string
+	burnLogFetcher     BurnLogFetcher
+	blockHeightFetcher BlockHeightFetcher
+	state              *subscriptionState
+	heads              chan struct{}
+}
+
+// Heads is notified when a new block arrives.
+func (fetcher EthSubscriptionFetcher) Heads() <-chan struct{} {
+	return fetcher.heads
+}
+
+// FetchBlockHeight returns the most recent head pushed by the subscription,
+// or polls for it if the subscription is down.
+func (fetcher EthSubscriptionFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	if head, ok := fetcher.state.currentHead(); ok {
+		return head, nil
+	}
+	return fetcher.blockHeightFetcher.FetchBlockHeight(ctx)
+}
+
+// FetchBurnLogs returns the burns between the given blocks from the
+// subscription if it has been alive for the whole range, or polls for them
+// otherwise.
+func (fetcher EthSubscriptionFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	burns, ok := fetcher.state.burns(from, to)
+	if !ok {
+		return fetcher.burnLogFetcher.FetchBurnLogs(ctx, from, to)
+	}
+	resultChan := make(chan BurnLogResult, len(burns))
+	for _, burn := range burns {
+		resultChan <- BurnLogResult{Result: burn}
+	}
+	close(resultChan)
+	return resultChan, nil
+}
+
+// FetchBlockHash fetches the hash of the block at the given height by polling,
+// so that reorgs are still detected across the blocks that were missed while
+// the subscription was down.
+func (fetcher EthSubscriptionFetcher) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	hashFetcher, ok := fetcher.blockHeightFetcher.(BlockHashFetcher)
+	if !ok {
+		return pack.Bytes32{}, pack.Bytes32{}, fmt.Errorf("%v cannot fetch block hashes", fetcher.name)
+	}
+	return hashFetcher.FetchBlockHash(ctx, height)
+}
+
+// subscriptionState holds the head and the burns pushed by the subscription.
+type subscriptionState struct {
+	mu    *sync.Mutex
+	live  bool
+	since uint64
+	head  uint64
+	logs  map[uint64][]subscribedBurn
+}
+
+// subscribedBurn is a burn pushed by the subscription, along with the index
+// of its log in the block.
+type subscribedBurn struct {
+	burn  BurnInfo
+	index uint
+}
+
+func newSubscriptionState() *subscriptionState {
+	return &subscriptionState{
+		mu:   new(sync.Mutex),
+		logs: map[uint64][]subscribedBurn{},
+	}
+}
+
+// start records that the subscription was established at the given head. The
+// burns of the blocks after the head are pushed by the subscription.
+func (state *subscriptionState) start(head uint64) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.live = true
+	state.since = head + 1
+	state.head = head
+	state.logs = map[uint64][]subscribedBurn{}
+}
+
+// stop records that the subscription was dropped.
+func (state *subscriptionState) stop() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.live = false
+	state.logs = map[uint64][]subscribedBurn{}
+}
+
+// observeHead records a new head. Heads can move backwards after a reorg.
+func (state *subscriptionState) observeHead(head uint64) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.head = head
+}
+
+// currentHead returns the most recent head, if the subscription is alive.
+func (state *subscriptionState) currentHead() (uint64, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.head, state.live
+}
+
+// add buffers a burn pushed by the subscription.
+func (state *subscriptionState) add(burn BurnInfo, index uint) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	block := burn.BlockNumber.Uint64()
+	if block < state.since {
+		return
+	}
+	for _, logged := range state.logs[block] {
+		if logged.index == index && bytes.Equal(logged.burn.Txid, burn.Txid) {
+			return
+		}
+	}
+	state.logs[block] = append(state.logs[block], subscribedBurn{burn: burn, index: index})
+}
+
+// remove drops a burn whose block was removed by a reorg.
+func (state *subscriptionState) remove(block uint64, txid []byte, index uint) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	logs := state.logs[block]
+	for i, logged := range logs {
+		if logged.index == index && bytes.Equal(logged.burn.Txid, txid) {
+			state.logs[block] = append(logs[:i:i], logs[i+1:]...)
+			break
+		}
+	}
+	if len(state.logs[block]) == 0 {
+		delete(state.logs, block)
+	}
+}
+
+// burns returns the burns between the given blocks, ordered by block and log
+// index, and whether the subscription has been alive for the whole range. The
+// range must end before the most recent head, as the logs of a block can be
+// pushed after its head. The burns of the blocks before the range are no
+// longer needed, so they are dropped, and those blocks will be polled for if
+// they are requested again.
+func (state *subscriptionState) burns(from, to uint64) ([]BurnInfo, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if !state.live || from < state.since || to >= state.head {
+		return nil, false
+	}
+
+	blocks := []uint64{}
+	for block := range state.logs {
+		if block < from {
+			delete(state.logs, block)
+			continue
+		}
+		if block <= to {
+			blocks = append(blocks, block)
+		}
+	}
+	state.since = from
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i] < blocks[j]
+	})
+
+	burns := []BurnInfo{}
+	for _, block := range blocks {
+		logs := append([]subscribedBurn{}, state.logs[block]...)
+		sort.Slice(logs, func(i, j int) bool {
+			return logs[i].index < logs[j].index
+		})
+		for _, logged := range logs {
+			burns = append(burns, logged.burn)
+		}
+	}
+	return burns, true
+}
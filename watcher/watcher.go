@@ -2,34 +2,31 @@ package watcher
 
 import (
 	"context"
-	"encoding/binary"
+	"database/sql"
 	"fmt"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
-	solanaSDK "github.com/dfuse-io/solana-go"
-	solanaRPC "github.com/dfuse-io/solana-go/rpc"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/go-redis/redis/v7"
 	"github.com/jbenet/go-base58"
-	"github.com/near/borsh-go"
 	"github.com/renproject/darknode/binding"
 	"github.com/renproject/darknode/binding/gatewaybinding"
-	"github.com/renproject/darknode/binding/solanastate"
 	"github.com/renproject/darknode/engine"
 	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/tx"
-	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/distkey"
 	"github.com/renproject/multichain"
 	"github.com/renproject/multichain/chain/bitcoin"
 	"github.com/renproject/multichain/chain/bitcoincash"
 	"github.com/renproject/multichain/chain/digibyte"
 	"github.com/renproject/multichain/chain/dogecoin"
 	"github.com/renproject/multichain/chain/filecoin"
-	"github.com/renproject/multichain/chain/solana"
 	"github.com/renproject/multichain/chain/terra"
 	"github.com/renproject/multichain/chain/zcash"
 	"github.com/renproject/pack"
@@ -66,158 +63,72 @@ func NewEthBurnLogFetcher(bindings *gatewaybinding.MintGatewayLogicV1) EthBurnLo
 // This will fetch the burn event logs using the ethereum bindings and emit them via a channel
 // We do this so that we can unit test the log handling without calling ethereum
 func (fetcher EthBurnLogFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
-	iter, err := fetcher.bindings.FilterLogBurn(
-		&bind.FilterOpts{
-			Context: ctx,
-			Start:   from,
-			End:     &to,
-		},
-		nil,
-		nil,
-	)
+	iters, err := fetcher.filterLogBurn(ctx, from, to)
 	if err != nil {
 		return nil, err
 	}
 	resultChan := make(chan BurnLogResult)
 
 	go func() {
-		func() {
-			defer close(resultChan)
-			for iter.Next() {
-				nonce := iter.Event.N.Uint64()
-				var nonceBytes pack.Bytes32
-				copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
-
-				result := BurnInfo{
-					Txid:        iter.Event.Raw.TxHash.Bytes(),
-					Amount:      pack.NewU256FromInt(iter.Event.Amount),
-					ToBytes:     iter.Event.To,
-					Nonce:       nonceBytes,
-					BlockNumber: pack.NewU64(iter.Event.Raw.BlockNumber),
-				}
-
-				// Send the burn transaction to the resolver.
-				select {
-				case <-ctx.Done():
-					resultChan <- BurnLogResult{Error: ctx.Err()}
-					return
-				default:
-					resultChan <- BurnLogResult{Result: result}
+		defer close(resultChan)
+		for i, iter := range iters {
+			if !emitBurnLogs(ctx, iter, resultChan) {
+				for _, remaining := range iters[i+1:] {
+					remaining.Close()
 				}
+				return
 			}
-		}()
-
-		// Always close the iter to clear the event subscription
-		err = iter.Close()
-		if err != nil {
-			resultChan <- BurnLogResult{Error: err}
-			return
-		}
-
-		// Iter should stop if an error occurs,
-		// so no need to check on each iteration
-		err := iter.Error()
-		if err != nil {
-			resultChan <- BurnLogResult{Error: err}
-			return
 		}
-
 	}()
 
 	return resultChan, nil
 }
 
-type SolFetcher struct {
-	client           *solanaRPC.Client
-	gatewayStatePubk solanaSDK.PublicKey
-	gatewayAddress   string
-}
-
-func NewSolFetcher(client *solanaRPC.Client, gatewayAddress string) SolFetcher {
-	seeds := []byte("GatewayStateV0.1.4")
-	programDerivedAddress := solana.ProgramDerivedAddress(pack.Bytes(seeds), multichain.Address(gatewayAddress))
-	programPubk, err := solanaSDK.PublicKeyFromBase58(string(programDerivedAddress))
-	if err != nil {
-		panic("invalid pubk")
-	}
-
-	return SolFetcher{
-		client:           client,
-		gatewayStatePubk: programPubk,
-		gatewayAddress:   gatewayAddress,
+// burnInfo returns the burn of the given burn log.
+func burnInfo(event *gatewaybinding.MintGatewayLogicV1LogBurn) BurnInfo {
+	nonce := event.N.Uint64()
+	var nonceBytes pack.Bytes32
+	copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
+
+	return BurnInfo{
+		Txid:        event.Raw.TxHash.Bytes(),
+		Amount:      pack.NewU256FromInt(event.Amount),
+		ToBytes:     event.To,
+		Nonce:       nonceBytes,
+		BlockNumber: pack.NewU64(event.Raw.BlockNumber),
 	}
 }
 
-func (fetcher SolFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
-	resultChan := make(chan BurnLogResult)
-
-	go func() {
-		defer close(resultChan)
-		for i := from; i < to; i++ {
-			nonce := i
-
-			b := make([]byte, 8)
-			binary.LittleEndian.PutUint64(b, i)
-
-			var nonceBytes pack.Bytes32
-			copy(nonceBytes[:], pack.NewU256FromU64(pack.NewU64(nonce)).Bytes())
-
-			programDerivedAddress := solana.ProgramDerivedAddress(b, multichain.Address(fetcher.gatewayAddress))
-
-			programPubk, err := solanaSDK.PublicKeyFromBase58(string(programDerivedAddress))
-			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log account: %v", err)}
-				return
-			}
-
-			// Fetch account data at gateway's state
-			accountInfo, err := fetcher.client.GetAccountInfo(ctx, programPubk)
-			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log data for burn: %v err: %v", i, err)}
-				return
-			}
-			data := accountInfo.Value.Data
-
-			if len(data) != 65 {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("deserializing burn log data: expected data len 65, got %v", len(data))}
-				return
-			}
-			amount := [32]byte{}
-			copy(amount[:], data[0:32])
-			recipientLen := uint8(data[32:33][0])
-			recipient := multichain.RawAddress(data[33 : 33+int(recipientLen)])
-
-			signatures, err := fetcher.client.GetConfirmedSignaturesForAddress2(ctx, programPubk, &solanaRPC.GetConfirmedSignaturesForAddress2Opts{})
-			if err != nil {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("getting burn log txes: %v", err)}
-				return
-			}
-
-			if len(signatures) == 0 {
-				resultChan <- BurnLogResult{Error: fmt.Errorf("Burn signature not confirmed")}
-				return
-			}
-
-			result := BurnInfo{
-				Txid:        base58.Decode(signatures[0].Signature),
-				Amount:      pack.NewU256(amount),
-				ToBytes:     recipient[:],
-				Nonce:       nonceBytes,
-				BlockNumber: pack.NewU64(i),
-			}
+// emitBurnLogs sends the burn logs from the iterator to the channel. It returns
+// false if an error was sent instead.
+func emitBurnLogs(ctx context.Context, iter *gatewaybinding.MintGatewayLogicV1LogBurnIterator, resultChan chan BurnLogResult) bool {
+	for iter.Next() {
+		result := burnInfo(iter.Event)
 
-			// Send the burn transaction to the resolver.
-			select {
-			case <-ctx.Done():
-				resultChan <- BurnLogResult{Error: ctx.Err()}
-				return
-			default:
-				resultChan <- BurnLogResult{Result: result}
-			}
+		// Send the burn transaction to the resolver.
+		select {
+		case <-ctx.Done():
+			iter.Close()
+			resultChan <- BurnLogResult{Error: ctx.Err()}
+			return false
+		default:
+			resultChan <- BurnLogResult{Result: result}
 		}
-	}()
+	}
 
-	return resultChan, nil
+	// Always close the iter to clear the event subscription
+	if err := iter.Close(); err != nil {
+		resultChan <- BurnLogResult{Error: err}
+		return false
+	}
+
+	// Iter should stop if an error occurs,
+	// so no need to check on each iteration
+	if err := iter.Error(); err != nil {
+		resultChan <- BurnLogResult{Error: err}
+		return false
+	}
+	return true
 }
 
 type BlockHeightFetcher interface {
@@ -243,69 +154,66 @@ func (fetcher EthBlockHeightFetcher) FetchBlockHeight(ctx context.Context) (uint
 	return currentBlock.Number.Uint64(), nil
 }
 
-// Behaves differently, as it checks the maximum burn index that should be fetched
-func (fetcher SolFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
-	accountData, err := fetcher.client.GetAccountInfo(ctx, fetcher.gatewayStatePubk)
-	if err != nil {
-		return 0, fmt.Errorf("getting gateway data: %v", err)
-	}
-
-	// Deserialize the account data into registry state's structure.
-	gateway := solanastate.Gateway{}
-	if err = borsh.Deserialize(&gateway, accountData.Value.Data); err != nil {
-		return 0, fmt.Errorf("deserializing account data: %v", err)
-	}
-	// We increment the burnCount by 1, as internally its indexes start at 1
-	return uint64(gateway.BurnCount) + 1, nil
-}
-
 // Watcher watches for event logs for burn transactions. These transactions are
 // then forwarded to the cacher.
 type Watcher struct {
 	network            multichain.Network
 	logger             logrus.FieldLogger
-	gpubkey            pack.Bytes
+	distPubKey         *distkey.Tracker
 	selector           tx.Selector
 	bindings           binding.Bindings
 	burnLogFetcher     BurnLogFetcher
 	blockHeightFetcher BlockHeightFetcher
 	resolver           jsonrpc.Resolver
 	cache              redis.Cmdable
+	database           db.DB
 	pollInterval       time.Duration
 	maxBlockAdvance    uint64
+	blockAdvance       *blockAdvance
 	confidenceInterval uint64
+	status             *statusTracker
 }
 
 // NewWatcher returns a new Watcher.
-func NewWatcher(logger logrus.FieldLogger, network multichain.Network, selector tx.Selector, bindings binding.Bindings, burnLogFetcher BurnLogFetcher, blockHeightFetcher BlockHeightFetcher, resolver jsonrpc.Resolver, cache redis.Cmdable, distPubKey *id.PubKey, pollInterval time.Duration, maxBlockAdvance uint64, confidenceInterval uint64) Watcher {
-	gpubkey := (*btcec.PublicKey)(distPubKey).SerializeCompressed()
+func NewWatcher(logger logrus.FieldLogger, network multichain.Network, selector tx.Selector, bindings binding.Bindings, burnLogFetcher BurnLogFetcher, blockHeightFetcher BlockHeightFetcher, resolver jsonrpc.Resolver, cache redis.Cmdable, database db.DB, distPubKey *distkey.Tracker, pollInterval time.Duration, maxBlockAdvance uint64, confidenceInterval uint64) Watcher {
 	return Watcher{
 		logger:             logger,
 		network:            network,
-		gpubkey:            gpubkey,
+		distPubKey:         distPubKey,
 		selector:           selector,
 		bindings:           bindings,
 		burnLogFetcher:     burnLogFetcher,
 		blockHeightFetcher: blockHeightFetcher,
 		resolver:           resolver,
 		cache:              cache,
+		database:           database,
 		pollInterval:       pollInterval,
 		maxBlockAdvance:    maxBlockAdvance,
+		blockAdvance:       newBlockAdvance(maxBlockAdvance),
 		confidenceInterval: confidenceInterval,
+		status:             newStatusTracker(),
 	}
 }
 
-// Run starts the watcher until the context is canceled.
+// Run starts the watcher until the context is canceled. If the block height
+// fetcher is a `Subscriber`, the watcher scans for burns as soon as a new block
+// arrives, as well as every poll interval.
 func (watcher Watcher) Run(ctx context.Context) {
 	ticker := time.NewTicker(watcher.pollInterval)
 	defer ticker.Stop()
 
+	var heads <-chan struct{}
+	if subscriber, ok := watcher.blockHeightFetcher.(Subscriber); ok {
+		heads = subscriber.Heads()
+	}
+
 	for {
 		watcher.watchLogShiftOuts(ctx)
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+		case <-heads:
 		}
 	}
 }
@@ -321,17 +229,24 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 	currentHeight, err := watcher.blockHeightFetcher.FetchBlockHeight(ctx)
 	if err != nil {
 		watcher.logger.Warnf("[watcher] error loading block header: %v", err)
+		watcher.status.fail("error loading block header: %v", err)
 		return
 	}
+	watcher.status.observeHead(currentHeight)
 
 	lastHeight, err := watcher.lastCheckedBlockNumber(currentHeight)
 	if err != nil {
 		watcher.logger.Errorf("[watcher] error loading last checked block number: %v", err)
+		watcher.status.fail("error loading last checked block number: %v", err)
 		return
 	}
+	watcher.status.observeCheckpoint(lastHeight)
 
 	if currentHeight <= lastHeight {
 		watcher.logger.Warnf("[watcher] tried to process old blocks")
+		if currentHeight < lastHeight {
+			watcher.status.fail("last checked block=%v is ahead of the current block=%v", lastHeight, currentHeight)
+		}
 		// Make sure we do not process old events. This could occur if there is
 		// an issue with the underlying blockchain node, for example if it needs
 		// to resync.
@@ -344,30 +259,82 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 		return
 	}
 
-	// Only advance by a set number of blocks at a time to prevent over-subscription
-	step := lastHeight + watcher.maxBlockAdvance
+	// Make sure the chain has not reorged since the last checkpoint, and
+	// rewind to scan the affected blocks again if it has.
+	hashFetcher, checkHashes := watcher.blockHeightFetcher.(BlockHashFetcher)
+	if checkHashes {
+		reorged, err := watcher.checkReorg(ctx, hashFetcher, lastHeight)
+		if err != nil {
+			watcher.logger.Warnf("[watcher] error checking for reorg: %v", err)
+			watcher.status.fail("error checking for reorg: %v", err)
+			return
+		}
+		if reorged {
+			return
+		}
+	}
+
+	// For Eth, avoid checking blocks that might have shuffled. This is done
+	// before limiting the advance, so that the end of the range is always
+	// after the checkpoint.
+	adaptive := watcher.selector.Source() != multichain.Solana
+	if adaptive {
+		if currentHeight < lastHeight+watcher.confidenceInterval+1 {
+			return
+		}
+		currentHeight -= watcher.confidenceInterval
+	}
+
+	// Only advance by a set number of blocks at a time to prevent
+	// over-subscription. For Eth, the number of blocks adapts to the density
+	// of burn logs.
+	advance := watcher.maxBlockAdvance
+	if adaptive {
+		advance = watcher.blockAdvance.get()
+	}
+	if advance == 0 {
+		advance = 1
+	}
+	step := lastHeight + advance
 	if step < currentHeight {
 		currentHeight = step
 	}
 
-	// for Eth, avoid checking blocks that might have shuffled
-	if watcher.selector.Source() != multichain.Solana {
-		currentHeight -= watcher.confidenceInterval
+	// Record the hash of the block at the end of the range before scanning
+	// it, so that a reorg during the scan can be detected.
+	hash := ""
+	if checkHashes {
+		hash, err = blockHash(ctx, hashFetcher, currentHeight)
+		if err != nil {
+			watcher.logger.Warnf("[watcher] error fetching block hash: %v", err)
+			watcher.status.fail("error fetching block hash: %v", err)
+			return
+		}
 	}
 
 	// Fetch logs
 	c, err := watcher.burnLogFetcher.FetchBurnLogs(ctx, lastHeight, currentHeight)
 	if err != nil {
 		watcher.logger.Warnf("[watcher] error fetching LogBurn events from=%v to=%v: %v", lastHeight, currentHeight, err)
+		watcher.status.fail("error fetching LogBurn events from=%v to=%v: %v", lastHeight, currentHeight, err)
+		// Only scan fewer blocks if the provider rejected the range, and not
+		// when it is unavailable.
+		if adaptive && isRangeError(err) {
+			watcher.blockAdvance.shrink()
+		}
 		return
 	}
 
 	// Loop through the logs and check if there are burn events.
+	logs := 0
+	burns := []db.WatcherBurn{}
 	for res := range c {
 		if res.Error != nil {
 			watcher.logger.Errorf("[watcher] error iterating LogBurn events from=%v to=%v: %v", lastHeight, currentHeight, res.Error)
+			watcher.status.fail("error iterating LogBurn events from=%v to=%v: %v", lastHeight, currentHeight, res.Error)
 			return
 		}
+		logs++
 		burn := res.Result
 		nonce := burn.Nonce
 		amount := burn.Amount
@@ -376,46 +343,166 @@ func (watcher Watcher) watchLogShiftOuts(parent context.Context) {
 		watcher.logger.Infof("[watcher] detected burn for %v  with nonce=%v", watcher.selector.String(), nonce)
 
 		// Send the burn transaction to the resolver.
-		params, err := watcher.burnToParams(burn.Txid, amount, to, nonce, watcher.gpubkey)
+		params, err := watcher.burnToParams(burn.Txid, amount, to, nonce, watcher.gpubkey())
 		if err != nil {
 			watcher.logger.Errorf("[watcher] cannot get params from burn transaction (to=%v, amount=%v, nonce=%v): %v", to, amount, nonce, err)
+			watcher.deadLetter(burn, err)
 			continue
 		}
 
-		response := watcher.resolver.SubmitTx(ctx, 0, &params, nil)
-		if response.Error != nil {
-			watcher.logger.Errorf("[watcher] invalid burn transaction %v: %v", params, response.Error.Message)
-			// return so that we retry, if the burnToParams are valid, the darknode should accept the tx
-			// we assume that the only failure case would be RPC/darknode backpressure, so we backoff here
+		// Skip burns that have already been accepted, so that they are not
+		// submitted again when the range is scanned again, for example after
+		// a failure or a restart.
+		nonceStr := pack.NewU256(nonce).String()
+		submission, err := watcher.submissionStatus(nonceStr, params.Tx.Hash)
+		if err != nil {
+			watcher.logger.Errorf("[watcher] error loading submission status of burn with nonce=%v: %v", nonceStr, err)
+			watcher.status.fail("error loading submission status of burn with nonce=%v: %v", nonceStr, err)
+			return
+		}
+		if submission < db.WatcherNonceStatusAccepted {
+			response := watcher.resolver.SubmitTx(ctx, 0, &params, nil)
+			if response.Error != nil {
+				watcher.logger.Errorf("[watcher] invalid burn transaction %v: %v", params, response.Error.Message)
+				watcher.status.fail("error submitting burn with nonce=%v: %v", nonceStr, response.Error.Message)
+				watcher.updateSubmissionStatus(nonceStr, params.Tx.Hash, db.WatcherNonceStatusRejected)
+				// return so that we retry, if the burnToParams are valid, the darknode should accept the tx
+				// we assume that the only failure case would be RPC/darknode backpressure, so we backoff here
+				return
+			}
+			watcher.updateSubmissionStatus(nonceStr, params.Tx.Hash, db.WatcherNonceStatusAccepted)
+		}
+		burns = append(burns, db.WatcherBurn{
+			Selector: watcher.selector,
+			Nonce:    nonceStr,
+			V0Hash:   v0.BurnTxHash(watcher.selector, pack.NewU256(nonce)).String(),
+			V1Hash:   params.Tx.Hash.String(),
+		})
+	}
+
+	if adaptive {
+		watcher.blockAdvance.observe(logs)
+	}
+
+	// Only move the checkpoint if the block at the end of the range is the
+	// same as before the scan, as the logs may otherwise be from a mix of
+	// both sides of a reorg. The range is scanned again on the next tick.
+	if checkHashes {
+		after, err := blockHash(ctx, hashFetcher, currentHeight)
+		if err != nil {
+			watcher.logger.Warnf("[watcher] error fetching block hash: %v", err)
+			watcher.status.fail("error fetching block hash: %v", err)
+			return
+		}
+		if after != hash {
+			watcher.logger.Warnf("[watcher] block=%v of %v changed from %v to %v while scanning", currentHeight, watcher.selector.String(), hash, after)
+			watcher.status.fail("block=%v changed while scanning", currentHeight)
 			return
 		}
 	}
 
-	if err := watcher.cache.Set(watcher.key(), currentHeight, 0).Err(); err != nil {
-		watcher.logger.Errorf("[watcher] error setting last checked block number in redis: %v", err)
+	// Store the checkpoint together with the block hash and the burns found,
+	// so that the burns can always be queried once they are behind the
+	// checkpoint.
+	if err := watcher.database.UpdateWatcherCheckpoint(watcher.selector, currentHeight, hash, burns); err != nil {
+		watcher.logger.Errorf("[watcher] error setting last checked block number in db: %v", err)
+		watcher.status.fail("error setting last checked block number: %v", err)
 		return
 	}
+	watcher.status.succeed(currentHeight)
+	watcher.status.observeBurns(len(burns))
 }
 
-// key returns the key that is used to store the last checked block.
+// key returns the key that was used to store the last checked block in redis,
+// before checkpoints were moved to the database.
 func (watcher Watcher) key() string {
 	return fmt.Sprintf("%v_lastCheckedBlock", watcher.selector.String())
 }
 
 // lastCheckedBlockNumber returns the last checked block number of Ethereum.
 func (watcher Watcher) lastCheckedBlockNumber(currentBlockN uint64) (uint64, error) {
+	last, err := watcher.database.WatcherCheckpoint(watcher.selector)
+	if err != sql.ErrNoRows {
+		return last, err
+	}
+	return watcher.migrateCheckpoint(currentBlockN)
+}
+
+// migrateCheckpoint moves the checkpoint and the v0 burn hash mappings of the
+// watcher from redis into the database. If there is no checkpoint in redis,
+// the checkpoint is initialised with the current block number.
+func (watcher Watcher) migrateCheckpoint(currentBlockN uint64) (uint64, error) {
 	last, err := watcher.cache.Get(watcher.key()).Uint64()
-	// Initialise the pointer with current block number if it has not been yet.
+	migrated := err == nil
 	if err == redis.Nil {
 		watcher.logger.Warnf("[watcher] last checked block number not initialised")
-		if err := watcher.cache.Set(watcher.key(), currentBlockN, 0).Err(); err != nil {
-			watcher.logger.Errorf("[watcher] cannot initialise last checked block in redis: %v", err)
-			return 0, err
+		last = currentBlockN
+	} else if err != nil {
+		return 0, err
+	}
+
+	burns, err := watcher.redisBurns()
+	if err != nil {
+		return 0, fmt.Errorf("loading burns from redis: %v", err)
+	}
+	if err := watcher.database.UpdateWatcherCheckpoint(watcher.selector, last, "", burns); err != nil {
+		watcher.logger.Errorf("[watcher] cannot initialise last checked block in db: %v", err)
+		return 0, err
+	}
+	if migrated {
+		watcher.logger.Infof("[watcher] migrated checkpoint=%v and %v burns for %v from redis", last, len(burns), watcher.selector)
+	}
+	return last, nil
+}
+
+// redisBurns returns the burns whose v0 hash mappings are stored in redis.
+func (watcher Watcher) redisBurns() ([]db.WatcherBurn, error) {
+	prefix := fmt.Sprintf("%v_", watcher.selector.String())
+	burns := []db.WatcherBurn{}
+	cursor := uint64(0)
+	for {
+		keys, next, err := watcher.cache.Scan(cursor, prefix+"*", 100).Result()
+		if err != nil {
+			return nil, err
 		}
-		return currentBlockN, nil
+		for _, key := range keys {
+			// Only the keys of burn nonces are decimal numbers.
+			nonce := strings.TrimPrefix(key, prefix)
+			if _, ok := new(big.Int).SetString(nonce, 10); !ok {
+				continue
+			}
+			v0Hash, err := watcher.cache.Get(key).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			v1Hash, err := watcher.cache.Get(v0Hash).Result()
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			burns = append(burns, db.WatcherBurn{
+				Selector: watcher.selector,
+				Nonce:    nonce,
+				V0Hash:   v0Hash,
+				V1Hash:   v1Hash,
+			})
+		}
+		if next == 0 {
+			return burns, nil
+		}
+		cursor = next
 	}
+}
 
-	return last, err
+// gpubkey returns the compressed distributed public key that is currently in
+// use.
+func (watcher Watcher) gpubkey() pack.Bytes {
+	return (*btcec.PublicKey)(watcher.distPubKey.PubKey()).SerializeCompressed()
 }
 
 // burnToParams constructs params for a SubmitTx request with given ref.
@@ -468,17 +555,8 @@ func (watcher Watcher) burnToParams(txid pack.Bytes, amount pack.U256, toBytes [
 		Input:    pack.Typed(input.(pack.Struct)),
 	}
 
-	// Map the v0 burn txhash to v1 txhash so that it is still
-	// queryable
-	// We don't get the required data during tx submission rpc to track it there,
-	// so we persist here in order to not re-filter all burn events
-	v0Hash := v0.BurnTxHash(watcher.selector, pack.NewU256(nonce))
-	watcher.cache.Set(v0Hash.String(), transaction.Hash.String(), 0)
-
-	// Map the selector + burn ref to the v0 hash so that we can return something
-	// to ren-js v1
-	watcher.cache.Set(fmt.Sprintf("%s_%v", watcher.selector, pack.NewU256(nonce).String()), v0Hash.String(), 0)
-
+	// The v0 and v1 hashes of the burn are stored in the database along with
+	// the checkpoint, so that the burn can be queried using either.
 	return jsonrpc.ParamsSubmitTx{Tx: transaction}, nil
 }
 
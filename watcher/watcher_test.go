@@ -2,8 +2,18 @@ package watcher_test
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -13,13 +23,21 @@ import (
 	. "github.com/renproject/lightnode/watcher"
 
 	"github.com/alicebob/miniredis/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/go-redis/redis/v7"
+	"github.com/jbenet/go-base58"
 	"github.com/renproject/darknode/binding"
+	"github.com/renproject/darknode/binding/gatewaybinding"
+	"github.com/renproject/darknode/jsonrpc"
 	"github.com/renproject/darknode/jsonrpc/jsonrpcresolver"
 	"github.com/renproject/darknode/tx"
 	"github.com/renproject/id"
 	v0 "github.com/renproject/lightnode/compat/v0"
+	"github.com/renproject/lightnode/db"
+	"github.com/renproject/lightnode/distkey"
 	"github.com/renproject/multichain"
+	"github.com/renproject/multichain/chain/solana"
 	"github.com/renproject/pack"
 	"github.com/sirupsen/logrus"
 
@@ -99,12 +117,458 @@ func (fetcher MockBurnLogFetcher) FetchBurnLogs(ctx context.Context, from uint64
 	return x, nil
 }
 
+// MockRangeFetcher rejects queries for more than a maximum number of blocks,
+// like RPC providers that limit the range of log queries.
+type MockRangeFetcher struct {
+	maxRange uint64
+	height   uint64
+	ranges   chan [2]uint64
+}
+
+func (fetcher MockRangeFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	if fetcher.ranges != nil {
+		fetcher.ranges <- [2]uint64{from, to}
+	}
+	if to-from > fetcher.maxRange {
+		return nil, fmt.Errorf("query returned more than 10000 results")
+	}
+	c := make(chan BurnLogResult)
+	close(c)
+	return c, nil
+}
+
+func (fetcher MockRangeFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return fetcher.height, nil
+}
+
+// MockLogFetcher returns the burns that are within the requested range of
+// blocks, or the error if it is set.
+type MockLogFetcher struct {
+	burns  []BurnInfo
+	height uint64
+	err    error
+}
+
+func (fetcher MockLogFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	if fetcher.err != nil {
+		return nil, fetcher.err
+	}
+	c := make(chan BurnLogResult, len(fetcher.burns))
+	for _, burn := range fetcher.burns {
+		if burn.BlockNumber.Uint64() >= from && burn.BlockNumber.Uint64() <= to {
+			c <- BurnLogResult{Result: burn}
+		}
+	}
+	close(c)
+	return c, nil
+}
+
+func (fetcher MockLogFetcher) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	if fetcher.err != nil {
+		return 0, fetcher.err
+	}
+	return fetcher.height, nil
+}
+
+// MockSolana is a Solana node that serves the burn accounts of a gateway.
+// Burns are only confirmed once their signature has been set.
+type MockSolana struct {
+	mu         *sync.Mutex
+	accounts   map[string][]byte
+	signatures map[string]string
+	batches    int
+	lookups    int
+}
+
+func NewMockSolana() *MockSolana {
+	return &MockSolana{
+		mu:         new(sync.Mutex),
+		accounts:   map[string][]byte{},
+		signatures: map[string]string{},
+	}
+}
+
+// Burn adds a burn to the gateway, and confirms it if it is confirmed.
+func (node *MockSolana) Burn(gateway string, nonce uint64, amount uint64, to []byte, confirmed bool) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	account := burnAccount(gateway, nonce)
+	data := make([]byte, 65)
+	copy(data[0:32], pack.NewU256FromU64(pack.NewU64(amount)).Bytes())
+	data[32] = byte(len(to))
+	copy(data[33:], to)
+	node.accounts[account] = data
+	if confirmed {
+		node.signatures[account] = base58.Encode([]byte(fmt.Sprintf("burn-%v", nonce)))
+	}
+}
+
+// Confirm confirms the burn with the given nonce.
+func (node *MockSolana) Confirm(gateway string, nonce uint64) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.signatures[burnAccount(gateway, nonce)] = base58.Encode([]byte(fmt.Sprintf("burn-%v", nonce)))
+}
+
+func (node *MockSolana) Batches() int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.batches
+}
+
+// Lookups returns the number of requests for the signatures of burn accounts.
+// A batch of lookups counts as one request.
+func (node *MockSolana) Lookups() int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.lookups
+}
+
+type mockSolanaRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (node *MockSolana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var reqs []mockSolanaRequest
+	if err := json.Unmarshal(body, &reqs); err == nil {
+		node.lookups++
+		responses := make([]interface{}, len(reqs))
+		for i, req := range reqs {
+			responses[i] = node.respond(req)
+		}
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	var req mockSolanaRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if req.Method == "getConfirmedSignaturesForAddress2" {
+		node.lookups++
+	}
+	json.NewEncoder(w).Encode(node.respond(req))
+}
+
+func (node *MockSolana) respond(req mockSolanaRequest) interface{} {
+	var result interface{}
+	switch req.Method {
+	case "getMultipleAccounts":
+		node.batches++
+		var keys []string
+		json.Unmarshal(req.Params[0], &keys)
+		value := make([]interface{}, len(keys))
+		for i, key := range keys {
+			if data, ok := node.accounts[key]; ok {
+				value[i] = map[string]interface{}{
+					"data": []string{base64.StdEncoding.EncodeToString(data), "base64"},
+				}
+			}
+		}
+		result = map[string]interface{}{"context": map[string]interface{}{"slot": 1}, "value": value}
+	case "getConfirmedSignaturesForAddress2":
+		var key string
+		json.Unmarshal(req.Params[0], &key)
+		signatures := []interface{}{}
+		if signature, ok := node.signatures[key]; ok {
+			signatures = append(signatures, map[string]interface{}{"signature": signature})
+		}
+		result = signatures
+	}
+	return map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}
+}
+
+func burnAccount(gateway string, nonce uint64) string {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, nonce)
+	return string(solana.ProgramDerivedAddress(b, multichain.Address(gateway)))
+}
+
+// MockEthNode is an EVM node that counts the requests for each method. It has
+// no burn logs. If the maximum range is set, it rejects log queries for more
+// blocks, like RPC providers that limit the range of log queries.
+type MockEthNode struct {
+	mu       *sync.Mutex
+	height   uint64
+	maxRange uint64
+	requests map[string]int
+	queries  []map[string]interface{}
+	ranges   [][2]uint64
+}
+
+func NewMockEthNode(height uint64) *MockEthNode {
+	return &MockEthNode{
+		mu:       new(sync.Mutex),
+		height:   height,
+		requests: map[string]int{},
+	}
+}
+
+// Requests returns the number of requests for the method.
+func (node *MockEthNode) Requests(method string) int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return node.requests[method]
+}
+
+// Ranges returns the block ranges of the log queries that were accepted.
+func (node *MockEthNode) Ranges() [][2]uint64 {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return append([][2]uint64{}, node.ranges...)
+}
+
+// Queries returns the filters of the log requests.
+func (node *MockEthNode) Queries() []map[string]interface{} {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	return append([]map[string]interface{}{}, node.queries...)
+}
+
+func (node *MockEthNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	var req struct {
+		ID     interface{}       `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	node.requests[req.Method]++
+
+	var result interface{}
+	switch req.Method {
+	case "eth_getBlockByNumber":
+		zero := "0x0000000000000000000000000000000000000000000000000000000000000000"
+		result = map[string]interface{}{
+			"parentHash":       zero,
+			"sha3Uncles":       zero,
+			"miner":            "0x0000000000000000000000000000000000000000",
+			"stateRoot":        zero,
+			"transactionsRoot": zero,
+			"receiptsRoot":     zero,
+			"logsBloom":        "0x" + strings.Repeat("00", 256),
+			"difficulty":       "0x0",
+			"number":           fmt.Sprintf("0x%x", node.height),
+			"gasLimit":         "0x0",
+			"gasUsed":          "0x0",
+			"timestamp":        "0x0",
+			"extraData":        "0x",
+			"mixHash":          zero,
+			"nonce":            "0x0000000000000000",
+		}
+	case "eth_getLogs":
+		query := map[string]interface{}{}
+		json.Unmarshal(req.Params[0], &query)
+		node.queries = append(node.queries, query)
+		from, _ := hexutil.DecodeUint64(fmt.Sprint(query["fromBlock"]))
+		to, _ := hexutil.DecodeUint64(fmt.Sprint(query["toBlock"]))
+		if node.maxRange > 0 && to-from > node.maxRange {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "error": map[string]interface{}{
+				"code":    -32005,
+				"message": "query returned more than 10000 results",
+			}})
+			return
+		}
+		node.ranges = append(node.ranges, [2]uint64{from, to})
+		result = []interface{}{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+}
+
+// MockSubmitter is a resolver that rejects the given submissions, and counts
+// the submissions of every transaction.
+type MockSubmitter struct {
+	jsonrpc.Resolver
+
+	mu          *sync.Mutex
+	rejections  map[int]bool
+	calls       int
+	submissions map[id.Hash]int
+}
+
+func NewMockSubmitter(rejections ...int) *MockSubmitter {
+	submitter := &MockSubmitter{
+		Resolver:    jsonrpcresolver.OkResponder(),
+		mu:          new(sync.Mutex),
+		rejections:  map[int]bool{},
+		submissions: map[id.Hash]int{},
+	}
+	for _, call := range rejections {
+		submitter.rejections[call] = true
+	}
+	return submitter
+}
+
+func (submitter *MockSubmitter) SubmitTx(ctx context.Context, id interface{}, params *jsonrpc.ParamsSubmitTx, req *http.Request) jsonrpc.Response {
+	submitter.mu.Lock()
+	defer submitter.mu.Unlock()
+
+	submitter.calls++
+	if submitter.rejections[submitter.calls] {
+		jsonErr := jsonrpc.NewError(jsonrpc.ErrorCodeInternal, "rate limited", nil)
+		return jsonrpc.NewResponse(id, nil, &jsonErr)
+	}
+	submitter.submissions[params.Tx.Hash]++
+	return jsonrpc.NewResponse(id, jsonrpc.ResponseSubmitTx{}, nil)
+}
+
+func (submitter *MockSubmitter) Calls() int {
+	submitter.mu.Lock()
+	defer submitter.mu.Unlock()
+
+	return submitter.calls
+}
+
+func (submitter *MockSubmitter) Submissions() map[id.Hash]int {
+	submitter.mu.Lock()
+	defer submitter.mu.Unlock()
+
+	submissions := map[id.Hash]int{}
+	for hash, n := range submitter.submissions {
+		submissions[hash] = n
+	}
+	return submissions
+}
+
+// MockChain is a chain of blocks whose hashes change above the fork height
+// once it has been forked.
+type MockChain struct {
+	mu       *sync.Mutex
+	head     uint64
+	forkedAt uint64
+	forked   bool
+}
+
+func (chain *MockChain) hash(height uint64) pack.Bytes32 {
+	var hash pack.Bytes32
+	copy(hash[:], fmt.Sprintf("%v", height))
+	if chain.forked && height > chain.forkedAt {
+		hash[31] = 1
+	}
+	return hash
+}
+
+func (chain *MockChain) FetchBlockHeight(ctx context.Context) (uint64, error) {
+	return chain.head, nil
+}
+
+func (chain *MockChain) FetchBlockHash(ctx context.Context, height uint64) (pack.Bytes32, pack.Bytes32, error) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	return chain.hash(height), chain.hash(height - 1), nil
+}
+
+func (chain *MockChain) Fork(height uint64) {
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+
+	chain.forked = true
+	chain.forkedAt = height
+}
+
+// MockReorgingFetcher forks the chain while the first range of blocks is being
+// scanned.
+type MockReorgingFetcher struct {
+	chain *MockChain
+	calls *int64
+}
+
+func (fetcher MockReorgingFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	if atomic.AddInt64(fetcher.calls, 1) == 1 {
+		fetcher.chain.Fork(from)
+	}
+	c := make(chan BurnLogResult)
+	close(c)
+	return c, nil
+}
+
+// MockFlakyFetcher fails to fetch burns the first time it is called.
+type MockFlakyFetcher struct {
+	MockLogFetcher
+	calls *int64
+}
+
+func (fetcher MockFlakyFetcher) FetchBurnLogs(ctx context.Context, from uint64, to uint64) (chan BurnLogResult, error) {
+	if atomic.AddInt64(fetcher.calls, 1) == 1 {
+		return nil, fmt.Errorf("service unavailable")
+	}
+	return fetcher.MockLogFetcher.FetchBurnLogs(ctx, from, to)
+}
+
 // Flag to check whether ethereum client is progressing
 // We need to wait a few seconds for new blocks,
 // so it is something we only want to do once
 var live = false
 
 var _ = Describe("Watcher", func() {
+	var sqlDB *sql.DB
+	var database db.DB
+
+	initDB := func() db.DB {
+		var err error
+		sqlDB, err = sql.Open("sqlite3", "./test.db")
+		Expect(err).NotTo(HaveOccurred())
+
+		database = db.New(sqlDB)
+		Expect(database.Init()).To(Succeed())
+		return database
+	}
+
+	// Redis servers started by the tests, which are closed after each test.
+	var servers []*miniredis.Miniredis
+
+	// initRedis returns a client for a new in-memory redis server.
+	initRedis := func() *redis.Client {
+		mr, err := miniredis.Run()
+		Expect(err).ToNot(HaveOccurred())
+		servers = append(servers, mr)
+		return redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	}
+
+	// initDeps returns the dependencies of a watcher that does not depend on
+	// a live chain.
+	initDeps := func() (*redis.Client, *logrus.Logger, tx.Selector, *distkey.Tracker) {
+		logger := logrus.New()
+		logger.SetLevel(logrus.FatalLevel)
+		pubk := distkey.NewTracker(logger, id.NewPrivKey().PubKey(), distkey.DefaultQuorum)
+		return initRedis(), logger, tx.Selector("BTC/fromEthereum"), pubk
+	}
+
+	AfterEach(func() {
+		if sqlDB != nil {
+			sqlDB.Close()
+			sqlDB = nil
+		}
+		os.Remove("./test.db")
+		for _, mr := range servers {
+			mr.Close()
+		}
+		servers = nil
+	})
+
 	init := func(ctx context.Context, interval time.Duration, reliableResponder bool) (Watcher, *redis.Client, chan BurnLogResult, *miniredis.Miniredis) {
 		mr, err := miniredis.Run()
 		if err != nil {
@@ -125,7 +589,7 @@ var _ = Describe("Watcher", func() {
 			mockResolver = jsonrpcresolver.RandomResponder()
 		}
 
-		pubk := id.NewPrivKey().PubKey()
+		pubk := distkey.NewTracker(logger, id.NewPrivKey().PubKey(), distkey.DefaultQuorum)
 
 		if err != nil {
 			logger.Panicf("failed to create account client: %v", err)
@@ -166,7 +630,7 @@ var _ = Describe("Watcher", func() {
 			live = true
 		}
 
-		watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, fetcher, heightFetcher, mockResolver, client, pubk, interval, 1000, 6)
+		watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, fetcher, heightFetcher, mockResolver, client, initDB(), pubk, interval, 1000, 6)
 
 		return watcher, client, burnIn, mr
 	}
@@ -182,9 +646,9 @@ var _ = Describe("Watcher", func() {
 			defer redisClient.Close()
 
 			Eventually(func() uint64 {
-				lastBlock, err := redisClient.Get("BTC/fromEthereum_lastCheckedBlock").Uint64()
-				// Cache hasn't been set yet, and that's OK
-				if err == redis.Nil {
+				lastBlock, err := database.WatcherCheckpoint(tx.Selector("BTC/fromEthereum"))
+				// Checkpoint hasn't been set yet, and that's OK
+				if err == sql.ErrNoRows {
 					err = nil
 					lastBlock = 0
 				}
@@ -449,6 +913,8 @@ var _ = Describe("Watcher", func() {
 
 			// clear the block, and check that we recover gracefully
 			redisClient.Del("BTC/fromEthereum_lastCheckedBlock")
+			_, err := sqlDB.Exec("DELETE FROM watcher_checkpoints")
+			Expect(err).ToNot(HaveOccurred())
 
 			Eventually(func() string {
 				h := redisClient.Get(fmt.Sprintf("BTC/fromEthereum_%v", 0)).Val()
@@ -687,7 +1153,17 @@ var _ = Describe("Watcher", func() {
 			solClient := solanaRPC.NewClient(bindingsOpts.Chains[multichain.Solana].RPC.String())
 			gateways := bindings.ContractGateways()
 			btcGateway := gateways[multichain.Solana][multichain.BTC]
-			burnLogFetcher := NewSolFetcher(solClient, string(btcGateway))
+
+			mr, err := miniredis.Run()
+			if err != nil {
+				panic(err)
+			}
+
+			client := redis.NewClient(&redis.Options{
+				Addr: mr.Addr(),
+			})
+
+			burnLogFetcher := NewSolFetcher(solClient, bindingsOpts.Chains[multichain.Solana].RPC.String(), initDB(), "BTC/fromSolana", string(btcGateway), "")
 
 			results, err := burnLogFetcher.FetchBurnLogs(ctx, 0, 0)
 			Expect(err).ToNot(HaveOccurred())
@@ -699,15 +1175,6 @@ var _ = Describe("Watcher", func() {
 				Expect(r).To(BeEmpty())
 			}
 
-			mr, err := miniredis.Run()
-			if err != nil {
-				panic(err)
-			}
-
-			client := redis.NewClient(&redis.Options{
-				Addr: mr.Addr(),
-			})
-
 			logger := logrus.New()
 			logger.SetLevel(logrus.ErrorLevel)
 
@@ -715,7 +1182,7 @@ var _ = Describe("Watcher", func() {
 
 			mockResolver := jsonrpcresolver.OkResponder()
 
-			pubk := id.NewPrivKey().PubKey()
+			pubk := distkey.NewTracker(logger, id.NewPrivKey().PubKey(), distkey.DefaultQuorum)
 
 			if err != nil {
 				logger.Panicf("failed to create account client: %v", err)
@@ -726,13 +1193,13 @@ var _ = Describe("Watcher", func() {
 			// We set the last checked block manually, because it will always start after the last checked burn
 			client.Set("BTC/fromSolana_lastCheckedBlock", 1, 0)
 
-			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, burnLogFetcher, burnLogFetcher, mockResolver, client, pubk, time.Second, 1000, 6)
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, bindings, burnLogFetcher, burnLogFetcher, mockResolver, client, database, pubk, time.Second, 1000, 6)
 
 			go watcher.Run(ctx)
 
 			Eventually(func() string {
-				h := client.Get(fmt.Sprintf("BTC/fromSolana_%v", 1)).Val()
-				return h
+				burn, _ := database.WatcherBurnByNonce(selector, "1")
+				return burn.V0Hash
 			}, 15*time.Second).Should(Equal("t9INi66uVw1uUQ/Q3xcdnn5GuqJUiC+q7Ilr9Xot3rk="))
 		})
 
@@ -755,7 +1222,8 @@ var _ = Describe("Watcher", func() {
 			solClient := solanaRPC.NewClient(bindingsOpts.Chains[multichain.Solana].RPC.String())
 			gateways := bindings.ContractGateways()
 			btcGateway := gateways[multichain.Solana][multichain.BTC]
-			burnLogFetcher := NewSolFetcher(solClient, string(btcGateway))
+
+			burnLogFetcher := NewSolFetcher(solClient, bindingsOpts.Chains[multichain.Solana].RPC.String(), initDB(), "BTC/fromSolana", string(btcGateway), "")
 
 			results, err := burnLogFetcher.FetchBurnLogs(ctx, 0, 0)
 			Expect(err).ToNot(HaveOccurred())
@@ -775,8 +1243,6 @@ var _ = Describe("Watcher", func() {
 			Eventually(func() BurnLogResult {
 				for r := range results {
 					if r.Error != nil {
-						results, err = burnLogFetcher.FetchBurnLogs(ctx, 1, 2)
-						Expect(err).ToNot(HaveOccurred())
 						continue
 					}
 					// We can't have reproducable signatures, so only check the other fields
@@ -784,6 +1250,10 @@ var _ = Describe("Watcher", func() {
 					log = r
 					return r
 				}
+				// The burn is pending until it has been confirmed, so fetch
+				// it again.
+				results, err = burnLogFetcher.FetchBurnLogs(ctx, 1, 2)
+				Expect(err).ToNot(HaveOccurred())
 				return log
 			}, 15*time.Second).Should(Equal(BurnLogResult{Result: BurnInfo{
 				Txid:        []byte{},
@@ -796,4 +1266,878 @@ var _ = Describe("Watcher", func() {
 		})
 	})
 
+	Context("when the chain reorgs", func() {
+		It("should rewind to the last checkpoint that is still part of the chain", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			burnIn := make(chan BurnLogResult)
+			close(burnIn)
+			burnLogFetcher := NewMockBurnLogFetcher(burnIn)
+			chain := &MockChain{mu: new(sync.Mutex), head: 200}
+
+			// Checkpoints were recorded at blocks 90 and 100 before the chain
+			// forked at block 95.
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 90, chain.hash(90).String(), nil)).To(Succeed())
+			Expect(database.UpdateWatcherCheckpoint(selector, 100, chain.hash(100).String(), nil)).To(Succeed())
+			chain.Fork(95)
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, burnLogFetcher, chain, jsonrpcresolver.OkResponder(), client, database, pubk, 100*time.Millisecond, 1000, 6)
+			go watcher.Run(ctx)
+
+			Eventually(func() map[uint64]string {
+				hashes, err := database.WatcherBlockHashes(selector)
+				Expect(err).ToNot(HaveOccurred())
+				return hashes
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal(map[uint64]string{
+				90:  chain.hash(90).String(),
+				194: chain.hash(194).String(),
+			}))
+			Expect(database.WatcherCheckpoint(selector)).To(Equal(uint64(194)))
+		})
+
+		It("should not move the checkpoint if the chain reorgs during the scan", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			chain := &MockChain{mu: new(sync.Mutex), head: 200}
+			fetcher := MockReorgingFetcher{chain: chain, calls: new(int64)}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 100, "", nil)).To(Succeed())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, chain, jsonrpcresolver.OkResponder(), client, database, pubk, 100*time.Millisecond, 1000, 6)
+			go watcher.Run(ctx)
+
+			// The first scan is discarded, and the hash stored with the
+			// checkpoint is the one of the new chain.
+			Eventually(func() map[uint64]string {
+				hashes, err := database.WatcherBlockHashes(selector)
+				Expect(err).ToNot(HaveOccurred())
+				return hashes
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal(map[uint64]string{
+				194: chain.hash(194).String(),
+			}))
+			Expect(atomic.LoadInt64(fetcher.calls)).To(BeNumerically(">=", 2))
+			Expect(database.WatcherCheckpoint(selector)).To(Equal(uint64(194)))
+		})
+	})
+
+	Context("when the provider limits the range of log queries", func() {
+		It("should reduce the number of blocks scanned at a time", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockRangeFetcher{maxRange: 50, height: 1000}
+			Expect(client.Set("BTC/fromEthereum_lastCheckedBlock", 0, 0).Err()).ToNot(HaveOccurred())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, initDB(), pubk, 10*time.Millisecond, 400, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				lastBlock, _ := database.WatcherCheckpoint(selector)
+				return lastBlock
+			}, 10*time.Second, 10*time.Millisecond).Should(Equal(uint64(1000)))
+		})
+	})
+
+	Context("when the provider limits the range to fewer blocks than the confidence interval", func() {
+		It("should only scan blocks after the checkpoint", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockRangeFetcher{maxRange: 3, height: 200, ranges: make(chan [2]uint64, 1000)}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 0, "", nil)).To(Succeed())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, database, pubk, 10*time.Millisecond, 400, 6)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				lastBlock, _ := database.WatcherCheckpoint(selector)
+				return lastBlock
+			}, 10*time.Second, 10*time.Millisecond).Should(Equal(uint64(194)))
+			cancel()
+
+			// The range never ends before it starts, even once the advance is
+			// smaller than the confidence interval.
+			for len(fetcher.ranges) > 0 {
+				r := <-fetcher.ranges
+				Expect(r[1]).To(BeNumerically(">", r[0]))
+			}
+		})
+
+		It("should not scan blocks that have not been confirmed", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockRangeFetcher{maxRange: 50, height: 4, ranges: make(chan [2]uint64, 1000)}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 0, "", nil)).To(Succeed())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, database, pubk, 10*time.Millisecond, 400, 6)
+			go watcher.Run(ctx)
+
+			Consistently(func() int {
+				return len(fetcher.ranges)
+			}, 200*time.Millisecond, 10*time.Millisecond).Should(Equal(0))
+			Expect(database.WatcherCheckpoint(selector)).To(Equal(uint64(0)))
+		})
+	})
+
+	Context("when the provider rejects the range of a log query", func() {
+		It("should bisect the range", func() {
+			node := NewMockEthNode(1000)
+			node.maxRange = 10
+			server := httptest.NewServer(node)
+			defer server.Close()
+			client, err := ethclient.Dial(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			address := common.HexToAddress("0x0000000000000000000000000000000000000001")
+			gateway, err := gatewaybinding.NewMintGatewayLogicV1(address, client)
+			Expect(err).ToNot(HaveOccurred())
+			chain := NewEthChainFetcher(client, time.Minute, 0, 0)
+
+			for _, fetcher := range []BurnLogFetcher{NewEthBurnLogFetcher(gateway), chain.Gateway(address, gateway)} {
+				node.ranges = nil
+				c, err := fetcher.FetchBurnLogs(context.Background(), 100, 163)
+				Expect(err).ToNot(HaveOccurred())
+				for res := range c {
+					Expect(res.Error).ToNot(HaveOccurred())
+				}
+
+				// The accepted queries cover the whole range without gaps.
+				ranges := node.Ranges()
+				Expect(len(ranges)).To(BeNumerically(">", 1))
+				next := uint64(100)
+				for _, r := range ranges {
+					Expect(r[0]).To(Equal(next))
+					Expect(r[1] - r[0]).To(BeNumerically("<=", 10))
+					next = r[1] + 1
+				}
+				Expect(next).To(Equal(uint64(164)))
+			}
+		})
+	})
+
+	Context("when the checkpoint is stored in redis", func() {
+		It("should migrate the checkpoint and burns to the database", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			v0Hash := v0.BurnTxHash(selector, pack.NewU256FromU64(5))
+			v1Hash := id.Hash{1}
+			Expect(client.Set("BTC/fromEthereum_lastCheckedBlock", 100, 0).Err()).ToNot(HaveOccurred())
+			Expect(client.Set("BTC/fromEthereum_5", v0Hash.String(), 0).Err()).ToNot(HaveOccurred())
+			Expect(client.Set(v0Hash.String(), v1Hash.String(), 0).Err()).ToNot(HaveOccurred())
+
+			// The chain has not progressed past the checkpoint, so the
+			// watcher only migrates it.
+			fetcher := MockRangeFetcher{maxRange: 50, height: 100}
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, initDB(), pubk, 10*time.Millisecond, 400, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() error {
+				_, err := database.WatcherCheckpoint(selector)
+				return err
+			}, 5*time.Second, 10*time.Millisecond).Should(Succeed())
+			Expect(database.WatcherCheckpoint(selector)).To(Equal(uint64(100)))
+
+			burn, err := database.WatcherBurnByNonce(selector, "5")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burn.V0Hash).To(Equal(v0Hash.String()))
+			Expect(burn.V1Hash).To(Equal(v1Hash.String()))
+		})
+	})
+
+	Context("when backfilling a range of blocks", func() {
+		It("should submit new burns without moving the checkpoint", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockLogFetcher{
+				burns: []BurnInfo{
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(10000),
+						Nonce:       pack.NewU256FromU64(0).Bytes32(),
+						BlockNumber: 10,
+					},
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(20000),
+						Nonce:       pack.NewU256FromU64(1).Bytes32(),
+						BlockNumber: 60,
+					},
+				},
+				height: 100,
+			}
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, initDB(), pubk, time.Second, 25, 0)
+
+			// Burns are new the first time they are found, and known after.
+			result, err := watcher.Backfill(ctx, 0, 100)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Burns).To(HaveLen(2))
+			Expect(result.Count(BackfillStatusNew)).To(Equal(2))
+
+			result, err = watcher.Backfill(ctx, 50, 70)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Burns).To(HaveLen(1))
+			Expect(result.Burns[0].Nonce).To(Equal("1"))
+			Expect(result.Burns[0].Status).To(Equal(BackfillStatusKnown))
+
+			burn, err := database.WatcherBurnByNonce(selector, "0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burn.V0Hash).To(Equal(v0.BurnTxHash(selector, pack.NewU256FromU64(0)).String()))
+
+			_, err = database.WatcherCheckpoint(selector)
+			Expect(err).To(Equal(sql.ErrNoRows))
+		})
+
+		It("should not backfill beyond the current block", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockLogFetcher{height: 100}
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, initDB(), pubk, time.Second, 25, 0)
+
+			_, err := watcher.Backfill(ctx, 50, 150)
+			Expect(err).To(HaveOccurred())
+			_, err = watcher.Backfill(ctx, 50, 40)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should include the burn at the end of a Solana range", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, _, pubk := initDeps()
+			selector := tx.Selector("BTC/fromSolana")
+
+			gateway := "DHpzwsdvAzq61PN9ZwQWg2hzwX8gYNfKAdsNKKtdKDux"
+			node := NewMockSolana()
+			server := httptest.NewServer(node)
+			defer server.Close()
+
+			to := []byte{111, 156, 83, 29, 221, 210, 44, 11, 79, 156, 112, 96, 116, 20, 53, 247, 21, 98, 180, 2, 95, 155, 124, 199, 196}
+			for nonce := uint64(1); nonce <= 3; nonce++ {
+				node.Burn(gateway, nonce, 1000*nonce, to, true)
+			}
+
+			// The height of the gateway is one past the nonce of the last
+			// burn, and the range is scanned in steps of two burns.
+			fetcher := NewSolFetcher(solanaRPC.NewClient(server.URL), server.URL, initDB(), selector, gateway, "")
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, MockLogFetcher{height: 4}, jsonrpcresolver.OkResponder(), client, database, pubk, time.Second, 2, 0)
+
+			result, err := watcher.Backfill(ctx, 1, 3)
+			Expect(err).ToNot(HaveOccurred())
+			nonces := []string{}
+			for _, burn := range result.Burns {
+				nonces = append(nonces, burn.Nonce)
+			}
+			Expect(nonces).To(Equal([]string{"1", "2", "3"}))
+			Expect(result.Count(BackfillStatusNew)).To(Equal(3))
+			Expect(database.WatcherPendingNonces(selector)).To(BeEmpty())
+
+			_, err = watcher.Backfill(ctx, 1, 4)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when querying the status", func() {
+		It("should report the progress of the watcher", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockLogFetcher{
+				burns: []BurnInfo{
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(10000),
+						Nonce:       pack.NewU256FromU64(0).Bytes32(),
+						BlockNumber: 60,
+					},
+				},
+				height: 100,
+			}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 50, "", nil)).To(Succeed())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, database, pubk, 10*time.Millisecond, 20, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				return uint64(watcher.Status().LastCheckedHeight)
+			}, 5*time.Second, 10*time.Millisecond).Should(Equal(uint64(100)))
+
+			status := watcher.Status()
+			Expect(status.Chain).To(Equal(multichain.Ethereum))
+			Expect(status.Asset).To(Equal(multichain.BTC))
+			Expect(status.Head).To(Equal(pack.NewU64(100)))
+			Expect(status.Lag).To(Equal(pack.NewU64(0)))
+			Expect(status.BurnsInWindow).To(Equal(pack.NewU64(1)))
+			Expect(status.LastError).To(BeEmpty())
+		})
+
+		It("should clear the last error once a scan succeeds", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockFlakyFetcher{MockLogFetcher: MockLogFetcher{height: 100}, calls: new(int64)}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 50, "", nil)).To(Succeed())
+
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, jsonrpcresolver.OkResponder(), client, database, pubk, 10*time.Millisecond, 20, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				return uint64(watcher.Status().LastCheckedHeight)
+			}, 5*time.Second, 10*time.Millisecond).Should(Equal(uint64(100)))
+
+			Expect(atomic.LoadInt64(fetcher.calls)).To(BeNumerically(">", 1))
+			status := watcher.Status()
+			Expect(status.LastError).To(BeEmpty())
+			Expect(status.LastErrorTime).To(Equal(pack.NewU64(0)))
+			Expect(status.LastSuccessTime).ToNot(Equal(pack.NewU64(0)))
+		})
+	})
+
+	Context("when fetching Solana burns", func() {
+		It("should fetch burns in batches and retry unconfirmed burns", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			gateway := "DHpzwsdvAzq61PN9ZwQWg2hzwX8gYNfKAdsNKKtdKDux"
+			node := NewMockSolana()
+			server := httptest.NewServer(node)
+			defer server.Close()
+
+			// The burn with nonce 3 is not confirmed yet.
+			to := []byte("recipient")
+			for nonce := uint64(1); nonce <= 5; nonce++ {
+				node.Burn(gateway, nonce, 1000*nonce, to, nonce != 3)
+			}
+
+			fetcher := NewSolFetcher(solanaRPC.NewClient(server.URL), server.URL, initDB(), "BTC/fromSolana", gateway, "")
+			fetch := func(from, to uint64) []uint64 {
+				results, err := fetcher.FetchBurnLogs(ctx, from, to)
+				Expect(err).ToNot(HaveOccurred())
+				nonces := []uint64{}
+				for result := range results {
+					Expect(result.Error).ToNot(HaveOccurred())
+					nonces = append(nonces, uint64(result.Result.BlockNumber))
+				}
+				return nonces
+			}
+
+			// The unconfirmed burn does not hold back the burns after it.
+			Expect(fetch(1, 6)).To(Equal([]uint64{1, 2, 4, 5}))
+			Expect(node.Batches()).To(Equal(1))
+			Expect(node.Lookups()).To(Equal(1))
+			Expect(database.WatcherPendingNonces("BTC/fromSolana")).To(And(HaveLen(1), HaveKey(uint64(3))))
+
+			// Once confirmed, the burn is fetched along with the new burns.
+			node.Confirm(gateway, 3)
+			node.Burn(gateway, 6, 6000, to, true)
+			Expect(fetch(6, 7)).To(Equal([]uint64{3, 6}))
+			Expect(node.Batches()).To(Equal(2))
+
+			// The burn is no longer pending once the watcher has moved past
+			// it.
+			Expect(fetch(7, 7)).To(BeEmpty())
+			Expect(database.WatcherPendingNonces("BTC/fromSolana")).To(BeEmpty())
+		})
+
+		It("should give up on burns that stay pending", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			gateway := "DHpzwsdvAzq61PN9ZwQWg2hzwX8gYNfKAdsNKKtdKDux"
+			node := NewMockSolana()
+			server := httptest.NewServer(node)
+			defer server.Close()
+
+			selector := tx.Selector("BTC/fromSolana")
+			node.Burn(gateway, 1, 1000, []byte("recipient"), false)
+
+			fetcher := NewSolFetcher(solanaRPC.NewClient(server.URL), server.URL, initDB(), selector, gateway, "")
+			fetch := func(from, to uint64) int {
+				results, err := fetcher.FetchBurnLogs(ctx, from, to)
+				Expect(err).ToNot(HaveOccurred())
+				n := 0
+				for result := range results {
+					Expect(result.Error).ToNot(HaveOccurred())
+					n++
+				}
+				return n
+			}
+			Expect(fetch(1, 2)).To(Equal(0))
+			Expect(database.WatcherPendingNonces(selector)).To(HaveKey(uint64(1)))
+
+			// The burn is retried until it has been pending for too long.
+			Expect(fetch(2, 2)).To(Equal(0))
+			Expect(database.WatcherPendingNonces(selector)).To(HaveKey(uint64(1)))
+			Expect(database.DeleteWatcherPendingNonces(selector, []uint64{1})).To(Succeed())
+			Expect(database.InsertWatcherPendingNonces(selector, []uint64{1}, time.Now().Add(-DefaultSolanaPendingTimeout-time.Minute))).To(Succeed())
+			Expect(fetch(2, 2)).To(Equal(0))
+			Expect(database.WatcherPendingNonces(selector)).To(BeEmpty())
+
+			letters, err := database.WatcherDeadLetters(selector)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].Nonce).To(Equal("1"))
+		})
+	})
+
+	Context("when a submission fails part-way through a range", func() {
+		It("should not submit accepted burns again", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockLogFetcher{
+				burns: []BurnInfo{
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(10000),
+						Nonce:       pack.NewU256FromU64(0).Bytes32(),
+						BlockNumber: 10,
+					},
+					{
+						ToBytes:     []byte("not an address"),
+						Amount:      pack.NewU256FromU64(20000),
+						Nonce:       pack.NewU256FromU64(1).Bytes32(),
+						BlockNumber: 20,
+					},
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(30000),
+						Nonce:       pack.NewU256FromU64(2).Bytes32(),
+						BlockNumber: 30,
+					},
+				},
+				height: 100,
+			}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 0, "", nil)).To(Succeed())
+
+			// The second submission, of the burn with nonce 2, is rejected.
+			submitter := NewMockSubmitter(2)
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, submitter, client, database, pubk, 10*time.Millisecond, 1000, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				lastBlock, _ := database.WatcherCheckpoint(selector)
+				return lastBlock
+			}, 5*time.Second, 10*time.Millisecond).Should(Equal(uint64(100)))
+
+			// Every valid burn is submitted once, apart from the rejected
+			// submission.
+			Expect(submitter.Calls()).To(Equal(3))
+			submissions := submitter.Submissions()
+			Expect(submissions).To(HaveLen(2))
+			for _, n := range submissions {
+				Expect(n).To(Equal(1))
+			}
+			for _, nonce := range []string{"0", "2"} {
+				status, _, err := database.WatcherNonceStatus(selector, nonce)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(status).To(Equal(db.WatcherNonceStatusAccepted))
+			}
+
+			// The burn with an invalid recipient is kept aside.
+			letters, err := database.WatcherDeadLetters(selector)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(letters).To(HaveLen(1))
+			Expect(letters[0].Nonce).To(Equal("1"))
+		})
+
+		It("should submit a burn that replaced an accepted burn with the same nonce", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client, logger, selector, pubk := initDeps()
+
+			fetcher := MockLogFetcher{
+				burns: []BurnInfo{
+					{
+						ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+						Amount:      pack.NewU256FromU64(10000),
+						Nonce:       pack.NewU256FromU64(0).Bytes32(),
+						BlockNumber: 10,
+					},
+				},
+				height: 100,
+			}
+			Expect(initDB().UpdateWatcherCheckpoint(selector, 0, "", nil)).To(Succeed())
+
+			// A burn with the same nonce was accepted before a reorg replaced
+			// it.
+			replaced := id.Hash{1}
+			Expect(database.UpdateWatcherNonceStatus(selector, "0", replaced.String(), db.WatcherNonceStatusAccepted)).To(Succeed())
+
+			submitter := NewMockSubmitter()
+			watcher := NewWatcher(logger, multichain.NetworkDevnet, selector, nil, fetcher, fetcher, submitter, client, database, pubk, 10*time.Millisecond, 1000, 0)
+			go watcher.Run(ctx)
+
+			Eventually(func() uint64 {
+				lastBlock, _ := database.WatcherCheckpoint(selector)
+				return lastBlock
+			}, 5*time.Second, 10*time.Millisecond).Should(Equal(uint64(100)))
+
+			Expect(submitter.Calls()).To(Equal(1))
+			status, hash, err := database.WatcherNonceStatus(selector, "0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status).To(Equal(db.WatcherNonceStatusAccepted))
+			Expect(hash).ToNot(Equal(replaced.String()))
+			for submitted := range submitter.Submissions() {
+				Expect(hash).To(Equal(submitted.String()))
+			}
+		})
+	})
+
+	Context("when failing over between RPC endpoints", func() {
+		logger := logrus.New()
+		logger.SetLevel(logrus.FatalLevel)
+		burn := BurnInfo{
+			ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+			Amount:      pack.NewU256FromU64(10000),
+			Nonce:       pack.NewU256FromU64(0).Bytes32(),
+			BlockNumber: 90,
+		}
+		endpoint := func(name string, fetcher MockLogFetcher) Endpoint {
+			return Endpoint{Name: name, BurnLogFetcher: fetcher, BlockHeightFetcher: fetcher}
+		}
+		fetchBurns := func(fetcher FailoverFetcher, from, to uint64) ([]BurnInfo, error) {
+			c, err := fetcher.FetchBurnLogs(context.Background(), from, to)
+			if err != nil {
+				return nil, err
+			}
+			burns := []BurnInfo{}
+			for res := range c {
+				if res.Error != nil {
+					return nil, res.Error
+				}
+				burns = append(burns, res.Result)
+			}
+			return burns, nil
+		}
+
+		It("should ignore endpoints that lag behind the others", func() {
+			fetcher := NewFailoverFetcher(logger, "Ethereum", []Endpoint{
+				endpoint("primary", MockLogFetcher{height: 50}),
+				endpoint("secondary", MockLogFetcher{burns: []BurnInfo{burn}, height: 100}),
+			}, 20)
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(100)))
+			burns, err := fetchBurns(fetcher, 0, height)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burns).To(HaveLen(1))
+		})
+
+		It("should ignore endpoints that are far ahead of the others", func() {
+			fetcher := NewFailoverFetcher(logger, "Ethereum", []Endpoint{
+				endpoint("primary", MockLogFetcher{height: 1000000}),
+				endpoint("secondary", MockLogFetcher{burns: []BurnInfo{burn}, height: 100}),
+				endpoint("tertiary", MockLogFetcher{height: 95}),
+			}, 20)
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(100)))
+			burns, err := fetchBurns(fetcher, 0, height)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burns).To(HaveLen(1))
+		})
+
+		It("should prefer the first endpoint when it is within the maximum lag", func() {
+			fetcher := NewFailoverFetcher(logger, "Ethereum", []Endpoint{
+				endpoint("primary", MockLogFetcher{height: 90}),
+				endpoint("secondary", MockLogFetcher{burns: []BurnInfo{burn}, height: 100}),
+			}, 20)
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(90)))
+			burns, err := fetchBurns(fetcher, 0, height)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burns).To(BeEmpty())
+		})
+
+		It("should fail over when fetching burns fails", func() {
+			primary := MockLogFetcher{height: 100}
+			secondary := MockLogFetcher{burns: []BurnInfo{burn}, height: 100}
+			failing := primary
+			failing.err = fmt.Errorf("service unavailable")
+			fetcher := NewFailoverFetcher(logger, "Ethereum", []Endpoint{
+				{Name: "primary", BurnLogFetcher: failing, BlockHeightFetcher: primary},
+				endpoint("secondary", secondary),
+			}, 20)
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			burns, err := fetchBurns(fetcher, 0, height)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(burns).To(HaveLen(1))
+		})
+
+		It("should return an error when no endpoint is healthy", func() {
+			fetcher := NewFailoverFetcher(logger, "Ethereum", []Endpoint{
+				endpoint("primary", MockLogFetcher{err: fmt.Errorf("service unavailable")}),
+				endpoint("secondary", MockLogFetcher{err: fmt.Errorf("service unavailable")}),
+			}, 20)
+
+			_, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when subscribing to new blocks and burn logs", func() {
+		burnAt := func(block uint64, txid string) BurnInfo {
+			return BurnInfo{
+				Txid:        []byte(txid),
+				ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+				Amount:      pack.NewU256FromU64(10000),
+				Nonce:       pack.NewU256FromU64(pack.NewU64(block)).Bytes32(),
+				BlockNumber: pack.NewU64(block),
+			}
+		}
+
+		// newFetcher returns a fetcher without a WebSocket connection, which
+		// polls for the given burns when it cannot serve them itself.
+		newFetcher := func(height uint64, polled ...BurnInfo) EthSubscriptionFetcher {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+			poller := MockLogFetcher{burns: polled, height: height}
+			address := common.HexToAddress("0x0000000000000000000000000000000000000001")
+			fetcher, ok := NewEthChainSubscription(logger, "Ethereum", nil, []common.Address{address}).Gateway(address, poller, poller)
+			Expect(ok).To(BeTrue())
+			return fetcher
+		}
+
+		// txids returns the txids of the burns between the given blocks.
+		txids := func(fetcher EthSubscriptionFetcher, from, to uint64) []string {
+			c, err := fetcher.FetchBurnLogs(context.Background(), from, to)
+			Expect(err).ToNot(HaveOccurred())
+			txids := []string{}
+			for res := range c {
+				Expect(res.Error).ToNot(HaveOccurred())
+				txids = append(txids, string(res.Result.Txid))
+			}
+			return txids
+		}
+
+		It("should serve pushed burns ordered by block and log index", func() {
+			fetcher := newFetcher(100, burnAt(103, "polled"))
+			fetcher.StartSubscription(100)
+			fetcher.PushHead(105)
+			fetcher.PushBurn(burnAt(103, "c"), 0)
+			fetcher.PushBurn(burnAt(101, "b"), 2)
+			fetcher.PushBurn(burnAt(101, "a"), 1)
+			fetcher.PushBurn(burnAt(101, "a"), 1)
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(105)))
+			Expect(txids(fetcher, 101, 104)).To(Equal([]string{"a", "b", "c"}))
+
+			// The burns before a range are dropped once it has been served,
+			// so those blocks are polled for if they are requested again.
+			Expect(txids(fetcher, 102, 104)).To(Equal([]string{"c"}))
+			Expect(txids(fetcher, 101, 104)).To(Equal([]string{"polled"}))
+		})
+
+		It("should drop burns that are removed by a reorg", func() {
+			fetcher := newFetcher(100)
+			fetcher.StartSubscription(100)
+			fetcher.PushHead(105)
+			fetcher.PushBurn(burnAt(102, "a"), 0)
+			fetcher.PushBurn(burnAt(103, "b"), 0)
+			fetcher.RemoveBurn(burnAt(102, "a"), 0)
+
+			Expect(txids(fetcher, 101, 104)).To(Equal([]string{"b"}))
+		})
+
+		It("should poll for blocks that are not behind the pushed head", func() {
+			fetcher := newFetcher(100, burnAt(102, "polled"))
+			fetcher.StartSubscription(100)
+			fetcher.PushHead(102)
+			fetcher.PushBurn(burnAt(101, "a"), 0)
+
+			// The logs of the head may not have been pushed yet.
+			Expect(txids(fetcher, 101, 102)).To(Equal([]string{"polled"}))
+			fetcher.PushHead(103)
+			Expect(txids(fetcher, 101, 102)).To(Equal([]string{"a"}))
+		})
+
+		It("should poll for the blocks missed while the subscription was down", func() {
+			fetcher := newFetcher(108, burnAt(104, "missed"))
+			fetcher.StartSubscription(100)
+			fetcher.PushHead(102)
+			fetcher.PushBurn(burnAt(101, "a"), 0)
+			Expect(txids(fetcher, 101, 101)).To(Equal([]string{"a"}))
+
+			// While the subscription is down, the head is polled for.
+			fetcher.StopSubscription()
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(108)))
+
+			// After reconnecting, only the blocks after the new head are
+			// pushed, so the gap is filled by polling.
+			fetcher.StartSubscription(108)
+			fetcher.PushHead(110)
+			fetcher.PushBurn(burnAt(104, "late"), 0)
+			fetcher.PushBurn(burnAt(109, "b"), 0)
+			Expect(txids(fetcher, 103, 109)).To(Equal([]string{"missed"}))
+			Expect(txids(fetcher, 109, 109)).To(Equal([]string{"b"}))
+		})
+
+		It("should poll while the subscription is not alive", func() {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+			poller := MockLogFetcher{
+				burns: []BurnInfo{{
+					ToBytes:     []byte("miMi2VET41YV1j6SDNTeZoPBbmH8B4nEx6"),
+					Amount:      pack.NewU256FromU64(10000),
+					Nonce:       pack.NewU256FromU64(0).Bytes32(),
+					BlockNumber: 90,
+				}},
+				height: 100,
+			}
+			address := common.HexToAddress("0x0000000000000000000000000000000000000001")
+			fetcher, ok := NewEthChainSubscription(logger, "Ethereum", nil, []common.Address{address}).Gateway(address, poller, poller)
+			Expect(ok).To(BeTrue())
+
+			height, err := fetcher.FetchBlockHeight(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(height).To(Equal(uint64(100)))
+
+			c, err := fetcher.FetchBurnLogs(context.Background(), 0, height)
+			Expect(err).ToNot(HaveOccurred())
+			burns := []BurnInfo{}
+			for res := range c {
+				Expect(res.Error).ToNot(HaveOccurred())
+				burns = append(burns, res.Result)
+			}
+			Expect(burns).To(HaveLen(1))
+		})
+
+		It("should share the subscription between the gateways of a chain", func() {
+			logger := logrus.New()
+			logger.SetLevel(logrus.FatalLevel)
+			poller := MockLogFetcher{height: 100}
+			addresses := []common.Address{
+				common.HexToAddress("0x0000000000000000000000000000000000000001"),
+				common.HexToAddress("0x0000000000000000000000000000000000000002"),
+			}
+			subscription := NewEthChainSubscription(logger, "Ethereum", nil, addresses)
+			_, ok := subscription.Gateway(common.HexToAddress("0x0000000000000000000000000000000000000003"), poller, poller)
+			Expect(ok).To(BeFalse())
+
+			subscription.StartSubscription(100)
+			subscription.PushHead(105)
+			for _, address := range addresses {
+				fetcher, ok := subscription.Gateway(address, poller, poller)
+				Expect(ok).To(BeTrue())
+				Expect(fetcher.Heads()).To(Receive())
+				height, err := fetcher.FetchBlockHeight(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(height).To(Equal(uint64(105)))
+			}
+		})
+	})
+
+	Context("when fetching the burns of several gateways on the same chain", func() {
+		It("should scan the head and the logs of all gateways once", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			node := NewMockEthNode(100)
+			server := httptest.NewServer(node)
+			defer server.Close()
+			client, err := ethclient.Dial(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			chain := NewEthChainFetcher(client, time.Minute, 6, 1000)
+			gateways := []EthGatewayFetcher{
+				chain.Gateway(common.HexToAddress("0x0000000000000000000000000000000000000001"), nil),
+				chain.Gateway(common.HexToAddress("0x0000000000000000000000000000000000000002"), nil),
+			}
+			fetch := func(gateway EthGatewayFetcher, from, to uint64) {
+				c, err := gateway.FetchBurnLogs(ctx, from, to)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c).To(BeClosed())
+			}
+
+			// The first fetch of the head scans the chain, and the other
+			// gateways are served the head of the scan.
+			for _, gateway := range gateways {
+				height, err := gateway.FetchBlockHeight(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(height).To(Equal(uint64(100)))
+			}
+			Expect(node.Requests("eth_getBlockByNumber")).To(Equal(1))
+
+			// No gateway was active during the scan, so each gateway fetches
+			// its logs on its own.
+			fetch(gateways[0], 90, 94)
+			fetch(gateways[1], 80, 94)
+			Expect(node.Requests("eth_getLogs")).To(Equal(2))
+
+			// Backfills do not make their gateway active.
+			fetch(chain.BackfillGateway(common.HexToAddress("0x0000000000000000000000000000000000000003"), nil), 10, 20)
+			Expect(node.Requests("eth_getLogs")).To(Equal(3))
+
+			// Once the scan is stale, the next fetch of the head scans the
+			// chain again. The logs of both gateways are fetched together,
+			// from the lowest checkpoint up to the head less the confidence
+			// interval.
+			chain.Expire()
+			_, err = gateways[0].FetchBlockHeight(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(node.Requests("eth_getLogs")).To(Equal(4))
+			Expect(node.Queries()[3]["address"]).To(HaveLen(2))
+			Expect(node.Ranges()[3]).To(Equal([2]uint64{80, 94}))
+
+			// The scan fetches the head, the block after the ranges the
+			// gateways fetched, and the block at the end of the scan before
+			// and after fetching the logs. The watchers are served these
+			// hashes without a request.
+			Expect(node.Requests("eth_getBlockByNumber")).To(Equal(5))
+			for _, height := range []uint64{94, 95, 100} {
+				_, _, err := gateways[1].FetchBlockHash(ctx, height)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(node.Requests("eth_getBlockByNumber")).To(Equal(5))
+
+			// Each gateway is served the logs after its own checkpoint.
+			fetch(gateways[0], 90, 94)
+			fetch(gateways[1], 80, 94)
+			Expect(node.Requests("eth_getLogs")).To(Equal(4))
+
+			// Ranges that are not covered by the scan are fetched for the
+			// gateway on its own.
+			fetch(gateways[0], 90, 100)
+			Expect(node.Requests("eth_getLogs")).To(Equal(5))
+			Expect(node.Queries()[4]["address"]).To(HaveLen(1))
+		})
+	})
 })
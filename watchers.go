@@ -0,0 +1,141 @@
+package lightnode
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/renproject/darknode/tx"
+	"github.com/renproject/lightnode/watcher"
+	"github.com/sirupsen/logrus"
+)
+
+// watcherSet runs a `Watcher` for every whitelisted selector that has a
+// gateway, and starts and stops watchers as the whitelist changes. It is safe
+// for concurrent use.
+type watcherSet struct {
+	logger logrus.FieldLogger
+
+	mu        *sync.Mutex
+	ctx       context.Context
+	builders  map[tx.Selector]func(backfill bool) watcher.Watcher
+	whitelist []tx.Selector
+	running   map[tx.Selector]context.CancelFunc
+	latest    map[tx.Selector]watcher.Watcher
+}
+
+func newWatcherSet(logger logrus.FieldLogger, whitelist []tx.Selector) *watcherSet {
+	return &watcherSet{
+		logger:    logger,
+		mu:        new(sync.Mutex),
+		builders:  map[tx.Selector]func(backfill bool) watcher.Watcher{},
+		whitelist: whitelist,
+		running:   map[tx.Selector]context.CancelFunc{},
+		latest:    map[tx.Selector]watcher.Watcher{},
+	}
+}
+
+// add registers the constructor of the watcher for a selector with a gateway.
+// The constructor is told whether the watcher is only used for a backfill, in
+// which case it must not share its progress with the running watchers.
+func (set *watcherSet) add(selector tx.Selector, build func(backfill bool) watcher.Watcher) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	set.builders[selector] = build
+}
+
+// Run starts the watchers for the whitelisted selectors. The watchers are
+// stopped when the context is done. This function is not blocking.
+func (set *watcherSet) Run(ctx context.Context) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	set.ctx = ctx
+	set.apply()
+}
+
+// SetWhitelist starts the watchers for selectors that have been added to the
+// whitelist and stops the watchers for selectors that have been removed. If
+// the set is not running yet, the whitelist is applied once it starts.
+func (set *watcherSet) SetWhitelist(whitelist []tx.Selector) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	set.whitelist = whitelist
+	if set.ctx != nil {
+		set.apply()
+	}
+}
+
+// apply reconciles the running watchers with the whitelist. It must be called
+// with the mutex held.
+func (set *watcherSet) apply() {
+	whitelisted := map[tx.Selector]bool{}
+	for _, selector := range set.whitelist {
+		whitelisted[selector] = true
+	}
+
+	for selector, cancel := range set.running {
+		if !whitelisted[selector] {
+			cancel()
+			delete(set.running, selector)
+			set.logger.Info("stopped watching ", selector)
+		}
+	}
+	for selector, build := range set.builders {
+		if !whitelisted[selector] {
+			continue
+		}
+		if _, ok := set.running[selector]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(set.ctx)
+		set.running[selector] = cancel
+		w := build(false)
+		set.latest[selector] = w
+		go w.Run(ctx)
+		set.logger.Info("watching ", selector)
+	}
+}
+
+// Backfill re-scans the blocks between from and to (inclusive) for the burns
+// of the selector, using a new watcher so that the checkpoint of the running
+// watcher is not moved.
+func (set *watcherSet) Backfill(ctx context.Context, selector tx.Selector, from, to uint64) (watcher.BackfillResult, error) {
+	set.mu.Lock()
+	build, ok := set.builders[selector]
+	set.mu.Unlock()
+	if !ok {
+		return watcher.BackfillResult{}, fmt.Errorf("no gateway for selector %v", selector)
+	}
+	return build(true).Backfill(ctx, from, to)
+}
+
+// Status returns the progress of the watcher of every selector with a gateway,
+// ordered by selector. Watchers that are not running are reported as paused,
+// along with the progress they made before they were stopped.
+func (set *watcherSet) Status() []watcher.Status {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	statuses := make([]watcher.Status, 0, len(set.builders))
+	for selector := range set.builders {
+		status := watcher.Status{
+			Selector: selector,
+			Chain:    selector.Source(),
+			Asset:    selector.Asset(),
+		}
+		if w, ok := set.latest[selector]; ok {
+			status = w.Status()
+		}
+		_, running := set.running[selector]
+		status.Paused = !running
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Selector < statuses[j].Selector
+	})
+	return statuses
+}